@@ -4,8 +4,10 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/go-i2p/gitlab-to-gitea/config"
 	"github.com/go-i2p/gitlab-to-gitea/gitea"
@@ -19,6 +21,17 @@ const (
 )
 
 func main() {
+	dryRun := flag.Bool("dry-run", false, "Plan the migration without writing to Gitea (overrides DRY_RUN)")
+	planFile := flag.String("plan", "", "Path of the JSON plan written by a dry run (overrides PLAN_FILE)")
+	exportDir := flag.String("export", "", "Write projects as Gitea repository dumps to this directory (overrides EXPORT_DIR)")
+	importState := flag.String("import-state", "", "Import this JSON state file into the SQLite state (overrides IMPORT_STATE_FILE)")
+	verify := flag.Bool("verify", false, "Compare the migrated projects with their Gitea repositories instead of migrating")
+	verifyReport := flag.String("verify-report", "", "Path of the JSON report written by -verify (overrides VERIFY_REPORT_FILE)")
+	sync := flag.Bool("sync", false, "Keep migrated projects in sync with GitLab, every SYNC_INTERVAL seconds")
+	convertMirrors := flag.Bool("convert-mirrors", false, "Convert the pull mirrors of migrated projects into regular repositories")
+	report := flag.Bool("report", false, "List the partially migrated projects recorded in the state and exit")
+	flag.Parse()
+
 	utils.PrintHeader("---=== GitLab to Gitea migration ===---")
 	fmt.Printf("Version: %s\n\n", scriptVersion)
 
@@ -35,6 +48,52 @@ func main() {
 		utils.PrintError(fmt.Sprintf("Failed to load configuration: %v", err))
 		os.Exit(1)
 	}
+	if *dryRun {
+		cfg.DryRun = true
+	}
+	if *planFile != "" {
+		cfg.PlanFile = *planFile
+	}
+	if *exportDir != "" {
+		cfg.ExportDir = *exportDir
+	}
+	if *importState != "" {
+		if cfg.StateBackend != config.StateBackendSQLite {
+			utils.PrintError(fmt.Sprintf("-import-state needs STATE_BACKEND=%s", config.StateBackendSQLite))
+			os.Exit(1)
+		}
+		cfg.StateImportFile = *importState
+	}
+	if *report {
+		printStateReport(cfg)
+		return
+	}
+	if *verifyReport != "" {
+		cfg.VerifyReportFile = *verifyReport
+	}
+	if *verify {
+		// Verification only reads Gitea and the state, for the Gitea names of migrated
+		// projects, so there is nothing to plan
+		cfg.DryRun = false
+		cfg.ReadOnly = true
+		cfg.ResumeMigration = true
+	}
+	if *sync {
+		if cfg.DryRun {
+			utils.PrintError("-sync cannot be combined with a dry run")
+			os.Exit(1)
+		}
+		// Syncing continues from the recorded state
+		cfg.ResumeMigration = true
+	}
+	if *convertMirrors {
+		if !cfg.DryRun && (cfg.GiteaDBType == "" || cfg.GiteaDBDSN == "" || cfg.GiteaRepoRoot == "") {
+			utils.PrintError("-convert-mirrors needs GITEA_DB_TYPE, GITEA_DB_DSN and GITEA_REPO_ROOT")
+			os.Exit(1)
+		}
+		// Converting leaves the recorded state alone
+		cfg.ResumeMigration = true
+	}
 
 	// Initialize clients
 	gitlabClient, err := gitlab.NewClient(cfg.GitLabURL, cfg.GitLabToken)
@@ -49,6 +108,19 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Limit concurrent requests per host
+	gitlabClient.SetMaxConcurrency(cfg.GitLabMaxConcurrency)
+	giteaClient.SetMaxConcurrency(cfg.GiteaMaxConcurrency)
+
+	// Retry transient failures and stay under the configured request rates
+	retryPolicy := utils.DefaultRetryPolicy()
+	retryPolicy.MaxRetries = cfg.MaxRetries
+	retryPolicy.MaxWait = cfg.RetryMaxWait
+	gitlabClient.SetRetryPolicy(retryPolicy)
+	giteaClient.SetRetryPolicy(retryPolicy)
+	gitlabClient.SetRateLimit(cfg.GitLabRateLimit)
+	giteaClient.SetRateLimit(cfg.GiteaRateLimit)
+
 	// Verify connections
 	glVersion, err := gitlabClient.GetVersion()
 	if err != nil {
@@ -65,13 +137,133 @@ func main() {
 	utils.PrintInfo(fmt.Sprintf("Connected to Gitea, version: %s", gtVersion))
 
 	// Initialize migration manager
-	migrationManager := migration.NewManager(gitlabClient, giteaClient, cfg)
+	migrationManager, err := migration.NewManager(gitlabClient, giteaClient, cfg)
+	if err != nil {
+		utils.PrintError(fmt.Sprintf("Failed to initialize migration state: %v", err))
+		os.Exit(1)
+	}
+	defer migrationManager.Close()
+
+	if *verify {
+		if !verifyMigration(migrationManager, cfg.VerifyReportFile) {
+			migrationManager.Close()
+			os.Exit(1)
+		}
+		return
+	}
+
+	// The API cannot set creation times or convert mirrors, so they are written to the database
+	if (cfg.PreserveTimestamps || *convertMirrors) && !cfg.DryRun {
+		giteaDB, err := gitea.OpenDatabase(cfg.GiteaDBType, cfg.GiteaDBDSN)
+		if err != nil {
+			utils.PrintError(fmt.Sprintf("Failed to open Gitea database: %v", err))
+			os.Exit(1)
+		}
+		defer giteaDB.Close()
+		migrationManager.SetGiteaDatabase(giteaDB)
+	}
+
+	if *sync {
+		syncMigration(migrationManager, cfg.SyncInterval)
+		return
+	}
+
+	if *convertMirrors {
+		utils.PrintHeader("Converting mirrors...")
+		if err := migrationManager.ConvertMirrors(); err != nil {
+			utils.PrintError(fmt.Sprintf("Error converting mirrors: %v", err))
+			migrationManager.Close()
+			os.Exit(1)
+		}
+		if plan := migrationManager.Plan(); plan != nil {
+			writePlan(plan, cfg.PlanFile)
+		}
+		return
+	}
 
 	// Perform migration
-	migrateWithErrorHandling(migrationManager)
+	migrateWithErrorHandling(migrationManager, cfg.ExportDir)
+
+	if plan := migrationManager.Plan(); plan != nil {
+		writePlan(plan, cfg.PlanFile)
+	}
+}
+
+// printStateReport lists the partially migrated projects of the migration state, without
+// changing it
+func printStateReport(cfg *config.Config) {
+	cfg.ReadOnly = true
+	state, err := migration.OpenState(cfg)
+	if err != nil {
+		utils.PrintError(fmt.Sprintf("Failed to open migration state: %v", err))
+		os.Exit(1)
+	}
+	defer state.Close()
+
+	if err := state.Load(); err != nil {
+		utils.PrintError(fmt.Sprintf("Failed to load migration state: %v", err))
+		os.Exit(1)
+	}
+	fmt.Print(migration.PartialProjectsReport(state))
 }
 
-func migrateWithErrorHandling(migrator *migration.Manager) {
+// verifyMigration compares the migrated projects with their Gitea repositories and writes
+// the report. It reports whether every repository matches its project.
+func verifyMigration(migrator *migration.Manager, reportFile string) bool {
+	utils.PrintHeader("Verifying migrated projects...")
+	report, err := migrator.VerifyProjects()
+	if err != nil {
+		utils.PrintError(fmt.Sprintf("Verification failed: %v", err))
+		return false
+	}
+
+	if err := report.Write(reportFile); err != nil {
+		utils.PrintError(fmt.Sprintf("Failed to write verification report: %v", err))
+		return false
+	}
+	utils.PrintSuccess(fmt.Sprintf("Verification report written to %s", reportFile))
+
+	fmt.Println()
+	if failed := report.Failed(); failed > 0 {
+		utils.PrintError(fmt.Sprintf("%d of %d projects differ from their Gitea repositories", failed, len(report.Projects)))
+		return false
+	}
+	utils.PrintSuccess(fmt.Sprintf("All %d projects match their Gitea repositories", len(report.Projects)))
+	return true
+}
+
+// syncMigration brings GitLab changes across to the migrated projects, once if interval is
+// zero and otherwise every interval until the process is stopped
+func syncMigration(migrator *migration.Manager, interval time.Duration) {
+	for {
+		utils.PrintHeader("Syncing migrated projects...")
+		if err := migrator.SyncProjects(); err != nil {
+			utils.PrintError(fmt.Sprintf("Error during sync: %v", err))
+		} else {
+			utils.PrintSuccess("Completed sync")
+		}
+
+		if interval <= 0 {
+			return
+		}
+		utils.PrintInfo(fmt.Sprintf("Next sync in %s", interval))
+		time.Sleep(interval)
+	}
+}
+
+// writePlan prints the summary of a dry run and saves the full plan
+func writePlan(plan *migration.Plan, planFile string) {
+	fmt.Println()
+	fmt.Print(plan.Summary())
+
+	if err := plan.Write(planFile); err != nil {
+		utils.PrintError(fmt.Sprintf("Failed to write migration plan: %v", err))
+		os.Exit(1)
+	}
+	utils.PrintSuccess(fmt.Sprintf("Migration plan written to %s", planFile))
+}
+
+func migrateWithErrorHandling(migrator *migration.Manager, exportDir string) {
 	defer func() {
 		if r := recover(); r != nil {
 			utils.PrintError(fmt.Sprintf("Migration failed with panic: %v", r))
@@ -91,14 +283,25 @@ func migrateWithErrorHandling(migrator *migration.Manager) {
 	}
 	utils.PrintSuccess("Completed users and groups migration")
 
-	utils.PrintHeader("Starting projects migration...")
-	// Import projects
-	err = migrator.ImportProjects()
-	if err != nil {
-		errCount++
-		utils.PrintError(fmt.Sprintf("Error during project migration: %v", err))
+	if exportDir != "" {
+		utils.PrintHeader("Starting projects export...")
+		// Export projects as repository dumps
+		err = migrator.ExportProjects(exportDir)
+		if err != nil {
+			errCount++
+			utils.PrintError(fmt.Sprintf("Error during project export: %v", err))
+		}
+		utils.PrintSuccess("Completed projects export")
+	} else {
+		utils.PrintHeader("Starting projects migration...")
+		// Import projects
+		err = migrator.ImportProjects()
+		if err != nil {
+			errCount++
+			utils.PrintError(fmt.Sprintf("Error during project migration: %v", err))
+		}
+		utils.PrintSuccess("Completed projects migration")
 	}
-	utils.PrintSuccess("Completed projects migration")
 
 	fmt.Println()
 	if errCount == 0 {
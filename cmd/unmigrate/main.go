@@ -11,7 +11,7 @@ import (
 
 func main() {
 	utils.PrintHeader("---=== Gitea Unmigration Tool ===---")
-	fmt.Println("This tool will remove all entities from Gitea except the admin user.\n")
+	fmt.Print("This tool will remove all entities from Gitea except the admin user.\n\n")
 
 	// Load environment variables
 	err := config.LoadEnv()
@@ -43,13 +43,12 @@ func main() {
 	utils.PrintInfo(fmt.Sprintf("Connected to Gitea, version: %s", gtVersion))
 
 	// Get current user (admin)
-	var currentUser map[string]interface{}
-	err = giteaClient.Get("/api/v1/user", &currentUser)
+	currentUser, err := giteaClient.GetCurrentUser()
 	if err != nil {
 		utils.PrintError(fmt.Sprintf("Failed to get current user: %v", err))
 		os.Exit(1)
 	}
-	adminUsername := currentUser["login"].(string)
+	adminUsername := currentUser.Login
 	utils.PrintInfo(fmt.Sprintf("Logged in as: %s", adminUsername))
 
 	// Confirm deletion
@@ -123,8 +122,8 @@ func (u *Unmigrator) deleteAllRepositories() error {
 
 	// Delete each repository
 	for _, repo := range repos {
-		fullName, ok := repo["full_name"].(string)
-		if !ok {
+		fullName := repo.FullName
+		if fullName == "" {
 			utils.PrintWarning("Could not get repository name, skipping")
 			continue
 		}
@@ -147,8 +146,7 @@ func (u *Unmigrator) deleteAllOrganizations() error {
 	utils.PrintHeader("Deleting organizations...")
 
 	// Get all organizations
-	var orgs []map[string]interface{}
-	err := u.client.Get("/orgs", &orgs)
+	orgs, err := u.client.ListOrgs()
 	if err != nil {
 		return fmt.Errorf("failed to get organizations: %w", err)
 	}
@@ -157,8 +155,8 @@ func (u *Unmigrator) deleteAllOrganizations() error {
 
 	// Delete each organization
 	for _, org := range orgs {
-		orgName, ok := org["username"].(string)
-		if !ok {
+		orgName := org.UserName
+		if orgName == "" {
 			utils.PrintWarning("Could not get organization name, skipping")
 			continue
 		}
@@ -181,8 +179,7 @@ func (u *Unmigrator) deleteAllNonAdminUsers() error {
 	utils.PrintHeader("Deleting users...")
 
 	// Get all users
-	var users []map[string]interface{}
-	err := u.client.Get("admin/users?limit=1000", &users)
+	users, err := u.client.AdminListUsers()
 	if err != nil {
 		return fmt.Errorf("failed to get users: %w", err)
 	}
@@ -192,13 +189,12 @@ func (u *Unmigrator) deleteAllNonAdminUsers() error {
 	deleteCount := 0
 
 	for _, user := range users {
-		username, ok := user["login"].(string)
-		if !ok {
+		if user.Login == "" {
 			continue
 		}
 
-		isAdmin, _ := user["is_admin"].(bool)
-		isCurrentUser := username == u.adminUsername
+		isAdmin := user.IsAdmin
+		isCurrentUser := user.Login == u.adminUsername
 
 		if isAdmin || isCurrentUser {
 			preserveCount++
@@ -215,14 +211,14 @@ func (u *Unmigrator) deleteAllNonAdminUsers() error {
 	failedCount := 0
 
 	for _, user := range users {
-		username, ok := user["login"].(string)
-		if !ok {
+		username := user.Login
+		if username == "" {
 			utils.PrintWarning("Could not get username, skipping")
 			continue
 		}
 
 		// Check if the user is an admin or the current user
-		isAdmin, _ := user["is_admin"].(bool)
+		isAdmin := user.IsAdmin
 		isCurrentUser := username == u.adminUsername
 
 		// Skip if user is an admin OR is the authenticated user
@@ -246,10 +242,9 @@ func (u *Unmigrator) deleteAllNonAdminUsers() error {
 		err := u.client.Delete(fmt.Sprintf("admin/users/%s", username))
 		if err != nil {
 			// If that fails, try with the ID as fallback
-			userID, ok := user["id"].(float64)
-			if ok {
-				utils.PrintInfo(fmt.Sprintf("Retrying deletion with ID: %d", int(userID)))
-				err = u.client.Delete(fmt.Sprintf("admin/users/%d", int(userID)))
+			if user.ID != 0 {
+				utils.PrintInfo(fmt.Sprintf("Retrying deletion with ID: %d", user.ID))
+				err = u.client.Delete(fmt.Sprintf("admin/users/%d", user.ID))
 				if err != nil {
 					utils.PrintWarning(fmt.Sprintf("Failed to delete user %s: %v", username, err))
 					failedCount++
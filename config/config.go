@@ -5,20 +5,73 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"os/exec"
 	"strconv"
+	"strings"
+	"time"
+)
+
+// Authorship modes, deciding who issues and comments are created as
+const (
+	AuthorshipAdmin  = "admin"  // as the admin, bodies unchanged
+	AuthorshipHeader = "header" // as the admin, with an "Originally posted by" header
+	AuthorshipSudo   = "sudo"   // as the original author, falling back to the header
+)
+
+// Subgroup strategies, deciding what nested GitLab groups become in Gitea, which has no
+// nested organizations
+const (
+	SubgroupFlatten = "flatten" // an organization per group, subgroups named by their joined path
+	SubgroupTeams   = "teams"   // subgroups become teams of their top-level organization
+	SubgroupPrefix  = "prefix"  // subgroup projects go to the top-level organization, prefixed by their path
+)
+
+// State backends, deciding where the migration state is kept
+const (
+	StateBackendJSON   = "json"   // a JSON file, rewritten on every save
+	StateBackendSQLite = "sqlite" // an SQLite database, updated item by item
 )
 
 // Config holds all configuration parameters for the migration
 type Config struct {
-	GitLabURL          string
-	GitLabToken        string
-	GitLabAdminUser    string
-	GitLabAdminPass    string
-	GiteaURL           string
-	GiteaToken         string
-	MigrationStateFile string
-	ResumeMigration    bool
+	GitLabURL            string
+	GitLabToken          string
+	GitLabAdminUser      string
+	GitLabAdminPass      string
+	GiteaURL             string
+	GiteaToken           string
+	MigrationStateFile   string
+	StateBackend         string
+	StateImportFile      string // JSON state file imported into a new SQLite state
+	ResumeMigration      bool
+	PreserveIssueNumbers bool
+	AuthorshipMode       string
+	SubgroupStrategy     string
+	PreserveTimestamps   bool
+	GiteaDBType          string
+	GiteaDBDSN           string
+	GiteaRepoRoot        string // repository root of Gitea, for changes made to the repositories directly
+	MigrateWikis         bool
+	MigrateLFS           bool
+	LFSEndpoint          string // base URL of the GitLab LFS server, if not the repository URL
+	MigrationWorkers     int
+	GitLabMaxConcurrency int
+	GiteaMaxConcurrency  int
+	MaxRetries           int
+	RetryMaxWait         time.Duration
+	GitLabRateLimit      float64
+	GiteaRateLimit       float64
+	Filter               FilterConfig
+	Mirror               MirrorConfig
+	DryRun               bool
+	ReadOnly             bool // Gitea and the state are only read, as by -verify and -report
+	PlanFile             string
+	ExportDir            string
+	VerifyReportFile     string
+	SyncInterval         time.Duration     // time between sync passes; 0 runs a single pass
+	IdentityOverrides    map[string]string // Gitea names by kind:path, read from IDENTITY_OVERRIDES_FILE
 }
 
 // LoadConfig loads configuration from environment variables
@@ -44,29 +97,269 @@ func LoadConfig() (*Config, error) {
 	}
 
 	// Optional values with defaults
+	stateBackend := os.Getenv("STATE_BACKEND")
+	switch stateBackend {
+	case "":
+		stateBackend = StateBackendJSON
+	case StateBackendJSON, StateBackendSQLite:
+	default:
+		return nil, fmt.Errorf("STATE_BACKEND must be %s or %s", StateBackendJSON, StateBackendSQLite)
+	}
+
 	migrationStateFile := os.Getenv("MIGRATION_STATE_FILE")
 	if migrationStateFile == "" {
 		migrationStateFile = "migration_state.json"
+		if stateBackend == StateBackendSQLite {
+			migrationStateFile = "migration_state.db"
+		}
+	}
+
+	stateImportFile := os.Getenv("IMPORT_STATE_FILE")
+	if stateImportFile != "" && stateBackend != StateBackendSQLite {
+		return nil, fmt.Errorf("IMPORT_STATE_FILE needs STATE_BACKEND=%s", StateBackendSQLite)
+	}
+
+	resumeMigration, err := getEnvBool("RESUME_MIGRATION", true)
+	if err != nil {
+		return nil, err
+	}
+
+	preserveIssueNumbers, err := getEnvBool("PRESERVE_ISSUE_NUMBERS", false)
+	if err != nil {
+		return nil, err
+	}
+
+	authorshipMode := os.Getenv("AUTHORSHIP_MODE")
+	switch authorshipMode {
+	case "":
+		authorshipMode = AuthorshipAdmin
+	case AuthorshipAdmin, AuthorshipHeader, AuthorshipSudo:
+	default:
+		return nil, fmt.Errorf("AUTHORSHIP_MODE must be one of %s, %s or %s",
+			AuthorshipAdmin, AuthorshipHeader, AuthorshipSudo)
+	}
+
+	subgroupStrategy := os.Getenv("SUBGROUP_STRATEGY")
+	switch subgroupStrategy {
+	case "":
+		subgroupStrategy = SubgroupFlatten
+	case SubgroupFlatten, SubgroupTeams, SubgroupPrefix:
+	default:
+		return nil, fmt.Errorf("SUBGROUP_STRATEGY must be one of %s, %s or %s",
+			SubgroupFlatten, SubgroupTeams, SubgroupPrefix)
+	}
+
+	preserveTimestamps, err := getEnvBool("PRESERVE_TIMESTAMPS", false)
+	if err != nil {
+		return nil, err
 	}
 
-	resumeMigrationStr := os.Getenv("RESUME_MIGRATION")
-	resumeMigration := true // default
-	if resumeMigrationStr != "" {
-		var err error
-		resumeMigration, err = strconv.ParseBool(resumeMigrationStr)
-		if err != nil {
-			return nil, errors.New("RESUME_MIGRATION must be a boolean value")
+	giteaDBType := os.Getenv("GITEA_DB_TYPE")
+	giteaDBDSN := os.Getenv("GITEA_DB_DSN")
+	switch giteaDBType {
+	case "", "sqlite3", "mysql":
+	case "postgres":
+		return nil, errors.New("GITEA_DB_TYPE postgres is not supported, the Gitea database must be sqlite3 or mysql")
+	default:
+		return nil, fmt.Errorf("GITEA_DB_TYPE must be sqlite3 or mysql, not %q", giteaDBType)
+	}
+	if preserveTimestamps && (giteaDBType == "" || giteaDBDSN == "") {
+		return nil, errors.New("PRESERVE_TIMESTAMPS needs GITEA_DB_TYPE and GITEA_DB_DSN")
+	}
+
+	migrateWikis, err := getEnvBool("MIGRATE_WIKIS", false)
+	if err != nil {
+		return nil, err
+	}
+	if migrateWikis {
+		if _, err := exec.LookPath("git"); err != nil {
+			return nil, fmt.Errorf("MIGRATE_WIKIS needs the git command: %w", err)
+		}
+	}
+
+	migrateLFS, err := getEnvBool("MIGRATE_LFS", false)
+	if err != nil {
+		return nil, err
+	}
+	if migrateLFS {
+		if _, err := exec.LookPath("git"); err != nil {
+			return nil, fmt.Errorf("MIGRATE_LFS needs the git command: %w", err)
+		}
+	}
+
+	migrationWorkers, err := getEnvInt("MIGRATION_WORKERS", 1)
+	if err != nil {
+		return nil, err
+	}
+	if migrationWorkers < 1 {
+		return nil, errors.New("MIGRATION_WORKERS must be at least 1")
+	}
+
+	gitlabMaxConcurrency, err := getEnvInt("GITLAB_MAX_CONCURRENCY", 0)
+	if err != nil {
+		return nil, err
+	}
+	if gitlabMaxConcurrency < 0 {
+		return nil, errors.New("GITLAB_MAX_CONCURRENCY must not be negative")
+	}
+
+	giteaMaxConcurrency, err := getEnvInt("GITEA_MAX_CONCURRENCY", 0)
+	if err != nil {
+		return nil, err
+	}
+	if giteaMaxConcurrency < 0 {
+		return nil, errors.New("GITEA_MAX_CONCURRENCY must not be negative")
+	}
+
+	maxRetries, err := getEnvInt("MAX_RETRIES", 3)
+	if err != nil {
+		return nil, err
+	}
+	if maxRetries < 0 {
+		return nil, errors.New("MAX_RETRIES must not be negative")
+	}
+
+	retryMaxWait, err := getEnvInt("RETRY_MAX_WAIT", 60)
+	if err != nil {
+		return nil, err
+	}
+	if retryMaxWait < 0 {
+		return nil, errors.New("RETRY_MAX_WAIT must not be negative")
+	}
+
+	gitlabRateLimit, err := getEnvFloat("GITLAB_REQUESTS_PER_SECOND", 0)
+	if err != nil {
+		return nil, err
+	}
+	if gitlabRateLimit < 0 {
+		return nil, errors.New("GITLAB_REQUESTS_PER_SECOND must not be negative")
+	}
+
+	giteaRateLimit, err := getEnvFloat("GITEA_REQUESTS_PER_SECOND", 0)
+	if err != nil {
+		return nil, err
+	}
+	if giteaRateLimit < 0 {
+		return nil, errors.New("GITEA_REQUESTS_PER_SECOND must not be negative")
+	}
+
+	dryRun, err := getEnvBool("DRY_RUN", false)
+	if err != nil {
+		return nil, err
+	}
+
+	planFile := os.Getenv("PLAN_FILE")
+	if planFile == "" {
+		planFile = "migration_plan.json"
+	}
+
+	verifyReportFile := os.Getenv("VERIFY_REPORT_FILE")
+	if verifyReportFile == "" {
+		verifyReportFile = "verify_report.json"
+	}
+
+	syncInterval, err := getEnvInt("SYNC_INTERVAL", 300)
+	if err != nil {
+		return nil, err
+	}
+	if syncInterval < 0 {
+		return nil, errors.New("SYNC_INTERVAL must not be negative")
+	}
+
+	filter, err := loadFilterConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	mirror, err := loadMirrorConfig(os.Getenv("GITLAB_ADMIN_USER"), os.Getenv("GITLAB_ADMIN_PASS"))
+	if err != nil {
+		return nil, err
+	}
+
+	var identityOverrides map[string]string
+	if overridesFile := os.Getenv("IDENTITY_OVERRIDES_FILE"); overridesFile != "" {
+		if identityOverrides, err = readIdentityOverrides(overridesFile); err != nil {
+			return nil, err
 		}
 	}
 
 	return &Config{
-		GitLabURL:          gitlabURL,
-		GitLabToken:        gitlabToken,
-		GitLabAdminUser:    os.Getenv("GITLAB_ADMIN_USER"),
-		GitLabAdminPass:    os.Getenv("GITLAB_ADMIN_PASS"),
-		GiteaURL:           giteaURL,
-		GiteaToken:         giteaToken,
-		MigrationStateFile: migrationStateFile,
-		ResumeMigration:    resumeMigration,
+		GitLabURL:            gitlabURL,
+		GitLabToken:          gitlabToken,
+		GitLabAdminUser:      os.Getenv("GITLAB_ADMIN_USER"),
+		GitLabAdminPass:      os.Getenv("GITLAB_ADMIN_PASS"),
+		GiteaURL:             giteaURL,
+		GiteaToken:           giteaToken,
+		MigrationStateFile:   migrationStateFile,
+		StateBackend:         stateBackend,
+		StateImportFile:      stateImportFile,
+		ResumeMigration:      resumeMigration,
+		PreserveIssueNumbers: preserveIssueNumbers,
+		AuthorshipMode:       authorshipMode,
+		SubgroupStrategy:     subgroupStrategy,
+		PreserveTimestamps:   preserveTimestamps,
+		GiteaDBType:          giteaDBType,
+		GiteaDBDSN:           giteaDBDSN,
+		GiteaRepoRoot:        os.Getenv("GITEA_REPO_ROOT"),
+		MigrateWikis:         migrateWikis,
+		MigrateLFS:           migrateLFS,
+		LFSEndpoint:          strings.TrimSuffix(os.Getenv("LFS_ENDPOINT"), "/"),
+		MigrationWorkers:     migrationWorkers,
+		GitLabMaxConcurrency: gitlabMaxConcurrency,
+		GiteaMaxConcurrency:  giteaMaxConcurrency,
+		MaxRetries:           maxRetries,
+		RetryMaxWait:         time.Duration(retryMaxWait) * time.Second,
+		GitLabRateLimit:      gitlabRateLimit,
+		GiteaRateLimit:       giteaRateLimit,
+		Filter:               filter,
+		Mirror:               mirror,
+		DryRun:               dryRun,
+		PlanFile:             planFile,
+		ExportDir:            os.Getenv("EXPORT_DIR"),
+		VerifyReportFile:     verifyReportFile,
+		SyncInterval:         time.Duration(syncInterval) * time.Second,
+		IdentityOverrides:    identityOverrides,
 	}, nil
 }
+
+// getEnvBool reads a boolean environment variable, returning defaultValue if it is unset
+func getEnvBool(key string, defaultValue bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be a boolean value", key)
+	}
+	return parsed, nil
+}
+
+// getEnvInt reads an integer environment variable, returning defaultValue if it is unset
+func getEnvInt(key string, defaultValue int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer value", key)
+	}
+	return parsed, nil
+}
+
+// getEnvFloat reads a floating point environment variable, returning defaultValue if it is unset
+func getEnvFloat(key string, defaultValue float64) (float64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number", key)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,186 @@
+// filter.go
+
+// Package config handles application configuration through environment variables
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Archived filter modes
+const (
+	ArchivedInclude = "include"
+	ArchivedExclude = "exclude"
+	ArchivedOnly    = "only"
+)
+
+// FilterConfig selects the users, groups and projects taking part in a migration.
+// All project paths are GitLab paths with namespace, e.g. "platform/infra/terraform".
+type FilterConfig struct {
+	IncludeNamespaces []string       // namespace paths, subgroups included
+	ExcludeNamespaces []string       // namespace paths, subgroups included
+	IncludeProjects   []string       // project path globs
+	ExcludeProjects   []string       // project path globs
+	IncludeRegex      *regexp.Regexp // matched against the project path
+	ExcludeRegex      *regexp.Regexp // matched against the project path
+	Visibility        []string       // allowed visibility levels
+	Archived          string         // one of ArchivedInclude, ArchivedExclude, ArchivedOnly
+	ActiveSince       *time.Time     // last activity on or after
+	ActiveBefore      *time.Time     // last activity before
+	ProjectList       []string       // explicit project paths, read from PROJECT_LIST_FILE
+}
+
+// Active reports whether any filter restricts the migration
+func (f *FilterConfig) Active() bool {
+	return len(f.IncludeNamespaces) > 0 || len(f.ExcludeNamespaces) > 0 ||
+		len(f.IncludeProjects) > 0 || len(f.ExcludeProjects) > 0 ||
+		f.IncludeRegex != nil || f.ExcludeRegex != nil ||
+		len(f.Visibility) > 0 || f.Archived != ArchivedInclude ||
+		f.ActiveSince != nil || f.ActiveBefore != nil ||
+		len(f.ProjectList) > 0
+}
+
+// loadFilterConfig loads the selection filters from environment variables
+func loadFilterConfig() (FilterConfig, error) {
+	filter := FilterConfig{
+		IncludeNamespaces: getEnvList("INCLUDE_NAMESPACES"),
+		ExcludeNamespaces: getEnvList("EXCLUDE_NAMESPACES"),
+		IncludeProjects:   getEnvList("INCLUDE_PROJECTS"),
+		ExcludeProjects:   getEnvList("EXCLUDE_PROJECTS"),
+		Visibility:        getEnvList("INCLUDE_VISIBILITY"),
+		Archived:          ArchivedInclude,
+	}
+
+	if err := validateGlobs(append(filter.IncludeProjects, filter.ExcludeProjects...)); err != nil {
+		return filter, err
+	}
+
+	var err error
+	if filter.IncludeRegex, err = getEnvRegexp("INCLUDE_REGEX"); err != nil {
+		return filter, err
+	}
+	if filter.ExcludeRegex, err = getEnvRegexp("EXCLUDE_REGEX"); err != nil {
+		return filter, err
+	}
+
+	if archived := os.Getenv("ARCHIVED_PROJECTS"); archived != "" {
+		switch archived {
+		case ArchivedInclude, ArchivedExclude, ArchivedOnly:
+			filter.Archived = archived
+		default:
+			return filter, fmt.Errorf("ARCHIVED_PROJECTS must be one of %s, %s or %s",
+				ArchivedInclude, ArchivedExclude, ArchivedOnly)
+		}
+	}
+
+	if filter.ActiveSince, err = getEnvTime("ACTIVE_SINCE"); err != nil {
+		return filter, err
+	}
+	if filter.ActiveBefore, err = getEnvTime("ACTIVE_BEFORE"); err != nil {
+		return filter, err
+	}
+
+	if listFile := os.Getenv("PROJECT_LIST_FILE"); listFile != "" {
+		if filter.ProjectList, err = readProjectList(listFile); err != nil {
+			return filter, err
+		}
+	}
+
+	return filter, nil
+}
+
+// readProjectList reads project paths from a file, one per line. Blank lines
+// and lines starting with # are ignored.
+func readProjectList(filePath string) ([]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open project list file: %w", err)
+	}
+	defer file.Close()
+
+	var projects []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		projects = append(projects, strings.Trim(line, "/"))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading project list file: %w", err)
+	}
+
+	if len(projects) == 0 {
+		return nil, fmt.Errorf("project list file %s contains no projects", filePath)
+	}
+
+	return projects, nil
+}
+
+// getEnvList reads a comma-separated environment variable into a list of trimmed values
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvRegexp reads and compiles a regular expression environment variable
+func getEnvRegexp(key string) (*regexp.Regexp, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a valid regular expression: %w", key, err)
+	}
+	return re, nil
+}
+
+// getEnvTime reads a date (YYYY-MM-DD) or RFC 3339 timestamp environment variable
+func getEnvTime(key string) (*time.Time, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("%s must be a date (YYYY-MM-DD) or RFC 3339 timestamp", key)
+}
+
+// GlobMatchesAny reports whether a project path matches any of the given glob patterns
+func GlobMatchesAny(patterns []string, projectPath string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, projectPath); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// validateGlobs checks that every project path glob is well-formed
+func validateGlobs(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid project glob %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
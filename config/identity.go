@@ -0,0 +1,71 @@
+// identity.go
+
+// Package config handles application configuration through environment variables
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// identityKinds are the kinds of GitLab entities whose Gitea names can be overridden
+var identityKinds = map[string]bool{"user": true, "group": true, "project": true}
+
+// IdentityOverrideKey returns the key of an override for a GitLab user, group or project.
+// GitLab paths are matched without regard to case.
+func IdentityOverrideKey(kind, path string) string {
+	return kind + ":" + strings.ToLower(strings.Trim(path, "/"))
+}
+
+// readIdentityOverrides reads the Gitea names of renamed GitLab entities from a file.
+// Each line holds a kind (user, group or project), the GitLab path (username, full
+// group path or project path with namespace) and the Gitea name, separated by spaces.
+// Projects are only renamed within their owner. Blank lines and lines starting with #
+// are ignored.
+func readIdentityOverrides(filePath string) (map[string]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open identity overrides file: %w", err)
+	}
+	defer file.Close()
+
+	overrides := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("identity overrides file %s, line %d: expected kind, GitLab path and Gitea name",
+				filePath, lineNumber)
+		}
+
+		kind, path, name := strings.ToLower(fields[0]), fields[1], fields[2]
+		if !identityKinds[kind] {
+			return nil, fmt.Errorf("identity overrides file %s, line %d: unknown kind %q, must be user, group or project",
+				filePath, lineNumber, fields[0])
+		}
+		if strings.Contains(name, "/") {
+			return nil, fmt.Errorf("identity overrides file %s, line %d: Gitea name %q must not contain a slash",
+				filePath, lineNumber, name)
+		}
+
+		key := IdentityOverrideKey(kind, path)
+		if _, exists := overrides[key]; exists {
+			return nil, fmt.Errorf("identity overrides file %s, line %d: %s %s is overridden twice",
+				filePath, lineNumber, kind, path)
+		}
+		overrides[key] = name
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading identity overrides file: %w", err)
+	}
+
+	return overrides, nil
+}
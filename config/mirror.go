@@ -0,0 +1,83 @@
+// mirror.go
+
+// Package config handles application configuration through environment variables
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Repository modes
+const (
+	RepositoryModeImport = "import" // one-time copy of the repository
+	RepositoryModeMirror = "mirror" // Gitea pull mirror that keeps following GitLab
+)
+
+// MirrorConfig selects the projects whose repositories become Gitea pull mirrors instead
+// of one-time imports, and how they are mirrored
+type MirrorConfig struct {
+	DefaultMode     string   // mode of projects no list names, one of the RepositoryMode* constants
+	MirrorProjects  []string // project path globs that are mirrored
+	ExcludeProjects []string // project path globs that are imported, even if they match MirrorProjects
+	Interval        string   // time between mirror updates, as a Gitea duration like 8h0m0s
+	AuthUsername    string   // credentials Gitea pulls with
+	AuthPassword    string
+}
+
+// Mirrored reports whether a project, by GitLab path with namespace, is mirrored
+func (c *MirrorConfig) Mirrored(projectPath string) bool {
+	if GlobMatchesAny(c.ExcludeProjects, projectPath) {
+		return false
+	}
+	if GlobMatchesAny(c.MirrorProjects, projectPath) {
+		return true
+	}
+	return c.DefaultMode == RepositoryModeMirror
+}
+
+// loadMirrorConfig loads the mirror settings from environment variables. Without
+// credentials of its own, a mirror pulls with the GitLab admin account.
+func loadMirrorConfig(adminUser, adminPass string) (MirrorConfig, error) {
+	mirror := MirrorConfig{
+		DefaultMode:     os.Getenv("REPOSITORY_MODE"),
+		MirrorProjects:  getEnvList("MIRROR_PROJECTS"),
+		ExcludeProjects: getEnvList("MIRROR_EXCLUDE_PROJECTS"),
+		Interval:        os.Getenv("MIRROR_INTERVAL"),
+		AuthUsername:    os.Getenv("MIRROR_AUTH_USERNAME"),
+		AuthPassword:    os.Getenv("MIRROR_AUTH_PASSWORD"),
+	}
+
+	switch mirror.DefaultMode {
+	case "":
+		mirror.DefaultMode = RepositoryModeImport
+	case RepositoryModeImport, RepositoryModeMirror:
+	default:
+		return mirror, fmt.Errorf("REPOSITORY_MODE must be %s or %s", RepositoryModeImport, RepositoryModeMirror)
+	}
+
+	if err := validateGlobs(append(mirror.MirrorProjects, mirror.ExcludeProjects...)); err != nil {
+		return mirror, err
+	}
+
+	if mirror.Interval != "" {
+		if _, err := time.ParseDuration(mirror.Interval); err != nil {
+			return mirror, fmt.Errorf("MIRROR_INTERVAL must be a duration like 8h0m0s: %w", err)
+		}
+	}
+
+	// A GitLab access token is sent as the password of any user name
+	if token := os.Getenv("MIRROR_AUTH_TOKEN"); token != "" {
+		if mirror.AuthUsername == "" {
+			mirror.AuthUsername = "oauth2"
+		}
+		mirror.AuthPassword = token
+	}
+	if mirror.AuthUsername == "" && mirror.AuthPassword == "" {
+		mirror.AuthUsername = adminUser
+		mirror.AuthPassword = adminPass
+	}
+
+	return mirror, nil
+}
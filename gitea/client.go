@@ -13,13 +13,18 @@ import (
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/go-i2p/gitlab-to-gitea/utils"
 )
 
 // Client handles communication with the Gitea API
 type Client struct {
 	baseURL    *url.URL
 	httpClient *http.Client
+	limiter    *utils.HostLimiter
+	retry      *utils.RetryTransport
 	token      string
+	sudo       string // user the admin token acts as, if any
 }
 
 // VersionResponse represents the Gitea version response
@@ -28,20 +33,21 @@ type VersionResponse struct {
 }
 
 // SearchResponse represents the structure of Gitea search responses
-type SearchResponse struct {
-	Data  []map[string]interface{} `json:"data"`
-	OK    bool                     `json:"ok"`
-	Total int                      `json:"total_count"`
+type SearchResponse[T any] struct {
+	Data []*T `json:"data"`
+	OK   bool `json:"ok"`
 }
 
-// SearchRepositories searches for repositories and returns the results
-func (c *Client) SearchRepositories() ([]map[string]interface{}, error) {
-	var response SearchResponse
-	err := c.Get("repos/search?limit=1000", &response)
-	if err != nil {
-		return nil, err
-	}
-	return response.Data, nil
+// SearchRepositories returns every repository visible to the authenticated user
+func (c *Client) SearchRepositories() ([]*Repository, error) {
+	pager := newPager(c, "repos/search", func(raw json.RawMessage) ([]*Repository, error) {
+		var response SearchResponse[Repository]
+		if err := json.Unmarshal(raw, &response); err != nil {
+			return nil, err
+		}
+		return response.Data, nil
+	})
+	return pager.All()
 }
 
 // FetchCSRFToken retrieves a CSRF token from Gitea
@@ -76,18 +82,49 @@ func NewClient(baseURL, token string) (*Client, error) {
 		return nil, fmt.Errorf("invalid URL: %w", err)
 	}
 
+	limiter := utils.NewHostLimiter(&http.Transport{
+		Dial: Dial,
+	}, 0)
+	retry := utils.NewRetryTransport(limiter)
+
 	return &Client{
 		baseURL: u,
 		httpClient: &http.Client{
-			Timeout: 360 * time.Second,
-			Transport: &http.Transport{
-				Dial: Dial,
-			},
+			Timeout:   360 * time.Second,
+			Transport: retry,
 		},
-		token: token,
+		limiter: limiter,
+		retry:   retry,
+		token:   token,
 	}, nil
 }
 
+// SetMaxConcurrency limits the number of requests in flight to the Gitea host.
+// A value of 0 or less removes the limit.
+func (c *Client) SetMaxConcurrency(n int) {
+	c.limiter.SetLimit(n)
+}
+
+// SetRetryPolicy changes how failed requests to Gitea are retried
+func (c *Client) SetRetryPolicy(policy utils.RetryPolicy) {
+	c.retry.SetPolicy(policy)
+}
+
+// SetRateLimit caps the number of requests sent to Gitea per second.
+// A value of 0 or less removes the cap.
+func (c *Client) SetRateLimit(requestsPerSecond float64) {
+	c.retry.SetRateLimit(requestsPerSecond)
+}
+
+// Sudo returns a client that performs every request as the given user. Gitea only
+// honours this for admin tokens. The returned client shares the connection pool,
+// limits and retry policy of c.
+func (c *Client) Sudo(username string) *Client {
+	sudo := *c
+	sudo.sudo = username
+	return &sudo
+}
+
 // Add a custom transport to handle CSRF tokens
 type CSRFTokenTransport struct {
 	Token     string
@@ -150,6 +187,21 @@ func (c *Client) Delete(path string) error {
 
 // request sends an HTTP request to the Gitea API
 func (c *Client) request(method, path string, data, result interface{}) (*http.Response, error) {
+	var body *bytes.Buffer
+	if data != nil {
+		jsonData, err := json.Marshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request body: %w", err)
+		}
+		body = bytes.NewBuffer(jsonData)
+	}
+
+	return c.send(method, path, body, "application/json", result)
+}
+
+// send sends a request with an already encoded body to the Gitea API and decodes the
+// JSON response into result
+func (c *Client) send(method, path string, body *bytes.Buffer, contentType string, result interface{}) (*http.Response, error) {
 	// Normalize path - remove leading slash if present
 	path = strings.TrimPrefix(path, "/")
 
@@ -164,24 +216,24 @@ func (c *Client) request(method, path string, data, result interface{}) (*http.R
 	// Debug output to see what endpoint is being called
 	// utils.PrintInfo(fmt.Sprintf("Making %s request to: %s", method, fullURL))
 
-	var body io.Reader
-	if data != nil {
-		jsonData, err := json.Marshal(data)
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal request body: %w", err)
-		}
-		body = bytes.NewBuffer(jsonData)
+	// A nil *bytes.Buffer must not become a non-nil io.Reader
+	var reader io.Reader
+	if body != nil {
+		reader = body
 	}
 
-	req, err := http.NewRequest(method, fullURL, body)
+	req, err := http.NewRequest(method, fullURL, reader)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set headers
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", contentType)
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Authorization", fmt.Sprintf("token %s", c.token))
+	if c.sudo != "" {
+		req.Header.Set("Sudo", c.sudo)
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -197,7 +249,7 @@ func (c *Client) request(method, path string, data, result interface{}) (*http.R
 
 	// Handle error status codes
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return resp, fmt.Errorf("API returned error: %s - %s", resp.Status, string(bodyBytes))
+		return resp, newAPIError(method, "/"+path, resp.StatusCode, bodyBytes)
 	}
 
 	if result != nil && len(bodyBytes) > 0 {
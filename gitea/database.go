@@ -0,0 +1,150 @@
+// database.go
+
+// Package gitea provides a client for interacting with the Gitea API
+package gitea
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/go-i2p/gitlab-to-gitea/utils"
+)
+
+// Database gives direct access to the Gitea database, for changes the API does not offer
+// such as setting the creation time of issues and comments. Gitea should be stopped or
+// idle while it is written to.
+type Database struct {
+	db *sql.DB
+}
+
+// OpenDatabase connects to a Gitea database. driver is "sqlite3" with the path of gitea.db
+// as dsn, or "mysql" with a DSN like user:pass@tcp(host)/gitea. PostgreSQL is not
+// supported, as the queries use ? placeholders.
+func OpenDatabase(driver, dsn string) (*Database, error) {
+	switch driver {
+	case "sqlite3", "mysql":
+	default:
+		return nil, fmt.Errorf("unsupported database type %q", driver)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	return &Database{db: db}, nil
+}
+
+// Close closes the database connection
+func (d *Database) Close() error {
+	return d.db.Close()
+}
+
+// SetIssueTimes sets the creation, update and close times of an issue or pull request
+func (d *Database) SetIssueTimes(id int64, created, updated time.Time, closed *time.Time) error {
+	return d.exec("UPDATE issue SET created_unix = ?, updated_unix = ?, closed_unix = ? WHERE id = ?",
+		created.Unix(), updated.Unix(), unixOrZero(closed), id)
+}
+
+// SetCommentTimes sets the creation and update times of a comment
+func (d *Database) SetCommentTimes(id int64, created, updated time.Time) error {
+	return d.exec("UPDATE comment SET created_unix = ?, updated_unix = ? WHERE id = ?",
+		created.Unix(), updated.Unix(), id)
+}
+
+// SetMilestoneTimes sets the creation, update and close times of a milestone
+func (d *Database) SetMilestoneTimes(id int64, created, updated time.Time, closed *time.Time) error {
+	return d.exec("UPDATE milestone SET created_unix = ?, updated_unix = ?, closed_date_unix = ? WHERE id = ?",
+		created.Unix(), updated.Unix(), unixOrZero(closed), id)
+}
+
+// SetReleaseTime sets the creation time of a release, which Gitea shows as its publication date
+func (d *Database) SetReleaseTime(id int64, created time.Time) error {
+	return d.exec("UPDATE `release` SET created_unix = ? WHERE id = ?", created.Unix(), id)
+}
+
+// ConvertMirror turns a pull mirror into a regular repository, as the convert action of
+// the repository settings does: the origin remote, which holds the credentials the mirror
+// pulled with, is removed from the repository and its wiki, the original URL is cleared,
+// and the mirror settings are deleted. repoPath is the path of the bare repository below
+// the repository root of Gitea. The git hooks Gitea needs to see pushes are not created;
+// the resync_all_hooks cron task does that.
+func (d *Database) ConvertMirror(repoID int64, repoPath string) error {
+	if err := removeOriginRemote(repoPath); err != nil {
+		return err
+	}
+	wikiPath := strings.TrimSuffix(repoPath, ".git") + ".wiki.git"
+	if _, err := os.Stat(wikiPath); err == nil {
+		if err := removeOriginRemote(wikiPath); err != nil {
+			return err
+		}
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE repository SET is_mirror = ?, original_url = ? WHERE id = ?", false, "", repoID); err != nil {
+		return fmt.Errorf("failed to update database: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM mirror WHERE repo_id = ?", repoID); err != nil {
+		return fmt.Errorf("failed to update database: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RepositoryPath returns the path of the bare repository of owner/repo below the
+// repository root of Gitea, which stores both in lower case
+func RepositoryPath(root, owner, repo string) string {
+	return filepath.Join(root, strings.ToLower(owner), strings.ToLower(repo)+".git")
+}
+
+// removeOriginRemote removes the origin remote of a bare repository, if it has one
+func removeOriginRemote(repoPath string) error {
+	remotes, err := utils.RunGit(repoPath, nil, nil, "remote")
+	if err != nil {
+		return fmt.Errorf("failed to list remotes of %s: %w", repoPath, err)
+	}
+	for _, remote := range strings.Fields(string(remotes)) {
+		if remote != "origin" {
+			continue
+		}
+		if _, err := utils.RunGit(repoPath, nil, nil, "remote", "rm", "origin"); err != nil {
+			return fmt.Errorf("failed to remove origin remote of %s: %w", repoPath, err)
+		}
+	}
+	return nil
+}
+
+// exec runs an update statement
+func (d *Database) exec(query string, args ...interface{}) error {
+	if _, err := d.db.Exec(query, args...); err != nil {
+		return fmt.Errorf("failed to update database: %w", err)
+	}
+	return nil
+}
+
+// unixOrZero returns the Unix time of t, or 0 for nil, which Gitea stores for unset times
+func unixOrZero(t *time.Time) int64 {
+	if t == nil {
+		return 0
+	}
+	return t.Unix()
+}
@@ -0,0 +1,266 @@
+// dump.go
+
+// Package gitea provides a client for interacting with the Gitea API
+package gitea
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/go-i2p/gitlab-to-gitea/utils"
+)
+
+// GitServiceGitLab identifies GitLab as the origin of a repository dump, which lets Gitea
+// link posters to users who signed in with the same GitLab account
+const GitServiceGitLab = 4
+
+// DumpRepository is the repo.yml of a repository dump
+type DumpRepository struct {
+	Name          string `yaml:"name"`
+	Owner         string `yaml:"owner"`
+	Description   string `yaml:"description"`
+	CloneAddr     string `yaml:"clone_addr"`
+	OriginalURL   string `yaml:"original_url"`
+	DefaultBranch string `yaml:"default_branch"`
+	IsPrivate     bool   `yaml:"is_private"`
+	ServiceType   int    `yaml:"service_type"`
+	Wiki          bool   `yaml:"wiki"`
+	Issues        bool   `yaml:"issues"`
+	Milestones    bool   `yaml:"milestones"`
+	Labels        bool   `yaml:"labels"`
+	Releases      bool   `yaml:"releases"`
+	Comments      bool   `yaml:"comments"`
+	Pulls         bool   `yaml:"pulls"`
+	Assets        bool   `yaml:"assets"`
+}
+
+// DumpLabel is a label in label.yml and on issues and pull requests
+type DumpLabel struct {
+	Name        string `yaml:"name"`
+	Color       string `yaml:"color"` // hex without the leading #
+	Description string `yaml:"description"`
+}
+
+// DumpMilestone is a milestone in milestone.yml
+type DumpMilestone struct {
+	Title       string     `yaml:"title"`
+	Description string     `yaml:"description"`
+	Deadline    *time.Time `yaml:"deadline"`
+	Created     time.Time  `yaml:"created"`
+	Updated     *time.Time `yaml:"updated"`
+	Closed      *time.Time `yaml:"closed"`
+	State       string     `yaml:"state"` // open or closed
+}
+
+// DumpIssue is an issue in issue.yml
+type DumpIssue struct {
+	Number       int64        `yaml:"number"`
+	PosterID     int64        `yaml:"poster_id"`
+	PosterName   string       `yaml:"poster_name"`
+	PosterEmail  string       `yaml:"poster_email"`
+	Title        string       `yaml:"title"`
+	Content      string       `yaml:"content"`
+	Milestone    string       `yaml:"milestone"`
+	State        string       `yaml:"state"` // open or closed
+	IsLocked     bool         `yaml:"is_locked"`
+	Created      time.Time    `yaml:"created"`
+	Updated      time.Time    `yaml:"updated"`
+	Closed       *time.Time   `yaml:"closed"`
+	Labels       []*DumpLabel `yaml:"labels"`
+	Assignees    []string     `yaml:"assignees"`
+	ForeignIndex int64        `yaml:"foreign_index"`
+}
+
+// DumpComment is a comment in comments/<issue number>.yml
+type DumpComment struct {
+	IssueIndex  int64     `yaml:"issue_index"`
+	Index       int64     `yaml:"index"`
+	CommentType string    `yaml:"comment_type"`
+	PosterID    int64     `yaml:"poster_id"`
+	PosterName  string    `yaml:"poster_name"`
+	PosterEmail string    `yaml:"poster_email"`
+	Created     time.Time `yaml:"created"`
+	Updated     time.Time `yaml:"updated"`
+	Content     string    `yaml:"content"`
+}
+
+// DumpPullRequestBranch is the head or base of a pull request in a repository dump
+type DumpPullRequestBranch struct {
+	CloneURL  string `yaml:"clone_url"`
+	Ref       string `yaml:"ref"`
+	SHA       string `yaml:"sha"`
+	RepoName  string `yaml:"repo_name"`
+	OwnerName string `yaml:"owner_name"`
+}
+
+// DumpPullRequest is a pull request in pull_request.yml
+type DumpPullRequest struct {
+	Number         int64                 `yaml:"number"`
+	Title          string                `yaml:"title"`
+	PosterName     string                `yaml:"poster_name"`
+	PosterID       int64                 `yaml:"poster_id"`
+	PosterEmail    string                `yaml:"poster_email"`
+	Content        string                `yaml:"content"`
+	Milestone      string                `yaml:"milestone"`
+	State          string                `yaml:"state"` // open or closed
+	Created        time.Time             `yaml:"created"`
+	Updated        time.Time             `yaml:"updated"`
+	Closed         *time.Time            `yaml:"closed"`
+	Labels         []*DumpLabel          `yaml:"labels"`
+	PatchURL       string                `yaml:"patch_url"`
+	Merged         bool                  `yaml:"merged"`
+	MergedTime     *time.Time            `yaml:"merged_time"`
+	MergeCommitSHA string                `yaml:"merge_commit_sha"`
+	Head           DumpPullRequestBranch `yaml:"head"`
+	Base           DumpPullRequestBranch `yaml:"base"`
+	Assignees      []string              `yaml:"assignees"`
+	IsLocked       bool                  `yaml:"is_locked"`
+	ForeignIndex   int64                 `yaml:"foreign_index"`
+}
+
+// DumpReleaseAsset is an attachment of a release in release.yml. DownloadURL is the path
+// of its file in the dump, relative to the dump directory.
+type DumpReleaseAsset struct {
+	ID          int64     `yaml:"id"`
+	Name        string    `yaml:"name"`
+	Size        *int      `yaml:"size"`
+	Created     time.Time `yaml:"created"`
+	Updated     time.Time `yaml:"updated"`
+	DownloadURL *string   `yaml:"download_url"`
+}
+
+// DumpRelease is a release in release.yml
+type DumpRelease struct {
+	TagName         string              `yaml:"tag_name"`
+	TargetCommitish string              `yaml:"target_commitish"`
+	Name            string              `yaml:"name"`
+	Body            string              `yaml:"body"`
+	Draft           bool                `yaml:"draft"`
+	Prerelease      bool                `yaml:"prerelease"`
+	PublisherID     int64               `yaml:"publisher_id"`
+	PublisherName   string              `yaml:"publisher_name"`
+	PublisherEmail  string              `yaml:"publisher_email"`
+	Assets          []*DumpReleaseAsset `yaml:"assets"`
+	Created         time.Time           `yaml:"created"`
+	Published       time.Time           `yaml:"published"`
+}
+
+// Dumper writes a repository in the directory layout of `gitea dump-repo`, so that it
+// can be loaded with `gitea restore-repo --repo_dir <dir> --owner_name <owner> --repo_name <repo>`
+type Dumper struct {
+	dir string
+}
+
+// NewDumper creates the dump directory of a repository below baseDir
+func NewDumper(baseDir, owner, repo string) (*Dumper, error) {
+	dir := filepath.Join(baseDir, owner, repo)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create dump directory: %w", err)
+	}
+	return &Dumper{dir: dir}, nil
+}
+
+// Dir returns the dump directory of the repository
+func (d *Dumper) Dir() string {
+	return d.dir
+}
+
+// Complete reports whether repo.yml was written, which happens last
+func (d *Dumper) Complete() bool {
+	_, err := os.Stat(filepath.Join(d.dir, "repo.yml"))
+	return err == nil
+}
+
+// MirrorGit clones the repository with all its refs into the git directory of the dump
+func (d *Dumper) MirrorGit(cloneURL string, auth []utils.GitAuth) error {
+	gitDir := filepath.Join(d.dir, "git")
+	if err := os.RemoveAll(gitDir); err != nil {
+		return fmt.Errorf("failed to remove old git directory: %w", err)
+	}
+
+	_, err := utils.RunGit("", auth, nil, "clone", "--mirror", "--quiet", cloneURL, gitDir)
+	return err
+}
+
+// MergeBase returns the best common ancestor of two commits in the mirrored repository
+func (d *Dumper) MergeBase(a, b string) (string, error) {
+	output, err := utils.RunGit(filepath.Join(d.dir, "git"), nil, nil, "merge-base", a, b)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// WriteRepo writes repo.yml
+func (d *Dumper) WriteRepo(repo *DumpRepository) error {
+	return d.writeYAML("repo.yml", repo)
+}
+
+// WriteTopics writes topic.yml
+func (d *Dumper) WriteTopics(topics []string) error {
+	return d.writeYAML("topic.yml", map[string][]string{"topics": topics})
+}
+
+// WriteLabels writes label.yml
+func (d *Dumper) WriteLabels(labels []*DumpLabel) error {
+	return d.writeYAML("label.yml", labels)
+}
+
+// WriteMilestones writes milestone.yml
+func (d *Dumper) WriteMilestones(milestones []*DumpMilestone) error {
+	return d.writeYAML("milestone.yml", milestones)
+}
+
+// WriteIssues writes issue.yml
+func (d *Dumper) WriteIssues(issues []*DumpIssue) error {
+	return d.writeYAML("issue.yml", issues)
+}
+
+// WriteComments writes the comments of an issue or pull request
+func (d *Dumper) WriteComments(number int64, comments []*DumpComment) error {
+	if err := os.MkdirAll(filepath.Join(d.dir, "comments"), 0o755); err != nil {
+		return fmt.Errorf("failed to create comments directory: %w", err)
+	}
+	return d.writeYAML(filepath.Join("comments", fmt.Sprintf("%d.yml", number)), comments)
+}
+
+// WritePullRequests writes pull_request.yml
+func (d *Dumper) WritePullRequests(pulls []*DumpPullRequest) error {
+	return d.writeYAML("pull_request.yml", pulls)
+}
+
+// WriteReleases writes release.yml
+func (d *Dumper) WriteReleases(releases []*DumpRelease) error {
+	return d.writeYAML("release.yml", releases)
+}
+
+// WriteReleaseAsset writes the file of a release asset and returns its path in the dump,
+// which is the DownloadURL of the asset
+func (d *Dumper) WriteReleaseAsset(tagName, name string, content []byte) (string, error) {
+	dir := filepath.Join("release_assets", tagName)
+	if err := os.MkdirAll(filepath.Join(d.dir, dir), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create release assets directory: %w", err)
+	}
+	assetPath := filepath.Join(dir, name)
+	if err := os.WriteFile(filepath.Join(d.dir, assetPath), content, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write release asset %s: %w", name, err)
+	}
+	return assetPath, nil
+}
+
+// writeYAML marshals v into a file of the dump
+func (d *Dumper) writeYAML(name string, v interface{}) error {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", name, err)
+	}
+	if err := os.WriteFile(filepath.Join(d.dir, name), data, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// errors.go
+
+// Package gitea provides a client for interacting with the Gitea API
+package gitea
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Sentinel errors matched by an APIError of the corresponding status, for use with errors.Is
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrConflict  = errors.New("conflict")
+	ErrForbidden = errors.New("forbidden")
+)
+
+// APIError is returned by the client when Gitea answers with a non-2xx status
+type APIError struct {
+	StatusCode int
+	Method     string
+	Path       string
+	Message    string // error message decoded from the response, or the raw body
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	status := fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Message == "" {
+		return fmt.Sprintf("%s %s: API returned %s", e.Method, e.Path, status)
+	}
+	return fmt.Sprintf("%s %s: API returned %s: %s", e.Method, e.Path, status, e.Message)
+}
+
+// Is matches the sentinel error for the status code of the response
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	}
+	return false
+}
+
+// newAPIError builds an APIError from a failed response, decoding Gitea's JSON error body when present
+func newAPIError(method, path string, statusCode int, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: statusCode,
+		Method:     method,
+		Path:       path,
+		Message:    strings.TrimSpace(string(body)),
+	}
+
+	var response struct {
+		Message string   `json:"message"`
+		Errors  []string `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &response); err == nil && (response.Message != "" || len(response.Errors) > 0) {
+		apiErr.Message = response.Message
+		if len(response.Errors) > 0 {
+			apiErr.Message = strings.TrimSpace(apiErr.Message + " " + strings.Join(response.Errors, "; "))
+		}
+	}
+
+	return apiErr
+}
+
+// StatusCode returns the HTTP status of an APIError in err's chain, or 0 if there is none
+func StatusCode(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound reports whether err is a 404 response from Gitea
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+// IsConflict reports whether err is Gitea refusing to create something that already exists
+func IsConflict(err error) bool {
+	return errors.Is(err, ErrConflict)
+}
+
+// IsForbidden reports whether err is a 403 response from Gitea
+func IsForbidden(err error) bool {
+	return errors.Is(err, ErrForbidden)
+}
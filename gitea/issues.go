@@ -0,0 +1,246 @@
+// issues.go
+
+// Package gitea provides a client for interacting with the Gitea API
+package gitea
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Issue represents a Gitea issue or the issue side of a pull request
+type Issue struct {
+	ID          int64      `json:"id"`
+	Number      int        `json:"number"`
+	Title       string     `json:"title"`
+	Body        string     `json:"body"`
+	State       string     `json:"state"`
+	User        *User      `json:"user"`
+	Labels      []*Label   `json:"labels"`
+	Milestone   *Milestone `json:"milestone"`
+	Assignees   []*User    `json:"assignees"`
+	Comments    int        `json:"comments"`
+	PullRequest *struct {
+		Merged bool `json:"merged"`
+	} `json:"pull_request"`
+	Created time.Time  `json:"created_at"`
+	Updated time.Time  `json:"updated_at"`
+	Closed  *time.Time `json:"closed_at"`
+}
+
+// Comment represents a comment on a Gitea issue or pull request
+type Comment struct {
+	ID      int64     `json:"id"`
+	Body    string    `json:"body"`
+	User    *User     `json:"user"`
+	Created time.Time `json:"created_at"`
+	Updated time.Time `json:"updated_at"`
+}
+
+// PullRequest represents a Gitea pull request
+type PullRequest struct {
+	ID     int64  `json:"id"`
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+	State  string `json:"state"`
+	User   *User  `json:"user"`
+	Merged bool   `json:"merged"`
+	Head   *struct {
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+	} `json:"head"`
+	Base *struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+}
+
+// ListIssuesOptions selects the issues returned by ListIssues
+type ListIssuesOptions struct {
+	State string // open, closed or all
+	Type  string // issues, pulls, or empty for both
+}
+
+// CreateIssueOption represents the data needed to create an issue in Gitea
+type CreateIssueOption struct {
+	Assignee  string   `json:"assignee,omitempty"`
+	Assignees []string `json:"assignees,omitempty"`
+	Body      string   `json:"body"`
+	Closed    bool     `json:"closed"`
+	DueOn     string   `json:"due_on,omitempty"`
+	Labels    []int64  `json:"labels,omitempty"`
+	Milestone int64    `json:"milestone,omitempty"`
+	Title     string   `json:"title"`
+}
+
+// EditIssueOption represents the data needed to update an issue in Gitea. Empty fields are left unchanged.
+type EditIssueOption struct {
+	Assignees []string `json:"assignees,omitempty"`
+	Body      string   `json:"body,omitempty"`
+	DueDate   string   `json:"due_date,omitempty"`
+	Milestone int64    `json:"milestone,omitempty"`
+	State     string   `json:"state,omitempty"`
+	Title     string   `json:"title,omitempty"`
+}
+
+// IssueLabelsOption represents the labels to add to, or set on, an issue in Gitea
+type IssueLabelsOption struct {
+	Labels []int64 `json:"labels"`
+}
+
+// CreateIssueCommentOption represents the data needed to create a comment in Gitea
+type CreateIssueCommentOption struct {
+	Body string `json:"body"`
+}
+
+// EditIssueCommentOption represents the data needed to update a comment in Gitea
+type EditIssueCommentOption struct {
+	Body string `json:"body"`
+}
+
+// CreatePullRequestOption represents the data needed to create a pull request in Gitea
+type CreatePullRequestOption struct {
+	Assignee  string   `json:"assignee,omitempty"`
+	Assignees []string `json:"assignees,omitempty"`
+	Base      string   `json:"base"`
+	Body      string   `json:"body"`
+	Head      string   `json:"head"`
+	Labels    []int64  `json:"labels,omitempty"`
+	Milestone int64    `json:"milestone,omitempty"`
+	Title     string   `json:"title"`
+}
+
+// EditPullRequestOption represents the data needed to change the state of a pull request in Gitea
+type EditPullRequestOption struct {
+	State string `json:"state"`
+}
+
+// ListIssues lists the issues and pull requests of a repository
+func (c *Client) ListIssues(owner, repo string, opt ListIssuesOptions) ([]*Issue, error) {
+	query := url.Values{}
+	if opt.State != "" {
+		query.Set("state", opt.State)
+	}
+	if opt.Type != "" {
+		query.Set("type", opt.Type)
+	}
+
+	path := fmt.Sprintf("/repos/%s/%s/issues", owner, repo)
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return listAll[Issue](c, path)
+}
+
+// GetIssue retrieves an issue or pull request by number
+func (c *Client) GetIssue(owner, repo string, number int) (*Issue, error) {
+	issue := &Issue{}
+	if err := c.Get(fmt.Sprintf("/repos/%s/%s/issues/%d", owner, repo, number), issue); err != nil {
+		return nil, err
+	}
+	return issue, nil
+}
+
+// CreateIssue creates an issue in a repository
+func (c *Client) CreateIssue(owner, repo string, opt CreateIssueOption) (*Issue, error) {
+	issue := &Issue{}
+	if err := c.Post(fmt.Sprintf("/repos/%s/%s/issues", owner, repo), opt, issue); err != nil {
+		return nil, err
+	}
+	return issue, nil
+}
+
+// EditIssue updates an issue or the issue side of a pull request
+func (c *Client) EditIssue(owner, repo string, number int, opt EditIssueOption) (*Issue, error) {
+	issue := &Issue{}
+	if err := c.Patch(fmt.Sprintf("/repos/%s/%s/issues/%d", owner, repo, number), opt, issue); err != nil {
+		return nil, err
+	}
+	return issue, nil
+}
+
+// AddIssueLabels adds labels to an issue or pull request
+func (c *Client) AddIssueLabels(owner, repo string, number int, opt IssueLabelsOption) ([]*Label, error) {
+	var labels []*Label
+	if err := c.Post(fmt.Sprintf("/repos/%s/%s/issues/%d/labels", owner, repo, number), opt, &labels); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// ReplaceIssueLabels replaces the labels of an issue or pull request
+func (c *Client) ReplaceIssueLabels(owner, repo string, number int, opt IssueLabelsOption) ([]*Label, error) {
+	var labels []*Label
+	if err := c.Put(fmt.Sprintf("/repos/%s/%s/issues/%d/labels", owner, repo, number), opt, &labels); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// ListIssueComments lists the comments of an issue or pull request
+func (c *Client) ListIssueComments(owner, repo string, number int) ([]*Comment, error) {
+	return listAll[Comment](c, fmt.Sprintf("/repos/%s/%s/issues/%d/comments", owner, repo, number))
+}
+
+// GetIssueComment retrieves a comment by ID
+func (c *Client) GetIssueComment(owner, repo string, id int64) (*Comment, error) {
+	comment := &Comment{}
+	if err := c.Get(fmt.Sprintf("/repos/%s/%s/issues/comments/%d", owner, repo, id), comment); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// CreateIssueComment adds a comment to an issue or pull request
+func (c *Client) CreateIssueComment(owner, repo string, number int, opt CreateIssueCommentOption) (*Comment, error) {
+	comment := &Comment{}
+	if err := c.Post(fmt.Sprintf("/repos/%s/%s/issues/%d/comments", owner, repo, number), opt, comment); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// EditIssueComment updates a comment
+func (c *Client) EditIssueComment(owner, repo string, id int64, opt EditIssueCommentOption) (*Comment, error) {
+	comment := &Comment{}
+	if err := c.Patch(fmt.Sprintf("/repos/%s/%s/issues/comments/%d", owner, repo, id), opt, comment); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// CreateIssueAttachment uploads a file to an issue or pull request
+func (c *Client) CreateIssueAttachment(owner, repo string, number int, name string, content []byte) (*Attachment, error) {
+	path := fmt.Sprintf("/repos/%s/%s/issues/%d/assets?name=%s", owner, repo, number, url.QueryEscape(name))
+	return c.uploadAttachment(path, name, content)
+}
+
+// CreateCommentAttachment uploads a file to a comment
+func (c *Client) CreateCommentAttachment(owner, repo string, id int64, name string, content []byte) (*Attachment, error) {
+	path := fmt.Sprintf("/repos/%s/%s/issues/comments/%d/assets?name=%s", owner, repo, id, url.QueryEscape(name))
+	return c.uploadAttachment(path, name, content)
+}
+
+// ListPullRequests lists the open and closed pull requests of a repository
+func (c *Client) ListPullRequests(owner, repo string) ([]*PullRequest, error) {
+	return listAll[PullRequest](c, fmt.Sprintf("/repos/%s/%s/pulls?state=all", owner, repo))
+}
+
+// CreatePullRequest creates a pull request in a repository
+func (c *Client) CreatePullRequest(owner, repo string, opt CreatePullRequestOption) (*PullRequest, error) {
+	pr := &PullRequest{}
+	if err := c.Post(fmt.Sprintf("/repos/%s/%s/pulls", owner, repo), opt, pr); err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
+// EditPullRequest updates a pull request
+func (c *Client) EditPullRequest(owner, repo string, number int, opt EditPullRequestOption) (*PullRequest, error) {
+	pr := &PullRequest{}
+	if err := c.Patch(fmt.Sprintf("/repos/%s/%s/pulls/%d", owner, repo, number), opt, pr); err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
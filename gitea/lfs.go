@@ -0,0 +1,115 @@
+// lfs.go
+
+// Package gitea provides a client for interacting with the Gitea API
+package gitea
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// lfsMediaType is the media type of the Git LFS batch API
+const lfsMediaType = "application/vnd.git-lfs+json"
+
+// lfsBatchSize is the number of objects asked about per batch request
+const lfsBatchSize = 100
+
+// LFSObject identifies a Git LFS object by the OID and size its pointer file records
+type LFSObject struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+// lfsBatchRequest is the body of a Git LFS batch request
+type lfsBatchRequest struct {
+	Operation string      `json:"operation"`
+	Transfers []string    `json:"transfers"`
+	Objects   []LFSObject `json:"objects"`
+}
+
+// lfsBatchResponse is the answer to a Git LFS batch request. Objects the server cannot
+// provide carry an error instead of actions.
+type lfsBatchResponse struct {
+	Objects []struct {
+		LFSObject
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	} `json:"objects"`
+}
+
+// MissingLFSObjects asks the LFS server of a repository for the given objects and returns
+// those it has no content for
+func (c *Client) MissingLFSObjects(owner, repo string, objects []LFSObject) ([]LFSObject, error) {
+	var missing []LFSObject
+	for start := 0; start < len(objects); start += lfsBatchSize {
+		end := min(start+lfsBatchSize, len(objects))
+
+		response, err := c.lfsBatch(owner, repo, objects[start:end])
+		if err != nil {
+			return nil, err
+		}
+
+		found := make(map[string]bool, len(response.Objects))
+		for _, object := range response.Objects {
+			if object.Error == nil {
+				found[object.OID] = true
+			}
+		}
+		for _, object := range objects[start:end] {
+			if !found[object.OID] {
+				missing = append(missing, object)
+			}
+		}
+	}
+	return missing, nil
+}
+
+// lfsBatch sends a download batch request to the LFS server of a repository, which is
+// served next to the git repository rather than under the API
+func (c *Client) lfsBatch(owner, repo string, objects []LFSObject) (*lfsBatchResponse, error) {
+	data, err := json.Marshal(lfsBatchRequest{
+		Operation: "download",
+		Transfers: []string{"basic"},
+		Objects:   objects,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	path := fmt.Sprintf("/%s/%s.git/info/lfs/objects/batch", owner, repo)
+	fullURL := strings.TrimSuffix(c.baseURL.String(), "/") + path
+
+	req, err := http.NewRequest("POST", fullURL, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", lfsMediaType)
+	req.Header.Set("Accept", lfsMediaType)
+	req.SetBasicAuth(c.token, "x-oauth-basic")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, newAPIError("POST", path, resp.StatusCode, body)
+	}
+
+	response := &lfsBatchResponse{}
+	if err := json.Unmarshal(body, response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return response, nil
+}
@@ -0,0 +1,97 @@
+// orgs.go
+
+// Package gitea provides a client for interacting with the Gitea API
+package gitea
+
+import (
+	"fmt"
+)
+
+// Organization represents a Gitea organization
+type Organization struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	UserName    string `json:"username"`
+	FullName    string `json:"full_name"`
+	Description string `json:"description"`
+	Website     string `json:"website"`
+	Location    string `json:"location"`
+	Visibility  string `json:"visibility"`
+}
+
+// Team represents a team of a Gitea organization
+type Team struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	Permission string `json:"permission"`
+}
+
+// CreateOrgOption represents the data needed to create an organization in Gitea
+type CreateOrgOption struct {
+	Description string `json:"description"`
+	FullName    string `json:"full_name"`
+	Location    string `json:"location"`
+	Username    string `json:"username"`
+	Website     string `json:"website"`
+}
+
+// GetOrg retrieves an organization by name
+func (c *Client) GetOrg(name string) (*Organization, error) {
+	org := &Organization{}
+	if err := c.Get("/orgs/"+name, org); err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+// CreateOrg creates an organization
+func (c *Client) CreateOrg(opt CreateOrgOption) (*Organization, error) {
+	org := &Organization{}
+	if err := c.Post("/orgs", opt, org); err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+// ListOrgs lists all organizations of the instance
+func (c *Client) ListOrgs() ([]*Organization, error) {
+	return listAll[Organization](c, "/orgs")
+}
+
+// ListOrgTeams lists the teams of an organization
+func (c *Client) ListOrgTeams(org string) ([]*Team, error) {
+	return listAll[Team](c, fmt.Sprintf("/orgs/%s/teams", org))
+}
+
+// ListTeamMembers lists the members of a team
+func (c *Client) ListTeamMembers(teamID int64) ([]*User, error) {
+	return listAll[User](c, fmt.Sprintf("/teams/%d/members", teamID))
+}
+
+// AddTeamMember adds a user to a team
+func (c *Client) AddTeamMember(teamID int64, username string) error {
+	return c.Put(fmt.Sprintf("/teams/%d/members/%s", teamID, username), nil, nil)
+}
+
+// CreateTeamOption represents the data needed to create a team in Gitea
+type CreateTeamOption struct {
+	Name                    string   `json:"name"`
+	Description             string   `json:"description"`
+	Permission              string   `json:"permission"`
+	Units                   []string `json:"units"`
+	IncludesAllRepositories bool     `json:"includes_all_repositories"`
+}
+
+// CreateTeam creates a team in an organization
+func (c *Client) CreateTeam(org string, opt CreateTeamOption) (*Team, error) {
+	team := &Team{}
+	if err := c.Post(fmt.Sprintf("/orgs/%s/teams", org), opt, team); err != nil {
+		return nil, err
+	}
+	return team, nil
+}
+
+// AddTeamRepository gives a team access to a repository of its organization
+func (c *Client) AddTeamRepository(teamID int64, org, repo string) error {
+	return c.Put(fmt.Sprintf("/teams/%d/repos/%s/%s", teamID, org, repo), nil, nil)
+}
@@ -0,0 +1,178 @@
+// pagination.go
+
+// Package gitea provides a client for interacting with the Gitea API
+package gitea
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// defaultPageSize is the number of items requested per page of a list endpoint
+const defaultPageSize = 50
+
+// linkNextRegex extracts the URL of the next page from a Link header
+var linkNextRegex = regexp.MustCompile(`<([^>]+)>\s*;\s*rel="next"`)
+
+// Pager iterates over the pages of a Gitea list endpoint. The next page is taken from the
+// Link header when Gitea sends one; otherwise paging continues until X-Total-Count items
+// were read or a page comes back short.
+type Pager[T any] struct {
+	client  *Client
+	next    string
+	total   int
+	fetched int
+	decode  func(raw json.RawMessage) ([]*T, error)
+}
+
+// NewPager creates a pager over a list endpoint that returns a JSON array
+func NewPager[T any](c *Client, path string) *Pager[T] {
+	return newPager(c, path, func(raw json.RawMessage) ([]*T, error) {
+		var items []*T
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil, err
+		}
+		return items, nil
+	})
+}
+
+// newPager creates a pager that decodes each page with the given function
+func newPager[T any](c *Client, path string, decode func(raw json.RawMessage) ([]*T, error)) *Pager[T] {
+	return &Pager[T]{
+		client: c,
+		next:   pagePath(path, 1),
+		total:  -1,
+		decode: decode,
+	}
+}
+
+// HasNext reports whether another page is available
+func (p *Pager[T]) HasNext() bool {
+	return p.next != ""
+}
+
+// Total returns the total number of items reported by Gitea, or -1 if unknown
+func (p *Pager[T]) Total() int {
+	return p.total
+}
+
+// Next fetches the next page of items
+func (p *Pager[T]) Next() ([]*T, error) {
+	if p.next == "" {
+		return nil, nil
+	}
+
+	current := p.next
+	p.next = ""
+
+	var raw json.RawMessage
+	resp, err := p.client.request("GET", current, nil, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []*T
+	if len(raw) > 0 {
+		items, err = p.decode(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode page: %w", err)
+		}
+	}
+	p.fetched += len(items)
+
+	if total, err := strconv.Atoi(resp.Header.Get("X-Total-Count")); err == nil {
+		p.total = total
+	}
+
+	if len(items) == 0 {
+		return items, nil
+	}
+
+	if next := nextPageFromLink(resp.Header); next != "" {
+		if next != current {
+			p.next = next
+		}
+		return items, nil
+	}
+
+	page, _ := strconv.Atoi(pageQuery(current, "page"))
+	limit, _ := strconv.Atoi(pageQuery(current, "limit"))
+	switch {
+	case p.total >= 0 && p.fetched < p.total:
+		p.next = pagePath(current, page+1)
+	case p.total < 0 && len(items) >= limit:
+		p.next = pagePath(current, page+1)
+	}
+
+	return items, nil
+}
+
+// All fetches every remaining page and returns the items of all of them
+func (p *Pager[T]) All() ([]*T, error) {
+	var all []*T
+	for p.HasNext() {
+		items, err := p.Next()
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+	}
+	return all, nil
+}
+
+// listAll fetches every page of a list endpoint
+func listAll[T any](c *Client, path string) ([]*T, error) {
+	return NewPager[T](c, path).All()
+}
+
+// pagePath returns the path with its page and limit query parameters set
+func pagePath(path string, page int) string {
+	u, err := url.Parse(path)
+	if err != nil {
+		return path
+	}
+
+	query := u.Query()
+	query.Set("page", strconv.Itoa(page))
+	query.Set("limit", strconv.Itoa(defaultPageSize))
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// pageQuery returns a query parameter of a page path
+func pageQuery(path, key string) string {
+	u, err := url.Parse(path)
+	if err != nil {
+		return ""
+	}
+	return u.Query().Get(key)
+}
+
+// nextPageFromLink returns the API path of the next page named in a Link header, if any
+func nextPageFromLink(header http.Header) string {
+	for _, link := range header.Values("Link") {
+		matches := linkNextRegex.FindStringSubmatch(link)
+		if len(matches) < 2 {
+			continue
+		}
+
+		u, err := url.Parse(matches[1])
+		if err != nil {
+			continue
+		}
+
+		// Keep the path relative to the API root so request can prefix it again,
+		// which also works when Gitea is served from a sub-path
+		uri := u.RequestURI()
+		if index := strings.Index(uri, "api/v1/"); index >= 0 {
+			return uri[index:]
+		}
+		return uri
+	}
+	return ""
+}
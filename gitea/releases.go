@@ -0,0 +1,104 @@
+// releases.go
+
+// Package gitea provides a client for interacting with the Gitea API
+package gitea
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/url"
+	"time"
+)
+
+// Release represents a Gitea release
+type Release struct {
+	ID          int64         `json:"id"`
+	TagName     string        `json:"tag_name"`
+	Target      string        `json:"target_commitish"`
+	Name        string        `json:"name"`
+	Body        string        `json:"body"`
+	Draft       bool          `json:"draft"`
+	Prerelease  bool          `json:"prerelease"`
+	Created     time.Time     `json:"created_at"`
+	Published   time.Time     `json:"published_at"`
+	Attachments []*Attachment `json:"assets"`
+}
+
+// Attachment represents a file attached to a Gitea release, issue or comment
+type Attachment struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	UUID        string    `json:"uuid"`
+	DownloadURL string    `json:"browser_download_url"`
+	Created     time.Time `json:"created_at"`
+}
+
+// CreateReleaseOption represents the data needed to create a release in Gitea
+type CreateReleaseOption struct {
+	TagName    string `json:"tag_name"`
+	Target     string `json:"target_commitish,omitempty"`
+	Name       string `json:"name"`
+	Body       string `json:"body"`
+	Draft      bool   `json:"draft"`
+	Prerelease bool   `json:"prerelease"`
+}
+
+// EditReleaseOption represents the data needed to update a release in Gitea. Empty fields are left unchanged.
+type EditReleaseOption struct {
+	Name       string `json:"name,omitempty"`
+	Body       string `json:"body,omitempty"`
+	Prerelease *bool  `json:"prerelease,omitempty"`
+}
+
+// ListReleases lists the releases of a repository
+func (c *Client) ListReleases(owner, repo string) ([]*Release, error) {
+	return listAll[Release](c, fmt.Sprintf("/repos/%s/%s/releases", owner, repo))
+}
+
+// CreateRelease creates a release in a repository
+func (c *Client) CreateRelease(owner, repo string, opt CreateReleaseOption) (*Release, error) {
+	release := &Release{}
+	if err := c.Post(fmt.Sprintf("/repos/%s/%s/releases", owner, repo), opt, release); err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+// EditRelease updates a release of a repository
+func (c *Client) EditRelease(owner, repo string, id int64, opt EditReleaseOption) (*Release, error) {
+	release := &Release{}
+	if err := c.Patch(fmt.Sprintf("/repos/%s/%s/releases/%d", owner, repo, id), opt, release); err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+// CreateReleaseAttachment uploads a file to a release
+func (c *Client) CreateReleaseAttachment(owner, repo string, releaseID int64, name string, content []byte) (*Attachment, error) {
+	path := fmt.Sprintf("/repos/%s/%s/releases/%d/assets?name=%s", owner, repo, releaseID, url.QueryEscape(name))
+	return c.uploadAttachment(path, name, content)
+}
+
+// uploadAttachment sends a file as the multipart form Gitea expects for attachments
+func (c *Client) uploadAttachment(path, name string, content []byte) (*Attachment, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("attachment", name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create form file: %w", err)
+	}
+	if _, err := part.Write(content); err != nil {
+		return nil, fmt.Errorf("failed to write form file: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish form: %w", err)
+	}
+
+	attachment := &Attachment{}
+	if _, err := c.send("POST", path, body, writer.FormDataContentType(), attachment); err != nil {
+		return nil, err
+	}
+	return attachment, nil
+}
@@ -0,0 +1,253 @@
+// repos.go
+
+// Package gitea provides a client for interacting with the Gitea API
+package gitea
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Repository represents a Gitea repository
+type Repository struct {
+	ID            int64     `json:"id"`
+	Owner         *User     `json:"owner"`
+	Name          string    `json:"name"`
+	FullName      string    `json:"full_name"`
+	Description   string    `json:"description"`
+	Empty         bool      `json:"empty"`
+	Private       bool      `json:"private"`
+	Fork          bool      `json:"fork"`
+	Mirror        bool      `json:"mirror"`
+	DefaultBranch string    `json:"default_branch"`
+	Created       time.Time `json:"created_at"`
+	Updated       time.Time `json:"updated_at"`
+}
+
+// Branch represents a branch of a Gitea repository
+type Branch struct {
+	Name   string `json:"name"`
+	Commit *struct {
+		ID string `json:"id"`
+	} `json:"commit"`
+}
+
+// Tag represents a tag of a Gitea repository
+type Tag struct {
+	Name   string `json:"name"`
+	Commit *struct {
+		SHA string `json:"sha"`
+	} `json:"commit"`
+}
+
+// Label represents a label of a Gitea repository
+type Label struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Color       string `json:"color"`
+	Description string `json:"description"`
+}
+
+// Milestone represents a milestone of a Gitea repository
+type Milestone struct {
+	ID          int64      `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	State       string     `json:"state"`
+	Deadline    *time.Time `json:"due_on"`
+	Created     time.Time  `json:"created_at"`
+	Updated     time.Time  `json:"updated_at"`
+	Closed      *time.Time `json:"closed_at"`
+}
+
+// MigrateRepoOption represents the data needed to migrate a repository to Gitea
+type MigrateRepoOption struct {
+	AuthPassword   string `json:"auth_password"`
+	AuthUsername   string `json:"auth_username"`
+	CloneAddr      string `json:"clone_addr"`
+	Description    string `json:"description"`
+	LFS            bool   `json:"lfs"`
+	LFSEndpoint    string `json:"lfs_endpoint,omitempty"`
+	Mirror         bool   `json:"mirror"`
+	MirrorInterval string `json:"mirror_interval,omitempty"`
+	Private        bool   `json:"private"`
+	RepoName       string `json:"repo_name"`
+	UID            int64  `json:"uid"`
+	Wiki           bool   `json:"wiki"`
+}
+
+// CreateBranchOption represents the data needed to create a branch in Gitea
+type CreateBranchOption struct {
+	NewBranchName string `json:"new_branch_name"`
+	OldRefName    string `json:"old_ref_name"`
+}
+
+// AddCollaboratorOption represents the data needed to add a collaborator to a repository
+type AddCollaboratorOption struct {
+	Permission string `json:"permission"`
+}
+
+// CreateLabelOption represents the data needed to create a label in Gitea
+type CreateLabelOption struct {
+	Name        string `json:"name"`
+	Color       string `json:"color"`
+	Description string `json:"description"`
+}
+
+// EditLabelOption represents the data needed to update a label in Gitea
+type EditLabelOption struct {
+	Name        string `json:"name"`
+	Color       string `json:"color"`
+	Description string `json:"description"`
+}
+
+// CreateMilestoneOption represents the data needed to create a milestone in Gitea
+type CreateMilestoneOption struct {
+	Description string `json:"description"`
+	DueOn       string `json:"due_on,omitempty"`
+	Title       string `json:"title"`
+}
+
+// EditMilestoneOption represents the data needed to update a milestone in Gitea
+type EditMilestoneOption struct {
+	Description string `json:"description"`
+	DueOn       string `json:"due_on,omitempty"`
+	State       string `json:"state"`
+	Title       string `json:"title"`
+}
+
+// GetRepo retrieves a repository
+func (c *Client) GetRepo(owner, repo string) (*Repository, error) {
+	repository := &Repository{}
+	if err := c.Get(fmt.Sprintf("/repos/%s/%s", owner, repo), repository); err != nil {
+		return nil, err
+	}
+	return repository, nil
+}
+
+// MigrateRepo creates a repository by cloning it from another service
+func (c *Client) MigrateRepo(opt MigrateRepoOption) (*Repository, error) {
+	repository := &Repository{}
+	if err := c.Post("/repos/migrate", opt, repository); err != nil {
+		return nil, err
+	}
+	return repository, nil
+}
+
+// ListBranches lists the branches of a repository
+func (c *Client) ListBranches(owner, repo string) ([]*Branch, error) {
+	return listAll[Branch](c, fmt.Sprintf("/repos/%s/%s/branches", owner, repo))
+}
+
+// ListTags lists the tags of a repository
+func (c *Client) ListTags(owner, repo string) ([]*Tag, error) {
+	return listAll[Tag](c, fmt.Sprintf("/repos/%s/%s/tags", owner, repo))
+}
+
+// GetBranch retrieves a branch of a repository
+func (c *Client) GetBranch(owner, repo, branch string) (*Branch, error) {
+	b := &Branch{}
+	if err := c.Get(fmt.Sprintf("/repos/%s/%s/branches/%s", owner, repo, branch), b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// CreateBranch creates a branch in a repository
+func (c *Client) CreateBranch(owner, repo string, opt CreateBranchOption) (*Branch, error) {
+	b := &Branch{}
+	if err := c.Post(fmt.Sprintf("/repos/%s/%s/branches", owner, repo), opt, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// DeleteBranch deletes a branch of a repository
+func (c *Client) DeleteBranch(owner, repo, branch string) error {
+	return c.Delete(fmt.Sprintf("/repos/%s/%s/branches/%s", owner, repo, branch))
+}
+
+// ListCollaborators lists the collaborators of a repository
+func (c *Client) ListCollaborators(owner, repo string) ([]*User, error) {
+	return listAll[User](c, fmt.Sprintf("/repos/%s/%s/collaborators", owner, repo))
+}
+
+// IsCollaborator checks if a user is a collaborator on a repository
+func (c *Client) IsCollaborator(owner, repo, username string) (bool, error) {
+	_, err := c.request("GET", fmt.Sprintf("/repos/%s/%s/collaborators/%s", owner, repo, username), nil, nil)
+	if err != nil {
+		if IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// AddCollaborator adds a user to a repository as a collaborator
+func (c *Client) AddCollaborator(owner, repo, username string, opt AddCollaboratorOption) error {
+	return c.Put(fmt.Sprintf("/repos/%s/%s/collaborators/%s", owner, repo, username), opt, nil)
+}
+
+// ListLabels lists the labels of a repository
+func (c *Client) ListLabels(owner, repo string) ([]*Label, error) {
+	return listAll[Label](c, fmt.Sprintf("/repos/%s/%s/labels", owner, repo))
+}
+
+// CreateLabel creates a label in a repository
+func (c *Client) CreateLabel(owner, repo string, opt CreateLabelOption) (*Label, error) {
+	label := &Label{}
+	if err := c.Post(fmt.Sprintf("/repos/%s/%s/labels", owner, repo), opt, label); err != nil {
+		return nil, err
+	}
+	return label, nil
+}
+
+// EditLabel updates a label of a repository
+func (c *Client) EditLabel(owner, repo string, id int64, opt EditLabelOption) (*Label, error) {
+	label := &Label{}
+	if err := c.Patch(fmt.Sprintf("/repos/%s/%s/labels/%d", owner, repo, id), opt, label); err != nil {
+		return nil, err
+	}
+	return label, nil
+}
+
+// ListMilestones lists the open and closed milestones of a repository
+func (c *Client) ListMilestones(owner, repo string) ([]*Milestone, error) {
+	return listAll[Milestone](c, fmt.Sprintf("/repos/%s/%s/milestones?state=all", owner, repo))
+}
+
+// GetMilestone retrieves a milestone by ID
+func (c *Client) GetMilestone(owner, repo string, id int64) (*Milestone, error) {
+	milestone := &Milestone{}
+	if err := c.Get(fmt.Sprintf("/repos/%s/%s/milestones/%d", owner, repo, id), milestone); err != nil {
+		return nil, err
+	}
+	return milestone, nil
+}
+
+// CreateMilestone creates a milestone in a repository
+func (c *Client) CreateMilestone(owner, repo string, opt CreateMilestoneOption) (*Milestone, error) {
+	milestone := &Milestone{}
+	if err := c.Post(fmt.Sprintf("/repos/%s/%s/milestones", owner, repo), opt, milestone); err != nil {
+		return nil, err
+	}
+	return milestone, nil
+}
+
+// EditMilestone updates a milestone of a repository
+func (c *Client) EditMilestone(owner, repo string, id int64, opt EditMilestoneOption) (*Milestone, error) {
+	milestone := &Milestone{}
+	if err := c.Patch(fmt.Sprintf("/repos/%s/%s/milestones/%d", owner, repo, id), opt, milestone); err != nil {
+		return nil, err
+	}
+	return milestone, nil
+}
+
+// RepoCloneURL returns the git URL of a repository. git authenticates with GitAuth.
+func (c *Client) RepoCloneURL(owner, repo string) string {
+	u := *c.baseURL
+	u.Path = fmt.Sprintf("%s/%s/%s.git", strings.TrimSuffix(u.Path, "/"), owner, repo)
+	return u.String()
+}
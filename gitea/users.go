@@ -0,0 +1,95 @@
+// users.go
+
+// Package gitea provides a client for interacting with the Gitea API
+package gitea
+
+import (
+	"fmt"
+	"time"
+)
+
+// User represents a Gitea user
+type User struct {
+	ID        int64     `json:"id"`
+	Login     string    `json:"login"`
+	FullName  string    `json:"full_name"`
+	Email     string    `json:"email"`
+	IsAdmin   bool      `json:"is_admin"`
+	Created   time.Time `json:"created"`
+	LastLogin time.Time `json:"last_login"`
+}
+
+// PublicKey represents an SSH public key of a Gitea user
+type PublicKey struct {
+	ID    int64  `json:"id"`
+	Key   string `json:"key"`
+	Title string `json:"title"`
+}
+
+// CreateUserOption represents the data needed to create a user in Gitea
+type CreateUserOption struct {
+	Email      string `json:"email"`
+	FullName   string `json:"full_name"`
+	LoginName  string `json:"login_name"`
+	Password   string `json:"password"`
+	SendNotify bool   `json:"send_notify"`
+	SourceID   int64  `json:"source_id"`
+	Username   string `json:"username"`
+}
+
+// CreateKeyOption represents the data needed to add an SSH key to a user
+type CreateKeyOption struct {
+	Key   string `json:"key"`
+	Title string `json:"title"`
+}
+
+// GetCurrentUser retrieves the user the client is authenticated as
+func (c *Client) GetCurrentUser() (*User, error) {
+	user := &User{}
+	if err := c.Get("/user", user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUser retrieves a user by name
+func (c *Client) GetUser(username string) (*User, error) {
+	user := &User{}
+	if err := c.Get("/users/"+username, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// AdminCreateUser creates a user through the admin API
+func (c *Client) AdminCreateUser(opt CreateUserOption) (*User, error) {
+	user := &User{}
+	if err := c.Post("/admin/users", opt, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// AdminListUsers lists all users of the instance
+func (c *Client) AdminListUsers() ([]*User, error) {
+	return listAll[User](c, "/admin/users")
+}
+
+// AdminRunCronTask runs a cron task of the instance, such as resync_all_hooks
+func (c *Client) AdminRunCronTask(task string) error {
+	return c.Post(fmt.Sprintf("/admin/cron/%s", task), nil, nil)
+}
+
+// ListUserKeys lists the public SSH keys of a user
+func (c *Client) ListUserKeys(username string) ([]*PublicKey, error) {
+	return listAll[PublicKey](c, fmt.Sprintf("/users/%s/keys", username))
+}
+
+// AdminCreateUserKey adds a public SSH key to a user through the admin API
+func (c *Client) AdminCreateUserKey(username string, opt CreateKeyOption) (*PublicKey, error) {
+	key := &PublicKey{}
+	if err := c.Post(fmt.Sprintf("/admin/users/%s/keys", username), opt, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -0,0 +1,68 @@
+// wiki.go
+
+// Package gitea provides a client for interacting with the Gitea API
+package gitea
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-i2p/gitlab-to-gitea/utils"
+)
+
+// WikiPage represents a page of a Gitea wiki
+type WikiPage struct {
+	Title         string `json:"title"`
+	HTMLURL       string `json:"html_url"`
+	SubURL        string `json:"sub_url"`
+	ContentBase64 string `json:"content_base64"` // only set when a single page is fetched
+}
+
+// CreateWikiPageOption represents the data needed to create a wiki page in Gitea
+type CreateWikiPageOption struct {
+	Title         string `json:"title"`
+	ContentBase64 string `json:"content_base64"`
+	Message       string `json:"message,omitempty"`
+}
+
+// ListWikiPages lists the pages of a repository's wiki. Gitea only lists the pages in
+// the root of the wiki, not those in subdirectories.
+func (c *Client) ListWikiPages(owner, repo string) ([]*WikiPage, error) {
+	return listAll[WikiPage](c, fmt.Sprintf("/repos/%s/%s/wiki/pages", owner, repo))
+}
+
+// GetWikiPage retrieves a page of a repository's wiki with its content
+func (c *Client) GetWikiPage(owner, repo, name string) (*WikiPage, error) {
+	page := &WikiPage{}
+	if err := c.Get(fmt.Sprintf("/repos/%s/%s/wiki/page/%s", owner, repo, url.PathEscape(name)), page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// CreateWikiPage creates a page in a repository's wiki, creating the wiki if needed
+func (c *Client) CreateWikiPage(owner, repo string, opt CreateWikiPageOption) (*WikiPage, error) {
+	page := &WikiPage{}
+	if err := c.Post(fmt.Sprintf("/repos/%s/%s/wiki/new", owner, repo), opt, page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// WikiCloneURL returns the git URL of a repository's wiki. git authenticates with GitAuth.
+func (c *Client) WikiCloneURL(owner, repo string) string {
+	u := *c.baseURL
+	u.Path = fmt.Sprintf("%s/%s/%s.wiki.git", strings.TrimSuffix(u.Path, "/"), owner, repo)
+	return u.String()
+}
+
+// GitAuth returns the credentials git authenticates to the repositories of Gitea with
+func (c *Client) GitAuth() utils.GitAuth {
+	// Gitea takes the token as user name when the password is x-oauth-basic
+	return utils.GitAuth{
+		URL:      strings.TrimSuffix(c.baseURL.String(), "/") + "/",
+		Username: c.token,
+		Password: "x-oauth-basic",
+	}
+}
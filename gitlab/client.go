@@ -4,28 +4,83 @@
 package gitlab
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/xanzy/go-gitlab"
+
+	"github.com/go-i2p/gitlab-to-gitea/utils"
 )
 
 // Client wraps the GitLab client for custom functionality
 type Client struct {
-	client *gitlab.Client
+	client     *gitlab.Client
+	httpClient *http.Client
+	limiter    *utils.HostLimiter
+	retry      *utils.RetryTransport
+	token      string
 }
 
 // NewClient creates a new GitLab client with the provided URL and token
 func NewClient(url, token string) (*Client, error) {
-	client, err := gitlab.NewClient(token, gitlab.WithBaseURL(url))
+	limiter := utils.NewHostLimiter(nil, 0)
+	retry := utils.NewRetryTransport(limiter)
+
+	httpClient := &http.Client{Transport: retry, CheckRedirect: dropTokenOnRedirect}
+
+	// Retries are handled by our transport so they follow the same policy as Gitea's
+	client, err := gitlab.NewClient(token,
+		gitlab.WithBaseURL(url),
+		gitlab.WithHTTPClient(httpClient),
+		gitlab.WithoutRetries(),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create GitLab client: %w", err)
 	}
 
 	return &Client{
-		client: client,
+		client:     client,
+		httpClient: httpClient,
+		limiter:    limiter,
+		retry:      retry,
+		token:      token,
 	}, nil
 }
 
+// dropTokenOnRedirect removes the access token from requests redirected to another host,
+// such as object storage serving an upload, as net/http only does so for its own
+// authentication headers.
+func dropTokenOnRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if req.URL.Host != via[0].URL.Host {
+		req.Header.Del("PRIVATE-TOKEN")
+	}
+	return nil
+}
+
+// SetMaxConcurrency limits the number of requests in flight to the GitLab host.
+// A value of 0 or less removes the limit.
+func (c *Client) SetMaxConcurrency(n int) {
+	c.limiter.SetLimit(n)
+}
+
+// SetRetryPolicy changes how failed requests to GitLab are retried
+func (c *Client) SetRetryPolicy(policy utils.RetryPolicy) {
+	c.retry.SetPolicy(policy)
+}
+
+// SetRateLimit caps the number of requests sent to GitLab per second.
+// A value of 0 or less removes the cap.
+func (c *Client) SetRateLimit(requestsPerSecond float64) {
+	c.retry.SetRateLimit(requestsPerSecond)
+}
+
 // GetVersion retrieves the GitLab version
 func (c *Client) GetVersion() (string, error) {
 	v, _, err := c.client.Version.GetVersion()
@@ -205,6 +260,31 @@ func (c *Client) GetProjectIssues(projectID int) ([]*gitlab.Issue, error) {
 	return allIssues, nil
 }
 
+// GetProjectIssuesUpdatedAfter returns the issues of a project created or updated after
+// the given time
+func (c *Client) GetProjectIssuesUpdatedAfter(projectID int, updatedAfter time.Time) ([]*gitlab.Issue, error) {
+	opts := &gitlab.ListProjectIssuesOptions{
+		ListOptions: gitlab.ListOptions{
+			PerPage: 100,
+		},
+		UpdatedAfter: &updatedAfter,
+	}
+
+	var allIssues []*gitlab.Issue
+	for {
+		issues, resp, err := c.client.Issues.ListProjectIssues(projectID, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list updated project issues: %w", err)
+		}
+		allIssues = append(allIssues, issues...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return allIssues, nil
+}
+
 // GetIssueNotes returns all notes of an issue
 func (c *Client) GetIssueNotes(projectID, issueID int) ([]*gitlab.Note, error) {
 	opts := &gitlab.ListIssueNotesOptions{
@@ -271,3 +351,179 @@ func (c *Client) GetUserKeys(userID int) ([]*gitlab.SSHKey, error) {
 	}
 	return allKeys, nil
 }
+
+// GetProjectMergeRequests returns all merge requests of a project
+func (c *Client) GetProjectMergeRequests(projectID int) ([]*gitlab.MergeRequest, error) {
+	opts := &gitlab.ListProjectMergeRequestsOptions{
+		ListOptions: gitlab.ListOptions{
+			PerPage: 100,
+		},
+	}
+
+	var allMergeRequests []*gitlab.MergeRequest
+	for {
+		mergeRequests, resp, err := c.client.MergeRequests.ListProjectMergeRequests(projectID, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list project merge requests: %w", err)
+		}
+		allMergeRequests = append(allMergeRequests, mergeRequests...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return allMergeRequests, nil
+}
+
+// GetMergeRequest returns a single merge request, with the fields the list omits such as
+// its diff refs
+func (c *Client) GetMergeRequest(projectID, mergeRequestID int) (*gitlab.MergeRequest, error) {
+	mergeRequest, _, err := c.client.MergeRequests.GetMergeRequest(projectID, mergeRequestID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get merge request: %w", err)
+	}
+	return mergeRequest, nil
+}
+
+// GetMergeRequestNotes returns all notes of a merge request
+func (c *Client) GetMergeRequestNotes(projectID, mergeRequestID int) ([]*gitlab.Note, error) {
+	opts := &gitlab.ListMergeRequestNotesOptions{
+		ListOptions: gitlab.ListOptions{
+			PerPage: 100,
+		},
+	}
+
+	var allNotes []*gitlab.Note
+	for {
+		notes, resp, err := c.client.Notes.ListMergeRequestNotes(projectID, mergeRequestID, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list merge request notes: %w", err)
+		}
+		allNotes = append(allNotes, notes...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return allNotes, nil
+}
+
+// GetProjectReleases returns all releases of a project
+func (c *Client) GetProjectReleases(projectID int) ([]*gitlab.Release, error) {
+	opts := &gitlab.ListReleasesOptions{
+		ListOptions: gitlab.ListOptions{
+			PerPage: 100,
+		},
+	}
+
+	var allReleases []*gitlab.Release
+	for {
+		releases, resp, err := c.client.Releases.ListReleases(projectID, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list project releases: %w", err)
+		}
+		allReleases = append(allReleases, releases...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return allReleases, nil
+}
+
+// GetProjectBranches returns all branches of a project
+func (c *Client) GetProjectBranches(projectID int) ([]*gitlab.Branch, error) {
+	opts := &gitlab.ListBranchesOptions{
+		ListOptions: gitlab.ListOptions{
+			PerPage: 100,
+		},
+	}
+
+	var allBranches []*gitlab.Branch
+	for {
+		branches, resp, err := c.client.Branches.ListBranches(projectID, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list project branches: %w", err)
+		}
+		allBranches = append(allBranches, branches...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return allBranches, nil
+}
+
+// GetProjectTags returns all tags of a project
+func (c *Client) GetProjectTags(projectID int) ([]*gitlab.Tag, error) {
+	opts := &gitlab.ListTagsOptions{
+		ListOptions: gitlab.ListOptions{
+			PerPage: 100,
+		},
+	}
+
+	var allTags []*gitlab.Tag
+	for {
+		tags, resp, err := c.client.Tags.ListTags(projectID, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list project tags: %w", err)
+		}
+		allTags = append(allTags, tags...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return allTags, nil
+}
+
+// Download fetches a file by URL. The token is only sent to the GitLab host: links to
+// other servers are fetched anonymously and it is dropped when GitLab redirects to
+// another host.
+func (c *Client) Download(rawURL string) ([]byte, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid download URL: %w", err)
+	}
+
+	req, err := http.NewRequest("GET", target.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if target.Host == c.client.BaseURL().Host {
+		req.Header.Set("PRIVATE-TOKEN", c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("download of %s returned %s", rawURL, resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read download: %w", err)
+	}
+	return data, nil
+}
+
+// GetProjectWikiPages returns the pages of a project's wiki, without their content
+func (c *Client) GetProjectWikiPages(projectID int) ([]*gitlab.Wiki, error) {
+	pages, _, err := c.client.Wikis.ListWikis(projectID, &gitlab.ListWikisOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list wiki pages: %w", err)
+	}
+	return pages, nil
+}
+
+// DownloadUpload fetches a file uploaded to a project, such as an image pasted into an
+// issue, through the uploads API. project is the ID or full path of the project.
+func (c *Client) DownloadUpload(project, secret, filename string) ([]byte, error) {
+	apiURL := fmt.Sprintf("%sprojects/%s/uploads/%s/%s",
+		c.client.BaseURL().String(), url.PathEscape(project), secret, url.PathEscape(filename))
+	return c.Download(apiURL)
+}
@@ -0,0 +1,106 @@
+// attachments.go
+
+// Package migration handles the migration of data from GitLab to Gitea
+package migration
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/go-i2p/gitlab-to-gitea/gitea"
+)
+
+// importIssueUploads attaches the GitLab uploads linked from the body of a Gitea issue or
+// pull request to it, and points the links to the attachments
+func (m *Manager) importIssueUploads(owner, repo string, number int, body string) {
+	newBody, changed := m.importUploads(owner, repo, body, func(name string, content []byte) (*gitea.Attachment, error) {
+		return m.giteaClient.CreateIssueAttachment(owner, repo, number, name, content)
+	})
+	if !changed {
+		return
+	}
+
+	if _, err := m.giteaClient.EditIssue(owner, repo, number, gitea.EditIssueOption{Body: newBody}); err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Failed to link attachments of #%d: %v", number, err))
+	}
+}
+
+// importCommentUploads attaches the GitLab uploads linked from the body of a Gitea comment
+// to it, and points the links to the attachments
+func (m *Manager) importCommentUploads(owner, repo string, id int64, body string) {
+	newBody, changed := m.importUploads(owner, repo, body, func(name string, content []byte) (*gitea.Attachment, error) {
+		return m.giteaClient.CreateCommentAttachment(owner, repo, id, name, content)
+	})
+	if !changed {
+		return
+	}
+
+	if _, err := m.giteaClient.EditIssueComment(owner, repo, id, gitea.EditIssueCommentOption{Body: newBody}); err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Failed to link attachments of comment %d: %v", id, err))
+	}
+}
+
+// importUploads downloads the GitLab uploads a body links to and uploads them with attach.
+// Files are identified by the hash of their content, so a file that is already attached
+// somewhere in the repository is linked instead of uploaded again. It returns the body
+// with the links replaced and whether any link changed. Uploads that cannot be moved keep
+// linking to GitLab.
+func (m *Manager) importUploads(
+	owner, repo, body string,
+	attach func(name string, content []byte) (*gitea.Attachment, error),
+) (string, bool) {
+	if m.markdown == nil || m.plan != nil {
+		return body, false
+	}
+
+	repoKey := fmt.Sprintf("%s/%s", owner, repo)
+	changed := false
+
+	for _, link := range m.markdown.UploadLinks(body) {
+		content, err := m.gitlabClient.DownloadUpload(m.markdown.Project, link.Secret, link.Filename)
+		if err != nil {
+			// GitLab before 17.4 has no uploads API, but serves uploads of public projects
+			content, err = m.gitlabClient.Download(link.URL)
+		}
+		if err != nil {
+			m.log.PrintWarning(fmt.Sprintf("Failed to download upload %s: %v", link.Filename, err))
+			continue
+		}
+
+		sum := sha256.Sum256(content)
+		hash := hex.EncodeToString(sum[:])
+
+		target, ok := m.state.AttachmentURL(repoKey, hash)
+		if !ok {
+			attachment, err := attach(link.Filename, content)
+			if err != nil {
+				m.log.PrintWarning(fmt.Sprintf("Failed to attach upload %s: %v", link.Filename, err))
+				continue
+			}
+			target = attachment.DownloadURL
+
+			m.state.SetAttachmentURL(repoKey, hash, target)
+			if err := m.state.Save(); err != nil {
+				m.log.PrintWarning(fmt.Sprintf("Failed to save migration state: %v", err))
+			}
+			m.log.PrintInfo(fmt.Sprintf("Upload %s attached", link.Filename))
+		}
+
+		body = strings.ReplaceAll(body, link.URL, target)
+		changed = true
+	}
+
+	return body, changed
+}
+
+// planUploads records the GitLab uploads a body links to in the plan
+func (m *Manager) planUploads(target, body string) {
+	if m.markdown == nil || m.plan == nil {
+		return
+	}
+	for _, link := range m.markdown.UploadLinks(body) {
+		m.plan.Add(PlanAttachment, target, link.URL, link.Filename)
+	}
+}
@@ -0,0 +1,73 @@
+// authorship.go
+
+// Package migration handles the migration of data from GitLab to Gitea
+package migration
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-i2p/gitlab-to-gitea/config"
+	"github.com/go-i2p/gitlab-to-gitea/gitea"
+)
+
+// createAsAuthor creates content written by a GitLab user according to the authorship mode.
+// create is called with the client to use and the body to post. In sudo mode it first runs
+// as the author; if Gitea refuses, for example because the author has no access to the
+// repository, it runs again as the admin with an attribution header. The returned bool
+// reports whether the content was created as the author.
+func (m *Manager) createAsAuthor(
+	username string,
+	created *time.Time,
+	body string,
+	create func(client *gitea.Client, body string) error,
+) (bool, error) {
+	author := m.userName(username)
+
+	switch m.config.AuthorshipMode {
+	case config.AuthorshipSudo:
+		if author != "" {
+			err := create(m.giteaClient.Sudo(author), body)
+			if err == nil {
+				return true, nil
+			}
+			if !gitea.IsNotFound(err) && !gitea.IsForbidden(err) {
+				return false, err
+			}
+			m.log.PrintWarning(fmt.Sprintf("Cannot post as %s, posting as admin instead: %v", author, err))
+		}
+		return false, create(m.giteaClient, attributedBody(body, author, created))
+	case config.AuthorshipHeader:
+		return false, create(m.giteaClient, attributedBody(body, author, created))
+	}
+
+	return false, create(m.giteaClient, body)
+}
+
+// authoredBodies returns the bodies content by the user may have been posted with,
+// so that content imported in any authorship mode is recognized on later runs
+func (m *Manager) authoredBodies(body, username string, created *time.Time) []string {
+	attributed := attributedBody(body, m.userName(username), created)
+	if attributed == body {
+		return []string{body}
+	}
+	return []string{body, attributed}
+}
+
+// attributedBody prefixes a body with the author and date of the original GitLab content
+func attributedBody(body, author string, created *time.Time) string {
+	if author == "" {
+		return body
+	}
+
+	header := fmt.Sprintf("_Originally posted by @%s", author)
+	if created != nil {
+		header += fmt.Sprintf(" on %s", created.Format(time.RFC3339))
+	}
+	header += "_"
+
+	if body == "" {
+		return header
+	}
+	return header + "\n\n" + body
+}
@@ -8,14 +8,9 @@ import (
 
 	"github.com/xanzy/go-gitlab"
 
-	"github.com/go-i2p/gitlab-to-gitea/utils"
+	"github.com/go-i2p/gitlab-to-gitea/gitea"
 )
 
-// collaboratorAddRequest represents the data needed to add a collaborator to a repository
-type collaboratorAddRequest struct {
-	Permission string `json:"permission"`
-}
-
 // importProjectCollaborators imports project collaborators to Gitea
 func (m *Manager) importProjectCollaborators(
 	collaborators []*gitlab.ProjectMember,
@@ -23,31 +18,23 @@ func (m *Manager) importProjectCollaborators(
 ) error {
 	ownerInfo, err := m.getOwner(project)
 	if err != nil {
-		utils.PrintWarning(fmt.Sprintf("Failed to get owner info for %s: %v, skipping collaborators", project.Name, err))
-		return nil // Return nil instead of error to continue with migration
-	}
-
-	// Safely extract username and type with defaults if missing
-	ownerUsername, ok := ownerInfo["username"].(string)
-	if !ok || ownerUsername == "" {
-		utils.PrintWarning(fmt.Sprintf("Owner username missing for %s, skipping collaborators", project.Name))
-		return nil
+		return fmt.Errorf("failed to get owner info for %s: %w", project.Name, err)
 	}
 
-	// Safely extract owner type with default
-	ownerType, _ := ownerInfo["type"].(string)
-	if ownerType == "" {
-		ownerType = "user" // Default to user type
+	ownerUsername := ownerInfo.Name
+	if ownerUsername == "" {
+		return fmt.Errorf("owner username missing for %s", project.Name)
 	}
 
-	repoName := utils.CleanName(project.Name)
+	_, repoName := m.projectName(project)
 
+	var failures stageErrors
 	for _, collaborator := range collaborators {
-		cleanUsername := utils.NormalizeUsername(collaborator.Username)
+		cleanUsername := m.userName(collaborator.Username)
 
 		// Skip if the collaborator is the owner
 		if cleanUsername == "" {
-			utils.PrintWarning("Empty username for collaborator, skipping")
+			m.log.PrintWarning("Empty username for collaborator, skipping")
 			continue
 		}
 
@@ -63,44 +50,47 @@ func (m *Manager) importProjectCollaborators(
 		// Check if collaborator already exists
 		exists, err := m.collaboratorExists(ownerUsername, repoName, cleanUsername)
 		if err != nil {
-			utils.PrintWarning(fmt.Sprintf("Error checking if collaborator %s exists: %v", cleanUsername, err))
+			m.log.PrintWarning(fmt.Sprintf("Error checking if collaborator %s exists: %v", cleanUsername, err))
+			failures.add(err)
 			continue
 		}
 
 		if exists {
-			utils.PrintWarning(fmt.Sprintf("Collaborator %s already exists for repo %s, skipping!", cleanUsername, repoName))
+			m.log.PrintWarning(fmt.Sprintf("Collaborator %s already exists for repo %s, skipping!", cleanUsername, repoName))
 			continue
 		}
 
-		// Add collaborator
-		colReq := collaboratorAddRequest{
-			Permission: permission,
+		if m.plan != nil {
+			m.plan.Add(PlanCollaborator, ownerUsername+"/"+repoName, collaborator.Username,
+				cleanUsername+" as "+permission)
+			continue
 		}
 
-		err = m.giteaClient.Put(
-			fmt.Sprintf("/repos/%s/%s/collaborators/%s", ownerUsername, repoName, cleanUsername),
-			colReq,
-			nil,
-		)
+		// Add collaborator
+		err = m.giteaClient.AddCollaborator(ownerUsername, repoName, cleanUsername, gitea.AddCollaboratorOption{
+			Permission: permission,
+		})
 		if err != nil {
-			utils.PrintError(fmt.Sprintf("Failed to add collaborator %s: %v", cleanUsername, err))
+			m.log.PrintError(fmt.Sprintf("Failed to add collaborator %s: %v", cleanUsername, err))
+			failures.add(err)
 			continue
 		}
 
-		utils.PrintInfo(fmt.Sprintf("Collaborator %s added to %s as %s!", collaborator.Username, repoName, permission))
+		m.log.PrintInfo(fmt.Sprintf("Collaborator %s added to %s as %s!", collaborator.Username, repoName, permission))
 	}
 
-	return nil
+	return failures.err("collaborators")
 }
 
 // collaboratorExists checks if a user is a collaborator on a repository
 func (m *Manager) collaboratorExists(owner, repo, username string) (bool, error) {
-	err := m.giteaClient.Get(fmt.Sprintf("/repos/%s/%s/collaborators/%s", owner, repo, username), nil)
+	if m.plannedRepo(owner, repo) {
+		return false, nil
+	}
+
+	exists, err := m.giteaClient.IsCollaborator(owner, repo, username)
 	if err != nil {
-		if isNotFoundError(err) {
-			return false, nil
-		}
 		return false, fmt.Errorf("error checking if collaborator exists: %w", err)
 	}
-	return true, nil
+	return exists, nil
 }
@@ -5,45 +5,46 @@ package migration
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/xanzy/go-gitlab"
 
-	"github.com/go-i2p/gitlab-to-gitea/utils"
+	"github.com/go-i2p/gitlab-to-gitea/gitea"
 )
 
-// commentCreateRequest represents the data needed to create a comment in Gitea
-type commentCreateRequest struct {
-	Body string `json:"body"`
-}
-
 // importIssueComments imports comments from a GitLab issue to a Gitea issue
 func (m *Manager) importIssueComments(
 	gitlabIssue *gitlab.Issue,
 	owner, repo string,
 	giteaIssueNumber, projectID int,
 ) error {
-	// Get migration state for comment tracking
-	commentKey := fmt.Sprintf("%s/%s/issues/%d", owner, repo, giteaIssueNumber)
-
-	// Get existing comments to avoid duplicates
-	var existingComments []map[string]interface{}
-	err := m.giteaClient.Get(
-		fmt.Sprintf("/repos/%s/%s/issues/%d/comments", owner, repo, giteaIssueNumber),
-		&existingComments,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to get existing comments: %w", err)
-	}
-
 	// Get notes from GitLab
 	notes, err := m.gitlabClient.GetIssueNotes(projectID, gitlabIssue.IID)
 	if err != nil {
 		return fmt.Errorf("failed to get issue notes: %w", err)
 	}
 
-	utils.PrintInfo(fmt.Sprintf("Found %d comments for issue #%d", len(notes), giteaIssueNumber))
+	commentKey := fmt.Sprintf("%s/%s/issues/%d", owner, repo, giteaIssueNumber)
+	return m.importNotes(notes, commentKey, owner, repo, giteaIssueNumber)
+}
+
+// importNotes imports GitLab notes as comments on a Gitea issue or pull request.
+// Gitea pull requests share the issue comment endpoints, so the same code serves both.
+func (m *Manager) importNotes(notes []*gitlab.Note, commentKey, owner, repo string, giteaIssueNumber int) error {
+	// Get existing comments to avoid duplicates
+	var existingComments []*gitea.Comment
+	if !m.plannedRepo(owner, repo) && !m.plannedIssue(owner, repo, giteaIssueNumber) {
+		var err error
+		existingComments, err = m.giteaClient.ListIssueComments(owner, repo, giteaIssueNumber)
+		if err != nil {
+			return fmt.Errorf("failed to get existing comments: %w", err)
+		}
+	}
+
+	m.log.PrintInfo(fmt.Sprintf("Found %d comments for issue #%d", len(notes), giteaIssueNumber))
 
 	importedCount := 0
+	var failures stageErrors
 	for _, note := range notes {
 		// Skip system notes
 		if note.System {
@@ -53,19 +54,21 @@ func (m *Manager) importIssueComments(
 		// Skip if note was already imported
 		noteID := fmt.Sprintf("%d", note.ID)
 		if m.state.HasImportedComment(commentKey, noteID) {
-			utils.PrintWarning(fmt.Sprintf("Comment %s already imported, skipping", noteID))
+			m.log.PrintWarning(fmt.Sprintf("Comment %s already imported, skipping", noteID))
 			continue
 		}
 
-		// Check for duplicate content
+		// Check for duplicate content, in any of the forms the note may have been posted in
 		body := note.Body
+		bodies := append(m.authoredBodies(body, note.Author.Username, note.CreatedAt),
+			m.authoredBodies(m.rewriteMarkdown(body), note.Author.Username, note.CreatedAt)...)
 		isDuplicate := false
 		for _, comment := range existingComments {
-			if comment["body"].(string) == body {
-				utils.PrintWarning("Comment content already exists, skipping")
-				m.state.MarkCommentImported(commentKey, noteID)
+			if slices.Contains(bodies, comment.Body) {
+				m.log.PrintWarning("Comment content already exists, skipping")
+				m.state.SetCommentID(commentKey, noteID, comment.ID)
 				if err := m.state.Save(); err != nil {
-					utils.PrintWarning(fmt.Sprintf("Failed to save migration state: %v", err))
+					m.log.PrintWarning(fmt.Sprintf("Failed to save migration state: %v", err))
 				}
 				isDuplicate = true
 				break
@@ -76,33 +79,43 @@ func (m *Manager) importIssueComments(
 			continue
 		}
 
-		// Normalize mentions in the body
-		body = utils.NormalizeMentions(body)
+		// Translate GitLab Markdown in the body
+		body = m.rewriteMarkdown(body)
 
-		// Create comment
-		commentReq := commentCreateRequest{
-			Body: body,
+		if m.plan != nil {
+			target := fmt.Sprintf("%s/%s#%d", owner, repo, giteaIssueNumber)
+			m.plan.Add(PlanComment, target, fmt.Sprintf("note %s", noteID), note.Author.Username)
+			m.planUploads(target, body)
+			importedCount++
+			continue
 		}
 
-		var result map[string]interface{}
-		err = m.giteaClient.Post(
-			fmt.Sprintf("/repos/%s/%s/issues/%d/comments", owner, repo, giteaIssueNumber),
-			commentReq,
-			&result,
-		)
+		// Create comment
+		var comment *gitea.Comment
+		_, err := m.createAsAuthor(note.Author.Username, note.CreatedAt, body, func(client *gitea.Client, body string) error {
+			var err error
+			comment, err = client.CreateIssueComment(owner, repo, giteaIssueNumber, gitea.CreateIssueCommentOption{
+				Body: body,
+			})
+			return err
+		})
 		if err != nil {
-			utils.PrintError(fmt.Sprintf("Comment import failed: %v", err))
+			m.log.PrintError(fmt.Sprintf("Comment import failed: %v", err))
+			failures.add(err)
 			continue
 		}
+		m.importCommentUploads(owner, repo, comment.ID, comment.Body)
+		m.deferLinks(linkedBody{number: giteaIssueNumber, commentID: comment.ID}, note.Body)
+		m.preserveCommentTimes(note, owner, repo, comment.ID)
 
-		utils.PrintInfo(fmt.Sprintf("Comment for issue #%d imported!", giteaIssueNumber))
-		m.state.MarkCommentImported(commentKey, noteID)
+		m.log.PrintInfo(fmt.Sprintf("Comment for issue #%d imported!", giteaIssueNumber))
+		m.state.SetCommentID(commentKey, noteID, comment.ID)
 		if err := m.state.Save(); err != nil {
-			utils.PrintWarning(fmt.Sprintf("Failed to save migration state: %v", err))
+			m.log.PrintWarning(fmt.Sprintf("Failed to save migration state: %v", err))
 		}
 		importedCount++
 	}
 
-	utils.PrintInfo(fmt.Sprintf("Imported %d new comments for issue #%d", importedCount, giteaIssueNumber))
-	return nil
+	m.log.PrintInfo(fmt.Sprintf("Imported %d new comments for issue #%d", importedCount, giteaIssueNumber))
+	return failures.err("comments")
 }
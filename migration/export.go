@@ -0,0 +1,440 @@
+// export.go
+
+// Package migration handles the migration of data from GitLab to Gitea
+package migration
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/go-i2p/gitlab-to-gitea/gitea"
+)
+
+// ExportProjects writes every selected project below dir in Gitea's repository dump
+// format instead of importing it through the API. Unlike the API, a dump carries the
+// original authors, timestamps and numbers of issues, pull requests and comments.
+// Users and organizations must still exist in Gitea before the dumps are restored.
+func (m *Manager) ExportProjects(dir string) error {
+	projects, err := m.selectedProjects()
+	if err != nil {
+		return err
+	}
+
+	m.log.PrintInfo(fmt.Sprintf("Exporting %d projects to %s", len(projects), dir))
+	m.loadMentions()
+
+	for _, project := range projects {
+		if err := m.ExportProject(project, dir); err != nil {
+			m.log.PrintError(fmt.Sprintf("Failed to export project %s: %v", project.PathWithNamespace, err))
+		}
+	}
+
+	return nil
+}
+
+// ExportProject writes a single GitLab project below dir in Gitea's repository dump format
+func (m *Manager) ExportProject(project *gitlab.Project, dir string) error {
+	owner, repo := m.projectName(project)
+
+	dumper, err := gitea.NewDumper(dir, owner, repo)
+	if err != nil {
+		return err
+	}
+
+	if m.config.ResumeMigration && dumper.Complete() {
+		m.log.PrintWarning(fmt.Sprintf("Project %s already exported, skipping!", project.PathWithNamespace))
+		return nil
+	}
+
+	m.log.PrintInfo(fmt.Sprintf("Exporting project %s to %s", project.PathWithNamespace, dumper.Dir()))
+
+	if err := dumper.MirrorGit(m.gitlabRemote(project)); err != nil {
+		return fmt.Errorf("failed to mirror repository: %w", err)
+	}
+
+	labels, err := m.gitlabClient.GetProjectLabels(project.ID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch labels: %w", err)
+	}
+	labelsByName := make(map[string]*gitea.DumpLabel, len(labels))
+	dumpLabels := make([]*gitea.DumpLabel, 0, len(labels))
+	for _, label := range labels {
+		dumpLabel := &gitea.DumpLabel{
+			Name:        label.Name,
+			Color:       strings.TrimPrefix(label.Color, "#"),
+			Description: label.Description,
+		}
+		labelsByName[label.Name] = dumpLabel
+		dumpLabels = append(dumpLabels, dumpLabel)
+	}
+	if err := dumper.WriteLabels(dumpLabels); err != nil {
+		return err
+	}
+
+	milestones, err := m.gitlabClient.GetProjectMilestones(project.ID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch milestones: %w", err)
+	}
+	if err := dumper.WriteMilestones(dumpMilestones(milestones)); err != nil {
+		return err
+	}
+
+	issues, err := m.gitlabClient.GetProjectIssues(project.ID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch issues: %w", err)
+	}
+	sort.Slice(issues, func(i, j int) bool { return issues[i].IID < issues[j].IID })
+
+	// Gitea numbers issues and pull requests in one sequence, so pull requests are
+	// numbered after the last issue, the same way Gitea's own GitLab migration does
+	lastIssue := 0
+	if len(issues) > 0 {
+		lastIssue = issues[len(issues)-1].IID
+	}
+
+	// Label and milestone references cannot link to Gitea before the dump is restored
+	m.markdown = m.newMarkdownRewriter(project, owner, repo)
+	for name := range labelsByName {
+		m.markdown.Labels[name] = ""
+	}
+	for _, milestone := range milestones {
+		m.markdown.Milestones[milestone.Title] = ""
+	}
+	repoKey := owner + "/" + repo
+	m.markdown.Issue = func(target string, iid int) (int, bool) {
+		if target == repoKey {
+			return iid, true
+		}
+		return m.state.IssueNumber(target, iid)
+	}
+	m.markdown.PullRequest = func(target string, iid int) (int, bool) {
+		if target == repoKey {
+			return lastIssue + iid, true
+		}
+		return m.state.MergeRequestNumber(target, iid)
+	}
+	defer func() { m.markdown = nil }()
+
+	dumpIssues := make([]*gitea.DumpIssue, 0, len(issues))
+	for _, issue := range issues {
+		dumpIssues = append(dumpIssues, m.dumpIssue(issue, m.rewriteMarkdown(issue.Description), labelsByName))
+
+		notes, err := m.gitlabClient.GetIssueNotes(project.ID, issue.IID)
+		if err != nil {
+			return fmt.Errorf("failed to fetch notes of issue #%d: %w", issue.IID, err)
+		}
+		if err := m.exportComments(dumper, int64(issue.IID), notes); err != nil {
+			return err
+		}
+	}
+	if err := dumper.WriteIssues(dumpIssues); err != nil {
+		return err
+	}
+
+	mergeRequests, err := m.gitlabClient.GetProjectMergeRequests(project.ID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch merge requests: %w", err)
+	}
+	dumpPulls := make([]*gitea.DumpPullRequest, 0, len(mergeRequests))
+	for _, mr := range mergeRequests {
+		number := int64(lastIssue + mr.IID)
+		pull := m.dumpPullRequest(mr, number, m.rewriteMarkdown(mr.Description), project, owner, repo, labelsByName)
+		pull.Base.SHA = m.mergeRequestBase(dumper, project.ID, mr)
+		dumpPulls = append(dumpPulls, pull)
+
+		notes, err := m.gitlabClient.GetMergeRequestNotes(project.ID, mr.IID)
+		if err != nil {
+			return fmt.Errorf("failed to fetch notes of merge request !%d: %w", mr.IID, err)
+		}
+		if err := m.exportComments(dumper, number, notes); err != nil {
+			return err
+		}
+	}
+	if err := dumper.WritePullRequests(dumpPulls); err != nil {
+		return err
+	}
+
+	releases, err := m.gitlabClient.GetProjectReleases(project.ID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch releases: %w", err)
+	}
+	dumpReleases := make([]*gitea.DumpRelease, 0, len(releases))
+	for _, release := range releases {
+		dumpRelease, err := m.dumpRelease(dumper, release)
+		if err != nil {
+			return err
+		}
+		dumpReleases = append(dumpReleases, dumpRelease)
+	}
+	if err := dumper.WriteReleases(dumpReleases); err != nil {
+		return err
+	}
+
+	if err := dumper.WriteTopics(project.Topics); err != nil {
+		return err
+	}
+
+	// repo.yml marks the dump as complete, so it is written last
+	err = dumper.WriteRepo(&gitea.DumpRepository{
+		Name:          repo,
+		Owner:         owner,
+		Description:   project.Description,
+		CloneAddr:     project.HTTPURLToRepo,
+		OriginalURL:   project.WebURL,
+		DefaultBranch: project.DefaultBranch,
+		IsPrivate:     project.Visibility == "private" || project.Visibility == "internal",
+		ServiceType:   gitea.GitServiceGitLab,
+		Issues:        true,
+		Milestones:    true,
+		Labels:        true,
+		Releases:      true,
+		Comments:      true,
+		Pulls:         true,
+		Assets:        true,
+	})
+	if err != nil {
+		return err
+	}
+
+	m.log.PrintSuccess(fmt.Sprintf("Exported %s with %d issues, %d merge requests and %d releases. Restore with: "+
+		"gitea restore-repo --repo_dir %s --owner_name %s --repo_name %s",
+		project.PathWithNamespace, len(issues), len(mergeRequests), len(releases), dumper.Dir(), owner, repo))
+	return nil
+}
+
+// exportComments writes the user notes of an issue or merge request as dump comments
+func (m *Manager) exportComments(dumper *gitea.Dumper, number int64, notes []*gitlab.Note) error {
+	var comments []*gitea.DumpComment
+	for _, note := range notes {
+		if note.System {
+			continue
+		}
+
+		created := timeOrZero(note.CreatedAt)
+		comments = append(comments, &gitea.DumpComment{
+			IssueIndex:  number,
+			Index:       int64(note.ID),
+			CommentType: "comment",
+			PosterID:    int64(note.Author.ID),
+			PosterName:  m.userName(note.Author.Username),
+			Created:     created,
+			Updated:     latestTime(&created, note.UpdatedAt),
+			Content:     m.rewriteMarkdown(note.Body),
+		})
+	}
+
+	if len(comments) == 0 {
+		return nil
+	}
+	return dumper.WriteComments(number, comments)
+}
+
+// dumpMilestones converts GitLab milestones to dump milestones
+func dumpMilestones(milestones []*gitlab.Milestone) []*gitea.DumpMilestone {
+	result := make([]*gitea.DumpMilestone, 0, len(milestones))
+	for _, milestone := range milestones {
+		dumpMilestone := &gitea.DumpMilestone{
+			Title:       milestone.Title,
+			Description: milestone.Description,
+			Created:     timeOrZero(milestone.CreatedAt),
+			Updated:     milestone.UpdatedAt,
+			State:       "open",
+		}
+		if milestone.DueDate != nil {
+			deadline := time.Time(*milestone.DueDate)
+			dumpMilestone.Deadline = &deadline
+		}
+		// GitLab does not record when a milestone was closed
+		if milestone.State == "closed" {
+			dumpMilestone.State = "closed"
+			dumpMilestone.Closed = milestone.UpdatedAt
+		}
+		result = append(result, dumpMilestone)
+	}
+	return result
+}
+
+// dumpIssue converts a GitLab issue with its rewritten description to a dump issue with the same number
+func (m *Manager) dumpIssue(issue *gitlab.Issue, content string, labels map[string]*gitea.DumpLabel) *gitea.DumpIssue {
+	created := timeOrZero(issue.CreatedAt)
+	result := &gitea.DumpIssue{
+		Number:       int64(issue.IID),
+		Title:        issue.Title,
+		Content:      content,
+		State:        "open",
+		IsLocked:     issue.DiscussionLocked,
+		Created:      created,
+		Updated:      latestTime(&created, issue.UpdatedAt),
+		Labels:       dumpIssueLabels(issue.Labels, labels),
+		ForeignIndex: int64(issue.IID),
+	}
+
+	if issue.Author != nil {
+		result.PosterID = int64(issue.Author.ID)
+		result.PosterName = m.userName(issue.Author.Username)
+	}
+	if issue.Milestone != nil {
+		result.Milestone = issue.Milestone.Title
+	}
+	if issue.State == "closed" {
+		result.State = "closed"
+		result.Closed = issue.ClosedAt
+	}
+	for _, assignee := range issue.Assignees {
+		result.Assignees = append(result.Assignees, m.userName(assignee.Username))
+	}
+
+	return result
+}
+
+// dumpPullRequest converts a GitLab merge request with its rewritten description to a dump
+// pull request with the given number
+func (m *Manager) dumpPullRequest(
+	mr *gitlab.MergeRequest,
+	number int64,
+	content string,
+	project *gitlab.Project,
+	owner, repo string,
+	labels map[string]*gitea.DumpLabel,
+) *gitea.DumpPullRequest {
+	created := timeOrZero(mr.CreatedAt)
+	result := &gitea.DumpPullRequest{
+		Number:         number,
+		Title:          mr.Title,
+		Content:        content,
+		State:          "open",
+		Created:        created,
+		Updated:        latestTime(&created, mr.UpdatedAt),
+		Labels:         dumpIssueLabels(mr.Labels, labels),
+		Merged:         mr.State == "merged",
+		MergedTime:     mr.MergedAt,
+		MergeCommitSHA: mergeRequestMergeCommit(mr),
+		Head: gitea.DumpPullRequestBranch{
+			CloneURL:  project.HTTPURLToRepo,
+			Ref:       mr.SourceBranch,
+			SHA:       mr.SHA,
+			RepoName:  repo,
+			OwnerName: owner,
+		},
+		Base: gitea.DumpPullRequestBranch{
+			CloneURL:  project.HTTPURLToRepo,
+			Ref:       mr.TargetBranch,
+			RepoName:  repo,
+			OwnerName: owner,
+		},
+		IsLocked:     mr.DiscussionLocked,
+		ForeignIndex: int64(mr.IID),
+	}
+
+	if mr.Author != nil {
+		result.PosterID = int64(mr.Author.ID)
+		result.PosterName = m.userName(mr.Author.Username)
+	}
+	if mr.Milestone != nil {
+		result.Milestone = mr.Milestone.Title
+	}
+	if mr.State != "opened" {
+		result.State = "closed"
+		result.Closed = mr.ClosedAt
+		if result.Merged {
+			result.Closed = mr.MergedAt
+		}
+	}
+	for _, assignee := range mr.Assignees {
+		result.Assignees = append(result.Assignees, m.userName(assignee.Username))
+	}
+
+	return result
+}
+
+// mergeRequestBase returns the commit a merge request is based on. The list of merge
+// requests leaves their diff refs empty, so the merge request is fetched on its own,
+// falling back to the merge-base of its head and target branch in the mirrored repository.
+func (m *Manager) mergeRequestBase(dumper *gitea.Dumper, projectID int, mr *gitlab.MergeRequest) string {
+	if mr.DiffRefs.BaseSha != "" {
+		return mr.DiffRefs.BaseSha
+	}
+
+	full, err := m.gitlabClient.GetMergeRequest(projectID, mr.IID)
+	if err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Failed to fetch merge request !%d: %v", mr.IID, err))
+	} else if full.DiffRefs.BaseSha != "" {
+		return full.DiffRefs.BaseSha
+	}
+
+	base, err := dumper.MergeBase("refs/heads/"+mr.TargetBranch, mr.SHA)
+	if err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Failed to find the base of merge request !%d: %v", mr.IID, err))
+		return ""
+	}
+	return base
+}
+
+// dumpRelease converts a GitLab release to a dump release. Asset files hosted by GitLab
+// are downloaded into the dump; links to other servers are listed in the release notes.
+func (m *Manager) dumpRelease(dumper *gitea.Dumper, release *gitlab.Release) (*gitea.DumpRelease, error) {
+	published := releaseTime(release)
+	result := &gitea.DumpRelease{
+		TagName:         release.TagName,
+		TargetCommitish: release.Commit.ID,
+		Name:            release.Name,
+		Body:            releaseBody(release, m.rewriteMarkdown(release.Description)),
+		Prerelease:      release.UpcomingRelease,
+		PublisherID:     int64(release.Author.ID),
+		PublisherName:   m.userName(release.Author.Username),
+		Created:         timeOrZero(release.CreatedAt),
+		Published:       published,
+		Assets:          []*gitea.DumpReleaseAsset{},
+	}
+
+	for _, link := range release.Assets.Links {
+		if link.External {
+			continue
+		}
+
+		name := releaseAssetName(link)
+		content, err := m.gitlabClient.Download(releaseAssetURL(link))
+		if err != nil {
+			return nil, fmt.Errorf("failed to download asset %s of release %s: %w", name, release.TagName, err)
+		}
+		assetPath, err := dumper.WriteReleaseAsset(release.TagName, name, content)
+		if err != nil {
+			return nil, err
+		}
+
+		size := len(content)
+		result.Assets = append(result.Assets, &gitea.DumpReleaseAsset{
+			ID:          int64(link.ID),
+			Name:        name,
+			Size:        &size,
+			Created:     published,
+			Updated:     published,
+			DownloadURL: &assetPath,
+		})
+	}
+
+	return result, nil
+}
+
+// dumpIssueLabels returns the dump labels with the given names
+func dumpIssueLabels(names []string, labels map[string]*gitea.DumpLabel) []*gitea.DumpLabel {
+	var result []*gitea.DumpLabel
+	for _, name := range names {
+		if label, ok := labels[name]; ok {
+			result = append(result, label)
+		}
+	}
+	return result
+}
+
+// timeOrZero returns the time t points to, or the zero time for nil
+func timeOrZero(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
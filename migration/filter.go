@@ -0,0 +1,156 @@
+// filter.go
+
+// Package migration handles the migration of data from GitLab to Gitea
+package migration
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/go-i2p/gitlab-to-gitea/config"
+)
+
+// projectMatches reports whether a project passes all configured selection filters
+func projectMatches(f *config.FilterConfig, project *gitlab.Project) bool {
+	projectPath := project.PathWithNamespace
+	namespacePath := project.Namespace.FullPath
+
+	if len(f.ProjectList) > 0 && !containsString(f.ProjectList, projectPath) {
+		return false
+	}
+
+	if len(f.IncludeNamespaces) > 0 && !namespaceMatchesAny(f.IncludeNamespaces, namespacePath) {
+		return false
+	}
+	if namespaceMatchesAny(f.ExcludeNamespaces, namespacePath) {
+		return false
+	}
+
+	if len(f.IncludeProjects) > 0 && !config.GlobMatchesAny(f.IncludeProjects, projectPath) {
+		return false
+	}
+	if config.GlobMatchesAny(f.ExcludeProjects, projectPath) {
+		return false
+	}
+
+	if f.IncludeRegex != nil && !f.IncludeRegex.MatchString(projectPath) {
+		return false
+	}
+	if f.ExcludeRegex != nil && f.ExcludeRegex.MatchString(projectPath) {
+		return false
+	}
+
+	if len(f.Visibility) > 0 && !containsString(f.Visibility, string(project.Visibility)) {
+		return false
+	}
+
+	switch f.Archived {
+	case config.ArchivedExclude:
+		if project.Archived {
+			return false
+		}
+	case config.ArchivedOnly:
+		if !project.Archived {
+			return false
+		}
+	}
+
+	if f.ActiveSince != nil || f.ActiveBefore != nil {
+		if project.LastActivityAt == nil {
+			return false
+		}
+		if f.ActiveSince != nil && project.LastActivityAt.Before(*f.ActiveSince) {
+			return false
+		}
+		if f.ActiveBefore != nil && !project.LastActivityAt.Before(*f.ActiveBefore) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// groupMatches reports whether a group takes part in a filtered migration. A group is
+// selected if it owns one of the selected projects, or if it lies inside an included
+// namespace and not inside an excluded one. With nested subgroups, groups above the
+// namespace of a selected project are selected too.
+func groupMatches(f *config.FilterConfig, group *gitlab.Group, projects []*gitlab.Project, nested bool) bool {
+	if namespaceMatchesAny(f.ExcludeNamespaces, group.FullPath) {
+		return false
+	}
+
+	for _, project := range projects {
+		if project.Namespace.Kind != "group" {
+			continue
+		}
+		if project.Namespace.FullPath == group.FullPath {
+			return true
+		}
+		// Nested subgroups need their top-level organization and the teams above them
+		if nested && strings.HasPrefix(project.Namespace.FullPath, group.FullPath+"/") {
+			return true
+		}
+	}
+
+	return namespaceMatchesAny(f.IncludeNamespaces, group.FullPath)
+}
+
+// selectedProjects returns the GitLab projects taking part in this migration.
+// The list is fetched and filtered once and reused by later stages.
+func (m *Manager) selectedProjects() ([]*gitlab.Project, error) {
+	if m.projects != nil {
+		return m.projects, nil
+	}
+
+	projects, err := m.gitlabClient.ListProjects()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list GitLab projects: %w", err)
+	}
+	m.log.PrintInfo(fmt.Sprintf("Found %d GitLab projects", len(projects)))
+
+	if m.config.Filter.Active() {
+		selected := make([]*gitlab.Project, 0, len(projects))
+		for _, project := range projects {
+			if projectMatches(&m.config.Filter, project) {
+				selected = append(selected, project)
+			}
+		}
+		m.log.PrintInfo(fmt.Sprintf("Selected %d of %d GitLab projects", len(selected), len(projects)))
+		projects = selected
+	}
+
+	m.projects = projects
+	return projects, nil
+}
+
+// requiredUsersFor returns the users that must exist in Gitea for the given projects.
+// The result is computed once and reused by later stages.
+func (m *Manager) requiredUsersFor(projects []*gitlab.Project) map[string]struct{} {
+	if m.requiredUsers == nil {
+		m.requiredUsers = m.collectRequiredUsers(projects)
+	}
+	return m.requiredUsers
+}
+
+// namespaceMatchesAny reports whether a namespace is one of the given namespaces or nested below one
+func namespaceMatchesAny(namespaces []string, namespacePath string) bool {
+	for _, namespace := range namespaces {
+		namespace = strings.Trim(namespace, "/")
+		if namespacePath == namespace || strings.HasPrefix(namespacePath, namespace+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString reports whether a list contains the given value
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -5,46 +5,51 @@ package migration
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/xanzy/go-gitlab"
 
-	"github.com/go-i2p/gitlab-to-gitea/utils"
+	"github.com/go-i2p/gitlab-to-gitea/config"
+	"github.com/go-i2p/gitlab-to-gitea/gitea"
 )
 
-// organizationCreateRequest represents the data needed to create an organization in Gitea
-type organizationCreateRequest struct {
-	Description string `json:"description"`
-	FullName    string `json:"full_name"`
-	Location    string `json:"location"`
-	Username    string `json:"username"`
-	Website     string `json:"website"`
-}
-
-// ImportGroup imports a single GitLab group to Gitea as an organization
+// ImportGroup imports a single GitLab group to Gitea as an organization. Depending on the
+// subgroup strategy, a subgroup becomes a team of its top-level organization or only
+// names the repositories of its projects.
 func (m *Manager) ImportGroup(group *gitlab.Group) error {
-	cleanName := utils.CleanName(group.Name)
+	if _, subgroup := splitGroupPath(group.FullPath); subgroup != "" {
+		switch m.config.SubgroupStrategy {
+		case config.SubgroupTeams:
+			return m.importSubgroupTeam(group)
+		case config.SubgroupPrefix:
+			m.log.PrintInfo(fmt.Sprintf("Subgroup %s prefixes the repositories of its projects, nothing to create", group.FullPath))
+			return nil
+		}
+	}
 
-	utils.PrintInfo(fmt.Sprintf("Importing group %s...", cleanName))
+	cleanName := m.groupName(group)
+
+	m.log.PrintInfo(fmt.Sprintf("Importing group %s...", cleanName))
 
 	// Check if organization already exists
 	if exists, err := m.organizationExists(cleanName); err != nil {
 		return fmt.Errorf("failed to check if organization exists: %w", err)
 	} else if exists {
-		utils.PrintWarning(fmt.Sprintf("Group %s already exists in Gitea, skipping!", cleanName))
+		m.log.PrintWarning(fmt.Sprintf("Group %s already exists in Gitea, skipping!", cleanName))
 		return nil
 	}
 
 	// Get group members
 	members, err := m.gitlabClient.GetGroupMembers(group.ID)
 	if err != nil {
-		utils.PrintWarning(fmt.Sprintf("Error fetching members for group %s: %v", group.Name, err))
+		m.log.PrintWarning(fmt.Sprintf("Error fetching members for group %s: %v", group.Name, err))
 		members = []*gitlab.GroupMember{}
 	}
 
-	utils.PrintInfo(fmt.Sprintf("Found %d GitLab members for group %s", len(members), cleanName))
+	m.log.PrintInfo(fmt.Sprintf("Found %d GitLab members for group %s", len(members), cleanName))
 
 	// Create organization request
-	orgReq := organizationCreateRequest{
+	orgReq := gitea.CreateOrgOption{
 		Description: group.Description,
 		FullName:    group.FullName,
 		Location:    "",
@@ -52,18 +57,27 @@ func (m *Manager) ImportGroup(group *gitlab.Group) error {
 		Website:     "",
 	}
 
+	if m.plan != nil {
+		m.plan.Add(PlanOrganization, cleanName, group.FullPath, "")
+		m.plan.addOwner(cleanName)
+		for _, member := range members {
+			m.plan.Add(PlanTeamMember, cleanName+"/Owners", member.Username, m.userName(member.Username))
+		}
+		return nil
+	}
+
 	// Call Gitea API to create organization
-	var result map[string]interface{}
-	err = m.giteaClient.Post("/orgs", orgReq, &result)
+	org, err := m.giteaClient.CreateOrg(orgReq)
 	if err != nil {
 		return fmt.Errorf("failed to create organization %s: %w", cleanName, err)
 	}
+	m.recordGiteaID(IdentityGroup, group.ID, org.ID)
 
-	utils.PrintInfo(fmt.Sprintf("Group %s imported!", cleanName))
+	m.log.PrintInfo(fmt.Sprintf("Group %s imported!", cleanName))
 
 	// Import group members
 	if err := m.importGroupMembers(members, cleanName); err != nil {
-		utils.PrintWarning(fmt.Sprintf("Error importing members for group %s: %v", cleanName, err))
+		m.log.PrintWarning(fmt.Sprintf("Error importing members for group %s: %v", cleanName, err))
 	}
 
 	return nil
@@ -72,8 +86,7 @@ func (m *Manager) ImportGroup(group *gitlab.Group) error {
 // importGroupMembers imports group members to the first team in an organization
 func (m *Manager) importGroupMembers(members []*gitlab.GroupMember, orgName string) error {
 	// Get existing teams
-	var teams []map[string]interface{}
-	err := m.giteaClient.Get(fmt.Sprintf("/orgs/%s/teams", orgName), &teams)
+	teams, err := m.giteaClient.ListOrgTeams(orgName)
 	if err != nil {
 		return fmt.Errorf("failed to get teams for organization %s: %w", orgName, err)
 	}
@@ -82,35 +95,44 @@ func (m *Manager) importGroupMembers(members []*gitlab.GroupMember, orgName stri
 		return fmt.Errorf("no teams found for organization %s", orgName)
 	}
 
-	firstTeam := teams[0]
-	teamID := int(firstTeam["id"].(float64))
-	teamName := firstTeam["name"].(string)
+	m.log.PrintInfo(fmt.Sprintf("Organization teams fetched, importing users to first team: %s", teams[0].Name))
+
+	return m.addTeamMembers(members, orgName, teams[0])
+}
 
-	utils.PrintInfo(fmt.Sprintf("Organization teams fetched, importing users to first team: %s", teamName))
+// addTeamMembers adds group members to a team of an organization
+func (m *Manager) addTeamMembers(members []*gitlab.GroupMember, orgName string, team *gitea.Team) error {
+	teamID := team.ID
+	teamName := team.Name
 
 	// Add members to the team
 	for _, member := range members {
-		cleanUsername := utils.NormalizeUsername(member.Username)
+		cleanUsername := m.userName(member.Username)
 
 		exists, err := m.memberExists(cleanUsername, teamID)
 		if err != nil {
-			utils.PrintWarning(fmt.Sprintf("Error checking if member %s exists: %v", cleanUsername, err))
+			m.log.PrintWarning(fmt.Sprintf("Error checking if member %s exists: %v", cleanUsername, err))
 			continue
 		}
 
 		if exists {
-			utils.PrintWarning(fmt.Sprintf("Member %s already exists for team %s, skipping!", member.Username, teamName))
+			m.log.PrintWarning(fmt.Sprintf("Member %s already exists for team %s, skipping!", member.Username, teamName))
+			continue
+		}
+
+		if m.plan != nil {
+			m.plan.Add(PlanTeamMember, orgName+"/"+teamName, member.Username, cleanUsername)
 			continue
 		}
 
 		// Add member to team
-		err = m.giteaClient.Put(fmt.Sprintf("/teams/%d/members/%s", teamID, cleanUsername), nil, nil)
+		err = m.giteaClient.AddTeamMember(teamID, cleanUsername)
 		if err != nil {
-			utils.PrintError(fmt.Sprintf("Failed to add member %s to team %s: %v", member.Username, teamName, err))
+			m.log.PrintError(fmt.Sprintf("Failed to add member %s to team %s: %v", member.Username, teamName, err))
 			continue
 		}
 
-		utils.PrintInfo(fmt.Sprintf("Member %s added to team %s!", member.Username, teamName))
+		m.log.PrintInfo(fmt.Sprintf("Member %s added to team %s!", member.Username, teamName))
 	}
 
 	return nil
@@ -118,10 +140,13 @@ func (m *Manager) importGroupMembers(members []*gitlab.GroupMember, orgName stri
 
 // organizationExists checks if an organization exists in Gitea
 func (m *Manager) organizationExists(orgName string) (bool, error) {
-	var org map[string]interface{}
-	err := m.giteaClient.Get("/orgs/"+orgName, &org)
+	if m.plan != nil && m.plan.hasOwner(orgName) {
+		return true, nil
+	}
+
+	_, err := m.giteaClient.GetOrg(orgName)
 	if err != nil {
-		if isNotFoundError(err) {
+		if gitea.IsNotFound(err) {
 			return false, nil
 		}
 		return false, fmt.Errorf("error checking if organization exists: %w", err)
@@ -130,15 +155,14 @@ func (m *Manager) organizationExists(orgName string) (bool, error) {
 }
 
 // memberExists checks if a user is a member of a team
-func (m *Manager) memberExists(username string, teamID int) (bool, error) {
-	var members []map[string]interface{}
-	err := m.giteaClient.Get(fmt.Sprintf("/teams/%d/members", teamID), &members)
+func (m *Manager) memberExists(username string, teamID int64) (bool, error) {
+	members, err := m.giteaClient.ListTeamMembers(teamID)
 	if err != nil {
 		return false, fmt.Errorf("failed to get team members: %w", err)
 	}
 
 	for _, member := range members {
-		if member["username"].(string) == username {
+		if strings.EqualFold(member.Login, username) {
 			return true, nil
 		}
 	}
@@ -0,0 +1,201 @@
+// hierarchy.go
+
+// Package migration handles the migration of data from GitLab to Gitea
+package migration
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/go-i2p/gitlab-to-gitea/config"
+	"github.com/go-i2p/gitlab-to-gitea/gitea"
+	"github.com/go-i2p/gitlab-to-gitea/utils"
+)
+
+// subgroupTeamPermission is the access the team of a subgroup has to its repositories
+const subgroupTeamPermission = "write"
+
+// subgroupTeamUnits are the repository units the team of a subgroup can use
+var subgroupTeamUnits = []string{
+	"repo.code", "repo.issues", "repo.pulls", "repo.releases", "repo.wiki", "repo.projects",
+}
+
+// nestedSubgroups reports whether subgroups stay inside the organization of their
+// top-level group instead of becoming organizations of their own
+func (m *Manager) nestedSubgroups() bool {
+	return m.config.SubgroupStrategy != config.SubgroupFlatten
+}
+
+// splitGroupPath splits the full path of a GitLab namespace into its top-level group and
+// the path below it, which is empty for a top-level group
+func splitGroupPath(fullPath string) (string, string) {
+	root, subgroup, _ := strings.Cut(fullPath, "/")
+	return root, subgroup
+}
+
+// joinPath joins the segments of a GitLab path into one Gitea name, so that
+// platform/infra/terraform becomes platform-infra-terraform
+func joinPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = utils.CleanName(segment)
+	}
+	return strings.Join(segments, "-")
+}
+
+// orgName returns the name of the Gitea organization holding the projects of the GitLab
+// group with the given full path and name
+func (m *Manager) orgName(fullPath, name string) string {
+	path := fullPath
+	if m.nestedSubgroups() {
+		path, _ = splitGroupPath(fullPath)
+	}
+
+	if identity, ok := m.identities.lookup(IdentityGroup, path); ok {
+		return identity.GiteaName
+	}
+	if path == fullPath && !strings.Contains(path, "/") {
+		return utils.CleanName(name)
+	}
+	return joinPath(path)
+}
+
+// groupBaseName returns the name of the Gitea organization of a GitLab group, before
+// collisions are resolved. Top-level groups are named after the group, subgroups after
+// their full path.
+func groupBaseName(group *gitlab.Group) string {
+	if _, subgroup := splitGroupPath(group.FullPath); subgroup != "" {
+		return joinPath(group.FullPath)
+	}
+	return utils.CleanName(group.Name)
+}
+
+// projectBaseName returns the name of the Gitea repository of a GitLab project, before
+// collisions are resolved. With the prefix strategy, projects of subgroups are prefixed
+// with the path of their subgroup below the top-level group.
+func (m *Manager) projectBaseName(project *gitlab.Project) string {
+	name := utils.CleanName(project.Name)
+	if m.config.SubgroupStrategy != config.SubgroupPrefix || project.Namespace.Kind == "user" {
+		return name
+	}
+	if _, subgroup := splitGroupPath(project.Namespace.FullPath); subgroup != "" {
+		return joinPath(subgroup) + "-" + name
+	}
+	return name
+}
+
+// subgroupTeams returns the teams of the subgroups a namespace is nested in, outermost
+// first, so that infra/terraform in platform belongs to the teams infra and
+// infra-terraform of the platform organization
+func subgroupTeams(fullPath string) []string {
+	_, subgroup := splitGroupPath(fullPath)
+	if subgroup == "" {
+		return nil
+	}
+
+	segments := strings.Split(subgroup, "/")
+	teams := make([]string, len(segments))
+	for i := range segments {
+		teams[i] = joinPath(strings.Join(segments[:i+1], "/"))
+	}
+	return teams
+}
+
+// importSubgroupTeam imports a GitLab subgroup as a team of the organization of its
+// top-level group, with the members of the subgroup
+func (m *Manager) importSubgroupTeam(group *gitlab.Group) error {
+	orgName := m.orgName(group.FullPath, group.Name)
+	teams := subgroupTeams(group.FullPath)
+	teamName := teams[len(teams)-1]
+
+	members, err := m.gitlabClient.GetGroupMembers(group.ID)
+	if err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Error fetching members for group %s: %v", group.FullPath, err))
+		members = []*gitlab.GroupMember{}
+	}
+
+	m.log.PrintInfo(fmt.Sprintf("Found %d GitLab members for subgroup %s", len(members), group.FullPath))
+
+	// Teams of planned organizations cannot be looked up
+	var team *gitea.Team
+	if m.plan == nil || !m.plan.hasOwner(orgName) {
+		if team, err = m.findTeam(orgName, teamName); err != nil {
+			return err
+		}
+	}
+
+	if m.plan != nil {
+		if team == nil {
+			m.plan.Add(PlanTeam, orgName+"/"+teamName, group.FullPath, "")
+			for _, member := range members {
+				m.plan.Add(PlanTeamMember, orgName+"/"+teamName, member.Username, m.userName(member.Username))
+			}
+			return nil
+		}
+		return m.addTeamMembers(members, orgName, team)
+	}
+
+	if team == nil {
+		team, err = m.giteaClient.CreateTeam(orgName, gitea.CreateTeamOption{
+			Name:        teamName,
+			Description: group.Description,
+			Permission:  subgroupTeamPermission,
+			Units:       subgroupTeamUnits,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create team %s in organization %s: %w", teamName, orgName, err)
+		}
+		m.log.PrintInfo(fmt.Sprintf("Subgroup %s imported as team %s of %s!", group.FullPath, teamName, orgName))
+	} else {
+		m.log.PrintWarning(fmt.Sprintf("Team %s already exists in %s, adding missing members", teamName, orgName))
+	}
+
+	return m.addTeamMembers(members, orgName, team)
+}
+
+// addProjectToTeams gives the teams of the subgroups a project is nested in access to
+// its repository, as GitLab gives the members of those subgroups access to the project
+func (m *Manager) addProjectToTeams(project *gitlab.Project, owner, repo string) error {
+	if m.config.SubgroupStrategy != config.SubgroupTeams || project.Namespace.Kind == "user" {
+		return nil
+	}
+
+	var failures stageErrors
+	for _, teamName := range subgroupTeams(project.Namespace.FullPath) {
+		if m.plan != nil {
+			m.plan.Add(PlanTeamRepository, owner+"/"+teamName, project.PathWithNamespace, repo)
+			continue
+		}
+
+		team, err := m.findTeam(owner, teamName)
+		if err == nil && team == nil {
+			err = fmt.Errorf("team %s does not exist in %s", teamName, owner)
+		}
+		if err == nil {
+			err = m.giteaClient.AddTeamRepository(team.ID, owner, repo)
+		}
+		if err != nil {
+			m.log.PrintWarning(fmt.Sprintf("Failed to give team %s access to %s: %v", teamName, repo, err))
+			failures.add(err)
+			continue
+		}
+		m.log.PrintInfo(fmt.Sprintf("Team %s given access to %s!", teamName, repo))
+	}
+	return failures.err("team assignments")
+}
+
+// findTeam looks up a team of an organization by name, returning nil if it does not exist
+func (m *Manager) findTeam(orgName, teamName string) (*gitea.Team, error) {
+	teams, err := m.giteaClient.ListOrgTeams(orgName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get teams for organization %s: %w", orgName, err)
+	}
+	for _, team := range teams {
+		if strings.EqualFold(team.Name, teamName) {
+			return team, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,376 @@
+// identity.go
+
+// Package migration handles the migration of data from GitLab to Gitea
+package migration
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/go-i2p/gitlab-to-gitea/config"
+	"github.com/go-i2p/gitlab-to-gitea/utils"
+)
+
+// Kinds of GitLab entities that get a Gitea identity
+const (
+	IdentityUser    = "user"
+	IdentityGroup   = "group"
+	IdentityProject = "project"
+)
+
+// Identity records the Gitea user, organization or repository a GitLab user, group or
+// project is migrated to
+type Identity struct {
+	Kind       string `json:"kind"`
+	GitLabID   int    `json:"gitlab_id"`
+	GitLabPath string `json:"gitlab_path"`        // username, full group path or project path with namespace
+	GiteaID    int64  `json:"gitea_id,omitempty"` // 0 until the migration creates it
+	GiteaName  string `json:"gitea_name"`         // user or organization name, or owner/repo
+}
+
+// identityKey returns the key of an identity in the state
+func identityKey(kind string, gitlabID int) string {
+	return fmt.Sprintf("%s:%d", kind, gitlabID)
+}
+
+// identityMap assigns GitLab users, groups and projects their names in Gitea and keeps
+// them in the migration state, so that later runs use the same names. Users and
+// organizations share one case-insensitive namespace in Gitea, and the repositories of
+// an owner share another. When normalized names collide, the entity that claimed the
+// name first keeps it and the others get their GitLab ID appended, so the result does not
+// depend on the order GitLab lists them in. Names set in the overrides file are claimed
+// first, then names recorded by earlier runs, then users, groups and projects in order
+// of their GitLab ID.
+type identityMap struct {
+	mutex      sync.RWMutex
+	state      State
+	overrides  map[string]string         // Gitea names by config.IdentityOverrideKey
+	byKey      map[string]*Identity      // by identityKey
+	byPath     map[string]*Identity      // by config.IdentityOverrideKey of the GitLab path
+	taken      map[string]string         // identityKey holding a Gitea name, by nameKey
+	collisions map[string]*NameCollision // by nameKey of the contested name
+}
+
+// newIdentityMap creates an identity map holding the identities recorded in the state
+func newIdentityMap(state State, overrides map[string]string) *identityMap {
+	im := &identityMap{
+		state:      state,
+		overrides:  overrides,
+		byKey:      map[string]*Identity{},
+		byPath:     map[string]*Identity{},
+		taken:      map[string]string{},
+		collisions: map[string]*NameCollision{},
+	}
+
+	saved := state.SavedIdentities()
+	sort.Slice(saved, func(i, j int) bool {
+		if saved[i].Kind != saved[j].Kind {
+			return saved[i].Kind < saved[j].Kind
+		}
+		return saved[i].GitLabID < saved[j].GitLabID
+	})
+	for i := range saved {
+		identity := saved[i]
+		if _, ok := im.taken[nameKey(identity.Kind, identity.GiteaName)]; ok {
+			// Only an edited state file can get here; the identity is assigned again
+			state.DeleteIdentity(identity.Kind, identity.GitLabID)
+			continue
+		}
+		im.add(&identity)
+	}
+
+	return im
+}
+
+// nameKey returns the key under which a Gitea name is taken. Users and organizations
+// compete for names, repositories only with the other repositories of their owner.
+func nameKey(kind, giteaName string) string {
+	if kind == IdentityProject {
+		return "repository:" + strings.ToLower(giteaName)
+	}
+	return "owner:" + strings.ToLower(giteaName)
+}
+
+// add indexes an identity and takes its name
+func (im *identityMap) add(identity *Identity) {
+	key := identityKey(identity.Kind, identity.GitLabID)
+	im.byKey[key] = identity
+	im.byPath[config.IdentityOverrideKey(identity.Kind, identity.GitLabPath)] = identity
+	im.taken[nameKey(identity.Kind, identity.GiteaName)] = key
+}
+
+// remove drops an identity from the indexes and releases its name
+func (im *identityMap) remove(identity *Identity) {
+	key := identityKey(identity.Kind, identity.GitLabID)
+	delete(im.byKey, key)
+	if pathKey := config.IdentityOverrideKey(identity.Kind, identity.GitLabPath); im.byPath[pathKey] == identity {
+		delete(im.byPath, pathKey)
+	}
+	if taken := nameKey(identity.Kind, identity.GiteaName); im.taken[taken] == key {
+		delete(im.taken, taken)
+	}
+}
+
+// assign returns the identity of a GitLab entity, giving it a Gitea name if it has none
+// yet. base is the name the entity gets without collisions, and owner the Gitea owner of
+// a project.
+func (im *identityMap) assign(kind string, id int, path, owner, base string) Identity {
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+
+	key := identityKey(kind, id)
+	prefix := ""
+	if kind == IdentityProject {
+		prefix = owner + "/"
+	}
+	override, overridden := im.overrides[config.IdentityOverrideKey(kind, path)]
+
+	// Keep the recorded name unless the owner changed or the override asks for another one
+	if identity, ok := im.byKey[key]; ok {
+		if strings.HasPrefix(identity.GiteaName, prefix) && (!overridden || identity.GiteaName == prefix+override) {
+			if identity.GitLabPath != path {
+				im.remove(identity)
+				identity.GitLabPath = path
+				im.add(identity)
+				im.state.SetIdentity(*identity)
+			}
+			return *identity
+		}
+		im.remove(identity)
+	}
+
+	identity := &Identity{Kind: kind, GitLabID: id, GitLabPath: path, GiteaName: prefix + base}
+	if overridden {
+		identity.GiteaName = prefix + override
+		if holder, ok := im.taken[nameKey(kind, identity.GiteaName)]; ok && holder != key {
+			// The override wins; the holder is assigned a new name when its turn comes
+			evicted := im.byKey[holder]
+			im.remove(evicted)
+			im.state.DeleteIdentity(evicted.Kind, evicted.GitLabID)
+		}
+	} else if holder, ok := im.taken[nameKey(kind, identity.GiteaName)]; ok && holder != key {
+		contested := nameKey(kind, identity.GiteaName)
+		identity.GiteaName = fmt.Sprintf("%s%s-%d", prefix, base, id)
+		for n := 2; im.taken[nameKey(kind, identity.GiteaName)] != ""; n++ {
+			identity.GiteaName = fmt.Sprintf("%s%s-%d-%d", prefix, base, id, n)
+		}
+		im.recordCollision(contested, im.byKey[holder], identity)
+	}
+
+	im.add(identity)
+	im.state.SetIdentity(*identity)
+	return *identity
+}
+
+// recordCollision records that identity was renamed because holder has its name
+func (im *identityMap) recordCollision(contested string, holder, identity *Identity) {
+	collision, ok := im.collisions[contested]
+	if !ok {
+		kind, name, _ := strings.Cut(contested, ":")
+		collision = &NameCollision{Kind: kind, Name: name, Sources: []string{describeIdentity(holder)}}
+		im.collisions[contested] = collision
+	}
+	collision.Sources = append(collision.Sources, describeIdentity(identity))
+}
+
+// describeIdentity describes where a GitLab entity goes, for collision reports
+func describeIdentity(identity *Identity) string {
+	return fmt.Sprintf("%s %s -> %s", identity.Kind, identity.GitLabPath, identity.GiteaName)
+}
+
+// get returns the identity of the GitLab entity with the given ID
+func (im *identityMap) get(kind string, id int) (Identity, bool) {
+	if im == nil {
+		return Identity{}, false
+	}
+
+	im.mutex.RLock()
+	defer im.mutex.RUnlock()
+
+	identity, ok := im.byKey[identityKey(kind, id)]
+	if !ok {
+		return Identity{}, false
+	}
+	return *identity, true
+}
+
+// lookup returns the identity of the GitLab entity with the given path
+func (im *identityMap) lookup(kind, path string) (Identity, bool) {
+	if im == nil {
+		return Identity{}, false
+	}
+
+	im.mutex.RLock()
+	defer im.mutex.RUnlock()
+
+	identity, ok := im.byPath[config.IdentityOverrideKey(kind, path)]
+	if !ok {
+		return Identity{}, false
+	}
+	return *identity, true
+}
+
+// setGiteaID records the ID of the Gitea entity a GitLab entity was created as
+func (im *identityMap) setGiteaID(kind string, id int, giteaID int64) {
+	if im == nil {
+		return
+	}
+
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+
+	identity, ok := im.byKey[identityKey(kind, id)]
+	if !ok || identity.GiteaID == giteaID {
+		return
+	}
+	identity.GiteaID = giteaID
+	im.state.SetIdentity(*identity)
+}
+
+// nameCollisions returns the collisions found while assigning names, sorted by kind and name
+func (im *identityMap) nameCollisions() []NameCollision {
+	im.mutex.RLock()
+	defer im.mutex.RUnlock()
+
+	collisions := make([]NameCollision, 0, len(im.collisions))
+	for _, collision := range im.collisions {
+		collisions = append(collisions, *collision)
+	}
+	sort.Slice(collisions, func(i, j int) bool {
+		if collisions[i].Kind != collisions[j].Kind {
+			return collisions[i].Kind < collisions[j].Kind
+		}
+		return collisions[i].Name < collisions[j].Name
+	})
+	return collisions
+}
+
+// assignIdentities gives GitLab users, groups and projects their Gitea names, keeping the
+// names earlier runs gave them, and reports the names that collided. Entities with an
+// override come first, so that their names are never taken by another entity.
+func (m *Manager) assignIdentities(users []*gitlab.User, groups []*gitlab.Group, projects []*gitlab.Project) {
+	im := newIdentityMap(m.state, m.config.IdentityOverrides)
+
+	users = append([]*gitlab.User(nil), users...)
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	groups = append([]*gitlab.Group(nil), groups...)
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+	projects = append([]*gitlab.Project(nil), projects...)
+	sort.Slice(projects, func(i, j int) bool { return projects[i].ID < projects[j].ID })
+
+	overridden := func(kind, path string) bool {
+		_, ok := m.config.IdentityOverrides[config.IdentityOverrideKey(kind, path)]
+		return ok
+	}
+
+	for _, first := range []bool{true, false} {
+		for _, user := range users {
+			if overridden(IdentityUser, user.Username) == first {
+				im.assign(IdentityUser, user.ID, user.Username, "", utils.NormalizeUsername(user.Username))
+			}
+		}
+		for _, group := range groups {
+			// Nested subgroups have no organization of their own
+			if _, subgroup := splitGroupPath(group.FullPath); subgroup != "" && m.nestedSubgroups() {
+				continue
+			}
+			if overridden(IdentityGroup, group.FullPath) == first {
+				im.assign(IdentityGroup, group.ID, group.FullPath, "", groupBaseName(group))
+			}
+		}
+	}
+
+	// Project names depend on the names of their owners
+	m.identities = im
+	for _, first := range []bool{true, false} {
+		for _, project := range projects {
+			if overridden(IdentityProject, project.PathWithNamespace) == first {
+				im.assign(IdentityProject, project.ID, project.PathWithNamespace,
+					m.namespaceName(project.Namespace), m.projectBaseName(project))
+			}
+		}
+	}
+
+	if err := m.state.Save(); err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Failed to save migration state: %v", err))
+	}
+
+	m.reportNameCollisions(im.nameCollisions())
+}
+
+// loadIdentities assigns the Gitea names of GitLab users, groups and projects, unless the
+// user and group stage already did. It must run before projects are imported concurrently.
+func (m *Manager) loadIdentities() error {
+	if m.identities != nil {
+		return nil
+	}
+
+	users, err := m.gitlabClient.ListUsers()
+	if err != nil {
+		return fmt.Errorf("failed to list GitLab users: %w", err)
+	}
+	groups, err := m.gitlabClient.ListGroups()
+	if err != nil {
+		return fmt.Errorf("failed to list GitLab groups: %w", err)
+	}
+	projects, err := m.selectedProjects()
+	if err != nil {
+		return err
+	}
+
+	m.assignIdentities(users, groups, projects)
+	return nil
+}
+
+// userName returns the Gitea username of a GitLab user
+func (m *Manager) userName(username string) string {
+	if identity, ok := m.identities.lookup(IdentityUser, username); ok {
+		return identity.GiteaName
+	}
+	return utils.NormalizeUsername(username)
+}
+
+// groupName returns the name of the Gitea organization of a GitLab group. A subgroup
+// kept inside its top-level organization is named organization/team, where team is the
+// team or repository name prefix the subgroup becomes.
+func (m *Manager) groupName(group *gitlab.Group) string {
+	if root, subgroup := splitGroupPath(group.FullPath); subgroup != "" && m.nestedSubgroups() {
+		return m.orgName(root, root) + "/" + joinPath(subgroup)
+	}
+	if identity, ok := m.identities.get(IdentityGroup, group.ID); ok {
+		return identity.GiteaName
+	}
+	return groupBaseName(group)
+}
+
+// namespaceName returns the name of the Gitea user or organization the projects of a
+// GitLab namespace belong to
+func (m *Manager) namespaceName(namespace *gitlab.ProjectNamespace) string {
+	if namespace.Kind == "user" {
+		return m.userName(namespace.Path)
+	}
+	return m.orgName(namespace.FullPath, namespace.Name)
+}
+
+// projectName returns the owner and name of the Gitea repository of a GitLab project,
+// without looking them up in Gitea
+func (m *Manager) projectName(project *gitlab.Project) (string, string) {
+	if identity, ok := m.identities.get(IdentityProject, project.ID); ok {
+		owner, repo, _ := strings.Cut(identity.GiteaName, "/")
+		return owner, repo
+	}
+	return m.namespaceName(project.Namespace), m.projectBaseName(project)
+}
+
+// recordGiteaID records the ID of the Gitea user, organization or repository a GitLab
+// user, group or project was created as
+func (m *Manager) recordGiteaID(kind string, gitlabID int, giteaID int64) {
+	m.identities.setGiteaID(kind, gitlabID, giteaID)
+	if err := m.state.Save(); err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Failed to save migration state: %v", err))
+	}
+}
@@ -5,147 +5,415 @@ package migration
 
 import (
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/xanzy/go-gitlab"
 
-	"github.com/go-i2p/gitlab-to-gitea/utils"
+	"github.com/go-i2p/gitlab-to-gitea/gitea"
 )
 
-// issueCreateRequest represents the data needed to create an issue in Gitea
-type issueCreateRequest struct {
-	Assignee  string   `json:"assignee,omitempty"`
-	Assignees []string `json:"assignees,omitempty"`
-	Body      string   `json:"body"`
-	Closed    bool     `json:"closed"`
-	DueOn     string   `json:"due_on,omitempty"`
-	Labels    []int    `json:"labels,omitempty"`
-	Milestone int      `json:"milestone,omitempty"`
-	Title     string   `json:"title"`
-}
-
 // importProjectIssues imports project issues to Gitea
 func (m *Manager) importProjectIssues(issues []*gitlab.Issue, owner, repo string, projectID int) error {
-	// Get existing milestones and labels for reference
-	var existingMilestones []map[string]interface{}
-	err := m.giteaClient.Get(fmt.Sprintf("/repos/%s/%s/milestones", owner, repo), &existingMilestones)
-	if err != nil {
-		utils.PrintWarning(fmt.Sprintf("Error fetching milestones: %v", err))
+	var existingMilestones []*gitea.Milestone
+	var existingLabels []*gitea.Label
+	var existingIssues []*gitea.Issue
+
+	if !m.plannedRepo(owner, repo) {
+		var err error
+
+		// Get existing milestones and labels for reference
+		existingMilestones, err = m.giteaClient.ListMilestones(owner, repo)
+		if err != nil {
+			m.log.PrintWarning(fmt.Sprintf("Error fetching milestones: %v", err))
+		}
+
+		existingLabels, err = m.giteaClient.ListLabels(owner, repo)
+		if err != nil {
+			m.log.PrintWarning(fmt.Sprintf("Error fetching labels: %v", err))
+		}
+
+		// Get existing issues to avoid duplicates
+		existingIssues, err = m.giteaClient.ListIssues(owner, repo, gitea.ListIssuesOptions{State: "all"})
+		if err != nil {
+			m.log.PrintWarning(fmt.Sprintf("Error fetching existing issues: %v", err))
+		}
 	}
 
-	var existingLabels []map[string]interface{}
-	err = m.giteaClient.Get(fmt.Sprintf("/repos/%s/%s/labels", owner, repo), &existingLabels)
-	if err != nil {
-		utils.PrintWarning(fmt.Sprintf("Error fetching labels: %v", err))
+	if m.plan != nil {
+		for _, existing := range existingIssues {
+			m.plan.seedIssueNumber(owner, repo, existing.Number)
+		}
 	}
 
-	// Get existing issues to avoid duplicates
-	var existingIssues []map[string]interface{}
-	err = m.giteaClient.Get(fmt.Sprintf("/repos/%s/%s/issues?state=all&page=-1", owner, repo), &existingIssues)
-	if err != nil {
-		utils.PrintWarning(fmt.Sprintf("Error fetching existing issues: %v", err))
+	if m.config.PreserveIssueNumbers {
+		return m.importProjectIssuesInOrder(issues, owner, repo, projectID, existingIssues, existingMilestones, existingLabels)
 	}
 
+	var failures stageErrors
 	for _, issue := range issues {
 		// Check if issue already exists
-		exists, existingIssue := issueExists(existingIssues, issue.Title)
-		if exists {
-			utils.PrintWarning(fmt.Sprintf("Issue %s already exists in project %s, importing comments only", issue.Title, repo))
+		if existingIssue := m.findExistingIssue(existingIssues, issue, owner, repo); existingIssue != nil {
+			m.log.PrintWarning(fmt.Sprintf("Issue %s already exists in project %s, importing comments only", issue.Title, repo))
+			m.recordIssueNumber(owner, repo, issue.IID, existingIssue.Number)
 
 			// Import comments for existing issue
-			if existingIssue != nil {
-				issueNumber := int(existingIssue["number"].(float64))
-				if err := m.importIssueComments(issue, owner, repo, issueNumber, projectID); err != nil {
-					utils.PrintWarning(fmt.Sprintf("Error importing comments: %v", err))
-				}
+			if err := m.importIssueComments(issue, owner, repo, existingIssue.Number, projectID); err != nil {
+				m.log.PrintWarning(fmt.Sprintf("Error importing comments: %v", err))
+				failures.add(err)
 			}
+			m.preserveIssueTimes(issue, owner, repo, existingIssue.Number)
 			continue
 		}
 
-		// Prepare due date
-		var dueOn string
-		if issue.DueDate != nil {
-			dueStr := issue.DueDate.String()
-			parsedDate, err := time.Parse("2006-01-02", dueStr)
-			if err == nil {
-				dueOn = parsedDate.Format(time.RFC3339)
-			}
+		issueNumber, err := m.createIssue(issue, owner, repo, existingMilestones, existingLabels)
+		if err != nil {
+			m.log.PrintError(fmt.Sprintf("Issue %s import failed: %v", issue.Title, err))
+			failures.add(err)
+			continue
 		}
+		m.recordIssueNumber(owner, repo, issue.IID, issueNumber)
 
-		// Process assignees
-		var assignee string
-		var assignees []string
-
-		if issue.Assignee != nil {
-			assignee = utils.NormalizeUsername(issue.Assignee.Username)
+		// Import comments for the new issue
+		if err := m.importIssueComments(issue, owner, repo, issueNumber, projectID); err != nil {
+			m.log.PrintWarning(fmt.Sprintf("Error importing comments: %v", err))
+			failures.add(err)
 		}
+		m.preserveIssueTimes(issue, owner, repo, issueNumber)
+	}
+
+	return failures.err("issues")
+}
+
+// importProjectIssuesInOrder imports issues in GitLab IID order so that each Gitea issue
+// receives the same number as its GitLab counterpart. IIDs of deleted GitLab issues are
+// filled with closed placeholder issues, and the resulting numbering is verified afterwards.
+func (m *Manager) importProjectIssuesInOrder(
+	issues []*gitlab.Issue,
+	owner, repo string,
+	projectID int,
+	existingIssues []*gitea.Issue,
+	existingMilestones []*gitea.Milestone,
+	existingLabels []*gitea.Label,
+) error {
+	sorted := make([]*gitlab.Issue, len(issues))
+	copy(sorted, issues)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].IID < sorted[j].IID })
 
-		for _, a := range issue.Assignees {
-			assignees = append(assignees, utils.NormalizeUsername(a.Username))
+	// Gitea numbers issues and pull requests in one sequence, so track the highest number in use
+	existingByNumber := make(map[int]*gitea.Issue)
+	lastNumber := 0
+	for _, existing := range existingIssues {
+		existingByNumber[existing.Number] = existing
+		if existing.Number > lastNumber {
+			lastNumber = existing.Number
 		}
+	}
 
-		// Process milestone
-		var milestoneID int
-		if issue.Milestone != nil {
-			for _, m := range existingMilestones {
-				if m["title"].(string) == issue.Milestone.Title {
-					milestoneID = int(m["id"].(float64))
-					break
+	var failures stageErrors
+importing:
+	for _, issue := range sorted {
+		// A resumed migration may have created the issue at another number already
+		if number, ok := m.state.IssueNumber(owner+"/"+repo, issue.IID); ok && number != issue.IID {
+			if _, exists := existingByNumber[number]; exists {
+				m.log.PrintWarning(fmt.Sprintf("Issue #%d already exists in project %s as #%d, importing comments only", issue.IID, repo, number))
+				if err := m.importIssueComments(issue, owner, repo, number, projectID); err != nil {
+					m.log.PrintWarning(fmt.Sprintf("Error importing comments: %v", err))
+					failures.add(err)
 				}
+				m.preserveIssueTimes(issue, owner, repo, number)
+				continue
 			}
 		}
 
-		// Process labels
-		var labelIDs []int
-		for _, labelName := range issue.Labels {
-			for _, l := range existingLabels {
-				if l["name"].(string) == labelName {
-					labelIDs = append(labelIDs, int(l["id"].(float64)))
-					break
-				}
+		if existing, ok := existingByNumber[issue.IID]; ok {
+			// An issue the state maps to this number may have been renamed in GitLab since
+			number, mapped := m.state.IssueNumber(owner+"/"+repo, issue.IID)
+			if existing.Title != issue.Title && (!mapped || number != issue.IID) {
+				m.log.PrintWarning(fmt.Sprintf("Gitea issue #%d is %q, not %q, skipping", issue.IID, existing.Title, issue.Title))
+				continue
 			}
+
+			m.log.PrintWarning(fmt.Sprintf("Issue #%d already exists in project %s, importing comments only", issue.IID, repo))
+			m.recordIssueNumber(owner, repo, issue.IID, issue.IID)
+			if err := m.importIssueComments(issue, owner, repo, issue.IID, projectID); err != nil {
+				m.log.PrintWarning(fmt.Sprintf("Error importing comments: %v", err))
+				failures.add(err)
+			}
+			m.preserveIssueTimes(issue, owner, repo, issue.IID)
+			continue
+		}
+
+		// Fill the numbers of deleted GitLab issues with placeholders. Without one, this
+		// and every later issue would land on the wrong number, so the import stops.
+		for lastNumber < issue.IID-1 {
+			number, err := m.createPlaceholderIssue(owner, repo, lastNumber+1)
+			if err != nil {
+				m.log.PrintError(fmt.Sprintf("Placeholder for issue #%d failed, stopping the import of issues: %v", lastNumber+1, err))
+				failures.add(err)
+				break importing
+			}
+			lastNumber = number
+		}
+
+		issueNumber, err := m.createIssue(issue, owner, repo, existingMilestones, existingLabels)
+		if err != nil {
+			m.log.PrintError(fmt.Sprintf("Issue %s import failed: %v", issue.Title, err))
+			failures.add(err)
+			continue
+		}
+		lastNumber = issueNumber
+		m.recordIssueNumber(owner, repo, issue.IID, issueNumber)
+
+		if issueNumber != issue.IID {
+			m.log.PrintWarning(fmt.Sprintf("GitLab issue #%d was imported as Gitea issue #%d", issue.IID, issueNumber))
+		}
+
+		if err := m.importIssueComments(issue, owner, repo, issueNumber, projectID); err != nil {
+			m.log.PrintWarning(fmt.Sprintf("Error importing comments: %v", err))
+			failures.add(err)
+		}
+		m.preserveIssueTimes(issue, owner, repo, issueNumber)
+	}
+
+	verifyErr := m.verifyIssueNumbers(sorted, owner, repo)
+	if err := failures.err("issues"); err != nil {
+		return err
+	}
+	return verifyErr
+}
+
+// createIssue creates a Gitea issue for a GitLab issue and returns its number
+func (m *Manager) createIssue(
+	issue *gitlab.Issue,
+	owner, repo string,
+	existingMilestones []*gitea.Milestone,
+	existingLabels []*gitea.Label,
+) (int, error) {
+	// Prepare due date
+	var dueOn string
+	if issue.DueDate != nil {
+		dueStr := issue.DueDate.String()
+		parsedDate, err := time.Parse("2006-01-02", dueStr)
+		if err == nil {
+			dueOn = parsedDate.Format(time.RFC3339)
 		}
+	}
+
+	// Process assignees
+	var assignee string
+	var assignees []string
+
+	if issue.Assignee != nil {
+		assignee = m.userName(issue.Assignee.Username)
+	}
+
+	for _, a := range issue.Assignees {
+		assignees = append(assignees, m.userName(a.Username))
+	}
+
+	// Process milestone
+	var milestoneID int64
+	if issue.Milestone != nil {
+		milestoneID = findMilestoneID(existingMilestones, issue.Milestone.Title)
+	}
+
+	// Process labels
+	labelIDs := findLabelIDs(existingLabels, issue.Labels)
 
-		// Normalize mentions in the description
-		description := utils.NormalizeMentions(issue.Description)
+	// Translate GitLab Markdown in the description
+	description := m.rewriteMarkdown(issue.Description)
 
-		// Create issue
-		issueReq := issueCreateRequest{
-			Assignee:  assignee,
-			Assignees: assignees,
-			Body:      description,
-			Closed:    issue.State == "closed",
-			DueOn:     dueOn,
-			Labels:    labelIDs,
-			Milestone: milestoneID,
-			Title:     issue.Title,
+	// Create issue
+	issueReq := gitea.CreateIssueOption{
+		Assignee:  assignee,
+		Assignees: assignees,
+		Body:      description,
+		Closed:    issue.State == "closed",
+		DueOn:     dueOn,
+		Labels:    labelIDs,
+		Milestone: milestoneID,
+		Title:     issue.Title,
+	}
+
+	if m.plan != nil {
+		number := m.plan.nextIssueNumber(owner, repo)
+		target := fmt.Sprintf("%s/%s#%d", owner, repo, number)
+		m.plan.Add(PlanIssue, target, fmt.Sprintf("#%d", issue.IID), issue.Title)
+		m.planUploads(target, description)
+		return number, nil
+	}
+
+	var author string
+	if issue.Author != nil {
+		author = issue.Author.Username
+	}
+
+	var result *gitea.Issue
+	asAuthor, err := m.createAsAuthor(author, issue.CreatedAt, description, func(client *gitea.Client, body string) error {
+		req := issueReq
+		req.Body = body
+		var err error
+		result, err = client.CreateIssue(owner, repo, req)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if asAuthor {
+		m.restoreIssueMetadata(owner, repo, result, issueReq)
+	}
+	m.importIssueUploads(owner, repo, result.Number, result.Body)
+	m.deferLinks(linkedBody{number: result.Number}, issue.Description)
+
+	m.log.PrintInfo(fmt.Sprintf("Issue %s imported!", issue.Title))
+	return result.Number, nil
+}
+
+// restoreIssueMetadata applies, as the admin, the assignees, milestone, labels and state that
+// Gitea dropped because the author of an issue may not set them on the repository
+func (m *Manager) restoreIssueMetadata(owner, repo string, issue *gitea.Issue, req gitea.CreateIssueOption) {
+	var edit gitea.EditIssueOption
+	changed := false
+
+	if len(req.Assignees) > len(issue.Assignees) || (req.Assignee != "" && len(issue.Assignees) == 0) {
+		edit.Assignees = req.Assignees
+		if len(edit.Assignees) == 0 {
+			edit.Assignees = []string{req.Assignee}
 		}
+		changed = true
+	}
+	if req.Milestone != 0 && issue.Milestone == nil {
+		edit.Milestone = req.Milestone
+		changed = true
+	}
+	if req.Closed && issue.State != "closed" {
+		edit.State = "closed"
+		changed = true
+	}
+	if changed {
+		edit.DueDate = req.DueOn
+		if _, err := m.giteaClient.EditIssue(owner, repo, issue.Number, edit); err != nil {
+			m.log.PrintWarning(fmt.Sprintf("Failed to restore assignees, milestone or state of issue #%d: %v", issue.Number, err))
+		}
+	}
 
-		var result map[string]interface{}
-		err = m.giteaClient.Post(fmt.Sprintf("/repos/%s/%s/issues", owner, repo), issueReq, &result)
+	if len(req.Labels) > len(issue.Labels) {
+		_, err := m.giteaClient.AddIssueLabels(owner, repo, issue.Number, gitea.IssueLabelsOption{Labels: req.Labels})
 		if err != nil {
-			utils.PrintError(fmt.Sprintf("Issue %s import failed: %v", issue.Title, err))
+			m.log.PrintWarning(fmt.Sprintf("Failed to restore labels of issue #%d: %v", issue.Number, err))
+		}
+	}
+}
+
+// createPlaceholderIssue creates a closed issue standing in for a deleted GitLab issue
+func (m *Manager) createPlaceholderIssue(owner, repo string, iid int) (int, error) {
+	issueReq := gitea.CreateIssueOption{
+		Body:   fmt.Sprintf("_Placeholder for GitLab issue #%d, which no longer exists. Created to keep issue numbers aligned._", iid),
+		Closed: true,
+		Title:  placeholderIssueTitle(iid),
+	}
+
+	if m.plan != nil {
+		number := m.plan.nextIssueNumber(owner, repo)
+		m.plan.Add(PlanPlaceholderIssue, fmt.Sprintf("%s/%s#%d", owner, repo, number), fmt.Sprintf("#%d", iid), "")
+		return number, nil
+	}
+
+	result, err := m.giteaClient.CreateIssue(owner, repo, issueReq)
+	if err != nil {
+		return 0, err
+	}
+
+	number := result.Number
+	m.log.PrintInfo(fmt.Sprintf("Placeholder issue #%d created for deleted GitLab issue #%d", number, iid))
+	return number, nil
+}
+
+// verifyIssueNumbers checks that every GitLab issue landed on the Gitea issue with the same
+// number and records any mismatches in the migration state
+func (m *Manager) verifyIssueNumbers(issues []*gitlab.Issue, owner, repo string) error {
+	if m.plan != nil {
+		return nil
+	}
+
+	giteaIssues, err := m.giteaClient.ListIssues(owner, repo, gitea.ListIssuesOptions{State: "all", Type: "issues"})
+	if err != nil {
+		return fmt.Errorf("failed to fetch issues for verification: %w", err)
+	}
+
+	byNumber := make(map[int]string)
+	byTitle := make(map[string]int)
+	for _, gi := range giteaIssues {
+		byNumber[gi.Number] = gi.Title
+		if _, seen := byTitle[gi.Title]; !seen {
+			byTitle[gi.Title] = gi.Number
+		}
+	}
+
+	var mismatches []IssueNumberMismatch
+	for _, issue := range issues {
+		if title, ok := byNumber[issue.IID]; ok && title == issue.Title {
 			continue
 		}
+		mismatches = append(mismatches, IssueNumberMismatch{
+			GitLabIID:   issue.IID,
+			GiteaNumber: byTitle[issue.Title],
+		})
+	}
+
+	projectKey := fmt.Sprintf("%s/%s", owner, repo)
+	m.state.SetIssueNumberMismatches(projectKey, mismatches)
+	if err := m.state.Save(); err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Failed to save migration state: %v", err))
+	}
 
-		utils.PrintInfo(fmt.Sprintf("Issue %s imported!", issue.Title))
+	if len(mismatches) > 0 {
+		m.log.PrintWarning(fmt.Sprintf("%d issues in %s do not match their GitLab numbers", len(mismatches), projectKey))
+	} else {
+		m.log.PrintSuccess(fmt.Sprintf("All %d issue numbers in %s match GitLab", len(issues), projectKey))
+	}
 
-		// Import comments for the new issue
-		if result != nil {
-			issueNumber := int(result["number"].(float64))
-			if err := m.importIssueComments(issue, owner, repo, issueNumber, projectID); err != nil {
-				utils.PrintWarning(fmt.Sprintf("Error importing comments: %v", err))
+	return nil
+}
+
+// placeholderIssueTitle returns the title of the placeholder for a deleted GitLab issue
+func placeholderIssueTitle(iid int) string {
+	return fmt.Sprintf("[Deleted GitLab issue #%d]", iid)
+}
+
+// findExistingIssue returns the Gitea issue a GitLab issue was already migrated to: the one
+// recorded in the state, or else one with the same title
+func (m *Manager) findExistingIssue(existingIssues []*gitea.Issue, issue *gitlab.Issue, owner, repo string) *gitea.Issue {
+	if number, ok := m.state.IssueNumber(owner+"/"+repo, issue.IID); ok {
+		for _, existing := range existingIssues {
+			if existing.Number == number {
+				return existing
 			}
 		}
 	}
 
-	return nil
+	_, existing := issueExists(existingIssues, issue.Title)
+	return existing
+}
+
+// recordIssueNumber records the Gitea issue a GitLab issue was migrated to
+func (m *Manager) recordIssueNumber(owner, repo string, iid, number int) {
+	if m.plan != nil {
+		return
+	}
+
+	m.state.SetIssueNumber(owner+"/"+repo, iid, number)
+	if err := m.state.Save(); err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Failed to save migration state: %v", err))
+	}
 }
 
 // issueExists checks if an issue already exists based on title
-func issueExists(existingIssues []map[string]interface{}, title string) (bool, map[string]interface{}) {
+func issueExists(existingIssues []*gitea.Issue, title string) (bool, *gitea.Issue) {
 	for _, issue := range existingIssues {
-		if issue["title"].(string) == title {
+		if issue.Title == title {
 			return true, issue
 		}
 	}
@@ -8,61 +8,62 @@ import (
 
 	"github.com/xanzy/go-gitlab"
 
-	"github.com/go-i2p/gitlab-to-gitea/utils"
+	"github.com/go-i2p/gitlab-to-gitea/gitea"
 )
 
-// labelCreateRequest represents the data needed to create a label in Gitea
-type labelCreateRequest struct {
-	Name        string `json:"name"`
-	Color       string `json:"color"`
-	Description string `json:"description"`
-}
-
 // importProjectLabels imports project labels to Gitea
 func (m *Manager) importProjectLabels(labels []*gitlab.Label, owner, repo string) error {
+	var failures stageErrors
 	for _, label := range labels {
 		// Check if label already exists
 		exists, err := m.labelExists(owner, repo, label.Name)
 		if err != nil {
-			utils.PrintWarning(fmt.Sprintf("Error checking if label %s exists: %v", label.Name, err))
+			m.log.PrintWarning(fmt.Sprintf("Error checking if label %s exists: %v", label.Name, err))
+			failures.add(err)
 			continue
 		}
 
 		if exists {
-			utils.PrintWarning(fmt.Sprintf("Label %s already exists in project %s, skipping!", label.Name, repo))
+			m.log.PrintWarning(fmt.Sprintf("Label %s already exists in project %s, skipping!", label.Name, repo))
+			continue
+		}
+
+		if m.plan != nil {
+			m.plan.Add(PlanLabel, owner+"/"+repo, "", label.Name)
 			continue
 		}
 
 		// Create label
-		labelReq := labelCreateRequest{
+		_, err = m.giteaClient.CreateLabel(owner, repo, gitea.CreateLabelOption{
 			Name:        label.Name,
 			Color:       label.Color,
 			Description: label.Description,
-		}
-
-		var result map[string]interface{}
-		err = m.giteaClient.Post(fmt.Sprintf("/repos/%s/%s/labels", owner, repo), labelReq, &result)
+		})
 		if err != nil {
-			utils.PrintError(fmt.Sprintf("Label %s import failed: %v", label.Name, err))
+			m.log.PrintError(fmt.Sprintf("Label %s import failed: %v", label.Name, err))
+			failures.add(err)
 			continue
 		}
 
-		utils.PrintInfo(fmt.Sprintf("Label %s imported!", label.Name))
+		m.log.PrintInfo(fmt.Sprintf("Label %s imported!", label.Name))
 	}
 
-	return nil
+	return failures.err("labels")
 }
 
 // labelExists checks if a label exists in a repository
 func (m *Manager) labelExists(owner, repo, labelName string) (bool, error) {
-	var labels []map[string]interface{}
-	err := m.giteaClient.Get(fmt.Sprintf("/repos/%s/%s/labels", owner, repo), &labels)
+	if m.plannedRepo(owner, repo) {
+		return false, nil
+	}
+
+	labels, err := m.giteaClient.ListLabels(owner, repo)
 	if err != nil {
 		return false, fmt.Errorf("failed to get labels: %w", err)
 	}
 
 	for _, label := range labels {
-		if label["name"].(string) == labelName {
+		if label.Name == labelName {
 			return true, nil
 		}
 	}
@@ -0,0 +1,204 @@
+// lfs.go
+
+// Package migration handles the migration of data from GitLab to Gitea
+package migration
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/go-i2p/gitlab-to-gitea/gitea"
+	"github.com/go-i2p/gitlab-to-gitea/utils"
+)
+
+// lfsPointerMaxSize is the size below which a blob may be a Git LFS pointer file
+const lfsPointerMaxSize = 1024
+
+// lfsPointerVersion is the first line of a Git LFS pointer file
+const lfsPointerVersion = "version https://git-lfs.github.com/spec/v1"
+
+// migrateLFS reports whether the LFS objects of a project are fetched by the migration
+func (m *Manager) migrateLFS(project *gitlab.Project) bool {
+	return m.config.MigrateLFS && project.LFSEnabled
+}
+
+// lfsEndpoint returns the LFS server Gitea fetches the objects of a project from, or an
+// empty string if Gitea can derive it from the clone URL
+func (m *Manager) lfsEndpoint(project *gitlab.Project, cloneURL string) string {
+	if m.config.LFSEndpoint != "" {
+		return fmt.Sprintf("%s/%s.git/info/lfs", m.config.LFSEndpoint, project.PathWithNamespace)
+	}
+	// GitLab only serves LFS over HTTP, which Gitea cannot derive from an SSH URL
+	if cloneURL != project.HTTPURLToRepo {
+		return project.HTTPURLToRepo + "/info/lfs"
+	}
+	return ""
+}
+
+// lfsPointer is a Git LFS pointer file found in a repository
+type lfsPointer struct {
+	gitea.LFSObject
+	Path string // path of a file the pointer was found at
+}
+
+// verifyProjectLFS checks that Gitea holds the content of every Git LFS pointer in the
+// repository of a project, reporting the pointers without content
+func (m *Manager) verifyProjectLFS(project *gitlab.Project, owner, repo string) error {
+	if m.plan != nil {
+		return nil
+	}
+
+	dir, err := os.MkdirTemp("", "lfs-")
+	if err != nil {
+		return fmt.Errorf("failed to create working directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := runGit("", []utils.GitAuth{m.giteaClient.GitAuth()}, "clone", "--quiet", "--bare", m.giteaClient.RepoCloneURL(owner, repo), dir); err != nil {
+		return fmt.Errorf("failed to clone repository: %w", err)
+	}
+
+	pointers, err := findLFSPointers(dir)
+	if err != nil {
+		return fmt.Errorf("failed to find LFS pointers: %w", err)
+	}
+	if len(pointers) == 0 {
+		m.log.PrintInfo(fmt.Sprintf("Project %s has no LFS objects", repo))
+		return nil
+	}
+
+	objects := make([]gitea.LFSObject, len(pointers))
+	paths := make(map[string]string, len(pointers))
+	for i, pointer := range pointers {
+		objects[i] = pointer.LFSObject
+		paths[pointer.OID] = pointer.Path
+	}
+
+	missing, err := m.giteaClient.MissingLFSObjects(owner, repo, objects)
+	if err != nil {
+		return fmt.Errorf("failed to check LFS objects: %w", err)
+	}
+
+	m.log.PrintInfo(fmt.Sprintf("Project %s has %d LFS objects, %d of them in Gitea",
+		repo, len(objects), len(objects)-len(missing)))
+	if len(missing) == 0 {
+		return nil
+	}
+
+	for _, object := range missing {
+		m.log.PrintWarning(fmt.Sprintf("LFS pointer %s (%s, %d bytes) has no content in Gitea",
+			paths[object.OID], object.OID, object.Size))
+	}
+	return fmt.Errorf("%d of %d LFS objects missing", len(missing), len(objects))
+}
+
+// findLFSPointers lists the Git LFS pointers reachable from any ref of a repository, one
+// per object, sorted by path
+func findLFSPointers(dir string) ([]lfsPointer, error) {
+	// Every object with the path it was first reached through
+	objects, err := utils.RunGit(dir, nil, nil, "rev-list", "--objects", "--all")
+	if err != nil {
+		return nil, err
+	}
+
+	// Only small blobs can be pointers
+	sizes, err := utils.RunGit(dir, nil, bytes.NewReader(objects), "cat-file",
+		"--batch-check=%(objecttype) %(objectname) %(objectsize) %(rest)")
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates bytes.Buffer
+	paths := make(map[string]string)
+	for _, line := range strings.Split(string(sizes), "\n") {
+		fields := strings.SplitN(line, " ", 4)
+		if len(fields) < 3 || fields[0] != "blob" {
+			continue
+		}
+		if size, err := strconv.Atoi(fields[2]); err != nil || size >= lfsPointerMaxSize {
+			continue
+		}
+		if len(fields) == 4 {
+			paths[fields[1]] = fields[3]
+		}
+		fmt.Fprintln(&candidates, fields[1])
+	}
+	if candidates.Len() == 0 {
+		return nil, nil
+	}
+
+	contents, err := utils.RunGit(dir, nil, &candidates, "cat-file", "--batch")
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var pointers []lfsPointer
+	reader := bufio.NewReader(bytes.NewReader(contents))
+	for {
+		header, err := reader.ReadString('\n')
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		// Each blob is "<name> blob <size>\n<content>\n"
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("unexpected git cat-file output: %q", header)
+		}
+		size, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("unexpected git cat-file output: %q", header)
+		}
+		content := make([]byte, size+1)
+		if _, err := io.ReadFull(reader, content); err != nil {
+			return nil, err
+		}
+
+		if object, ok := parseLFSPointer(content[:size]); ok && !seen[object.OID] {
+			seen[object.OID] = true
+			pointers = append(pointers, lfsPointer{LFSObject: object, Path: paths[fields[0]]})
+		}
+	}
+
+	sort.Slice(pointers, func(i, j int) bool { return pointers[i].Path < pointers[j].Path })
+	return pointers, nil
+}
+
+// parseLFSPointer reads the object a Git LFS pointer file refers to
+func parseLFSPointer(content []byte) (gitea.LFSObject, bool) {
+	var object gitea.LFSObject
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) < 3 || lines[0] != lfsPointerVersion {
+		return object, false
+	}
+
+	for _, line := range lines[1:] {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "oid":
+			oid, ok := strings.CutPrefix(value, "sha256:")
+			if !ok || len(oid) != 64 {
+				return object, false
+			}
+			object.OID = oid
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return object, false
+			}
+			object.Size = size
+		}
+	}
+	return object, object.OID != ""
+}
@@ -4,8 +4,12 @@
 package migration
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/go-i2p/gitlab-to-gitea/utils"
 
@@ -21,7 +25,19 @@ type Manager struct {
 	gitlabClient *gitlab.Client
 	giteaClient  *gitea.Client
 	config       *config.Config
-	state        *State
+	state        State
+	log          *utils.Logger
+	plan         *Plan                   // non-nil in dry-run mode; Gitea is only read, never written
+	readOnly     bool                    // Gitea and the state are only read, and nothing is planned
+	giteaDB      *gitea.Database         // non-nil when timestamps are preserved or mirrors converted
+	markdown     *utils.MarkdownRewriter // rewrites the bodies of the project being imported
+	linkedBodies []linkedBody            // bodies of the project being imported with unresolved references
+	mentions     *utils.MentionMap       // GitLab users that mentions resolve to
+	identities   *identityMap            // Gitea names of GitLab users, groups and projects
+
+	// Cached selection, shared by the user, group and project stages
+	projects      []*gogitlab.Project
+	requiredUsers map[string]struct{}
 }
 
 func FileExists(filename string) bool {
@@ -29,11 +45,35 @@ func FileExists(filename string) bool {
 	return !os.IsNotExist(err)
 }
 
-// NewManager creates a new migration manager
-func NewManager(gitlabClient *gitlab.Client, giteaClient *gitea.Client, cfg *config.Config) *Manager {
+// NewManager creates a new migration manager. Close releases its state.
+func NewManager(gitlabClient *gitlab.Client, giteaClient *gitea.Client, cfg *config.Config) (*Manager, error) {
 	// Initialize state
-	state := NewState(cfg.MigrationStateFile)
-	if FileExists(cfg.MigrationStateFile) && cfg.ResumeMigration {
+	resume := FileExists(cfg.MigrationStateFile) && cfg.ResumeMigration
+	if cfg.DryRun {
+		utils.PrintInfo("Dry run: planning migration without writing to Gitea or the state file...")
+	} else if cfg.ReadOnly {
+		utils.PrintInfo("Read-only: reading Gitea and the state file without writing to them...")
+	}
+	state, err := OpenState(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.StateImportFile != "" {
+		sqliteState, ok := state.(*SQLiteState)
+		if !ok {
+			state.Close()
+			return nil, fmt.Errorf("only an SQLite state can import %s", cfg.StateImportFile)
+		}
+		utils.PrintInfo(fmt.Sprintf("Importing migration state from %s...", cfg.StateImportFile))
+		if err := sqliteState.ImportJSON(cfg.StateImportFile); err != nil {
+			state.Close()
+			return nil, fmt.Errorf("failed to import migration state: %w", err)
+		}
+		resume = true
+	}
+
+	if resume {
 		utils.PrintInfo("Resuming previous migration...")
 		if err := state.Load(); err != nil {
 			utils.PrintWarning(fmt.Sprintf("Could not load migration state: %v. Starting new migration.", err))
@@ -47,141 +87,329 @@ func NewManager(gitlabClient *gitlab.Client, giteaClient *gitea.Client, cfg *con
 	}
 	utils.PrintInfo("Migration state initialized.")
 
-	return &Manager{
+	manager := &Manager{
 		gitlabClient: gitlabClient,
 		giteaClient:  giteaClient,
 		config:       cfg,
 		state:        state,
+		log:          utils.DefaultLogger(),
+		readOnly:     cfg.ReadOnly,
+	}
+	if cfg.DryRun {
+		manager.plan = NewPlan()
+	}
+
+	return manager, nil
+}
+
+// Close releases the migration state
+func (m *Manager) Close() error {
+	return m.state.Close()
+}
+
+// SetGiteaDatabase gives the manager direct access to the Gitea database, which is used
+// to preserve the original times of issues, comments and milestones and to convert mirrors
+func (m *Manager) SetGiteaDatabase(db *gitea.Database) {
+	m.giteaDB = db
+}
+
+// loadMentions fetches the GitLab users that mentions are resolved against. It must run
+// before projects are imported concurrently. Without the users, every mention is treated
+// as a user.
+func (m *Manager) loadMentions() {
+	if m.mentions != nil {
+		return
+	}
+
+	users, err := m.gitlabClient.ListUsers()
+	if err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Failed to list GitLab users for mentions: %v", err))
+		return
 	}
+
+	usernames := make([]string, 0, len(users))
+	for _, user := range users {
+		usernames = append(usernames, user.Username)
+	}
+	m.mentions = utils.NewMentionMap(usernames, m.userName)
 }
 
+// errReadOnly is returned by the operations that write to Gitea in read-only mode
+var errReadOnly = errors.New("the migration manager is read-only")
+
 // ImportUsersGroups imports users and groups from GitLab to Gitea
 func (m *Manager) ImportUsersGroups() error {
-	utils.PrintInfo("Fetching users from GitLab...")
+	if m.readOnly {
+		return errReadOnly
+	}
+	m.log.PrintInfo("Fetching users from GitLab...")
 	// Get GitLab users
 	users, err := m.gitlabClient.ListUsers()
 	if err != nil {
 		return fmt.Errorf("failed to list GitLab users: %w", err)
 	}
-	utils.PrintInfo(fmt.Sprintf("Found %d GitLab users", len(users)))
+	m.log.PrintInfo(fmt.Sprintf("Found %d GitLab users", len(users)))
 
-	utils.PrintInfo("Fetching groups from GitLab...")
+	m.log.PrintInfo("Fetching groups from GitLab...")
 	// Get GitLab groups
 	groups, err := m.gitlabClient.ListGroups()
 	if err != nil {
 		return fmt.Errorf("failed to list GitLab groups: %w", err)
 	}
-	utils.PrintInfo(fmt.Sprintf("Found %d GitLab groups", len(groups)))
+	m.log.PrintInfo(fmt.Sprintf("Found %d GitLab groups", len(groups)))
 
-	utils.PrintHeader("Importing users")
+	// Names are assigned to all users and groups, so that a filtered run gives them the
+	// same names as a full one
+	projects, err := m.selectedProjects()
+	if err != nil {
+		return err
+	}
+	m.assignIdentities(users, groups, projects)
+
+	if m.config.Filter.Active() {
+		users, groups, err = m.filterUsersGroups(users, groups)
+		if err != nil {
+			return err
+		}
+		m.log.PrintInfo(fmt.Sprintf("Selected %d users and %d groups", len(users), len(groups)))
+	}
+
+	m.log.PrintHeader("Importing users")
 	// Import users
 	for _, user := range users {
-		utils.PrintInfo(fmt.Sprintf("Importing user %s...", user.Username))
+		m.log.PrintInfo(fmt.Sprintf("Importing user %s...", user.Username))
 		if m.config.ResumeMigration && m.state.HasImportedUser(user.Username) {
-			utils.PrintWarning(fmt.Sprintf("User %s already imported, skipping!", user.Username))
+			m.log.PrintWarning(fmt.Sprintf("User %s already imported, skipping!", user.Username))
 			continue
 		}
 
 		if err := m.ImportUser(user, false); err != nil {
-			utils.PrintError(fmt.Sprintf("Failed to import user %s: %v", user.Username, err))
+			m.log.PrintError(fmt.Sprintf("Failed to import user %s: %v", user.Username, err))
 			continue
 		}
 
 		m.state.MarkUserImported(user.Username)
 		if err := m.state.Save(); err != nil {
-			utils.PrintWarning(fmt.Sprintf("Failed to save migration state: %v", err))
+			m.log.PrintWarning(fmt.Sprintf("Failed to save migration state: %v", err))
 		}
-		utils.PrintSuccess(fmt.Sprintf("Imported user %s.", user.Username))
+		m.log.PrintSuccess(fmt.Sprintf("Imported user %s.", user.Username))
 	}
 
-	utils.PrintHeader("Importing groups")
-	// Import groups
+	m.log.PrintHeader("Importing groups")
+	// Import groups, parents before their subgroups
+	sort.SliceStable(groups, func(i, j int) bool {
+		return strings.Count(groups[i].FullPath, "/") < strings.Count(groups[j].FullPath, "/")
+	})
 	for _, group := range groups {
-		cleanName := utils.CleanName(group.Name)
-		utils.PrintInfo(fmt.Sprintf("Importing group: %s...", cleanName))
+		cleanName := m.groupName(group)
+		m.log.PrintInfo(fmt.Sprintf("Importing group: %s...", cleanName))
 		if m.config.ResumeMigration && m.state.HasImportedGroup(cleanName) {
-			utils.PrintWarning(fmt.Sprintf("Group %s already imported, skipping!", cleanName))
+			m.log.PrintWarning(fmt.Sprintf("Group %s already imported, skipping!", cleanName))
 			continue
 		}
 
 		if err := m.ImportGroup(group); err != nil {
-			utils.PrintError(fmt.Sprintf("Failed to import group %s: %v", group.Name, err))
+			m.log.PrintError(fmt.Sprintf("Failed to import group %s: %v", group.Name, err))
 			continue
 		}
 
 		m.state.MarkGroupImported(cleanName)
 		if err := m.state.Save(); err != nil {
-			utils.PrintWarning(fmt.Sprintf("Failed to save migration state: %v", err))
+			m.log.PrintWarning(fmt.Sprintf("Failed to save migration state: %v", err))
 		}
-		utils.PrintSuccess(fmt.Sprintf("Imported group: %s.", cleanName))
+		m.log.PrintSuccess(fmt.Sprintf("Imported group: %s.", cleanName))
 	}
 
 	return nil
 }
 
+// filterUsersGroups narrows users and groups down to those the selected projects need:
+// groups owning or included alongside the selected projects, and users who own, belong
+// to or took part in a selected project, or are members of a selected group
+func (m *Manager) filterUsersGroups(
+	users []*gogitlab.User,
+	groups []*gogitlab.Group,
+) ([]*gogitlab.User, []*gogitlab.Group, error) {
+	projects, err := m.selectedProjects()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var selectedGroups []*gogitlab.Group
+	for _, group := range groups {
+		if groupMatches(&m.config.Filter, group, projects, m.nestedSubgroups()) {
+			selectedGroups = append(selectedGroups, group)
+		}
+	}
+
+	usernames := make(map[string]struct{})
+	for username := range m.requiredUsersFor(projects) {
+		usernames[username] = struct{}{}
+	}
+
+	for _, group := range selectedGroups {
+		members, err := m.gitlabClient.GetGroupMembers(group.ID)
+		if err != nil {
+			m.log.PrintWarning(fmt.Sprintf("Error collecting members for group %s: %v", group.Name, err))
+			continue
+		}
+		for _, member := range members {
+			usernames[member.Username] = struct{}{}
+		}
+	}
+
+	var selectedUsers []*gogitlab.User
+	for _, user := range users {
+		if _, ok := usernames[user.Username]; ok {
+			selectedUsers = append(selectedUsers, user)
+		}
+	}
+
+	return selectedUsers, selectedGroups, nil
+}
+
 // ImportProjects imports projects from GitLab to Gitea
 func (m *Manager) ImportProjects() error {
+	if m.readOnly {
+		return errReadOnly
+	}
 	// Get GitLab projects
-	projects, err := m.gitlabClient.ListProjects()
+	projects, err := m.selectedProjects()
 	if err != nil {
-		return fmt.Errorf("failed to list GitLab projects: %w", err)
+		return err
+	}
+	if err := m.loadIdentities(); err != nil {
+		return err
 	}
-	utils.PrintInfo(fmt.Sprintf("Found %d GitLab projects", len(projects)))
 
 	// Import projects
-	utils.PrintInfo("Pre-creating all necessary users for project migration...")
+	m.log.PrintInfo("Pre-creating all necessary users for project migration...")
 
 	// Create a set of all usernames and namespaces that need to exist
-	requiredUsers := m.collectRequiredUsers(projects)
+	requiredUsers := m.requiredUsersFor(projects)
 
 	// Create any missing users
-	utils.PrintInfo(fmt.Sprintf("Found %d users that need to exist in Gitea", len(requiredUsers)))
+	m.log.PrintInfo(fmt.Sprintf("Found %d users that need to exist in Gitea", len(requiredUsers)))
 	for username := range requiredUsers {
-		exists, err := m.userExists(utils.NormalizeUsername(username))
+		exists, err := m.userExists(m.userName(username))
 		if err != nil {
-			utils.PrintWarning(fmt.Sprintf("Error checking if user exists: %v", err))
+			m.log.PrintWarning(fmt.Sprintf("Error checking if user exists: %v", err))
 			continue
 		}
 
 		if !exists {
 			if err := m.ImportPlaceholderUser(username); err != nil {
-				utils.PrintWarning(fmt.Sprintf("Failed to create placeholder user: %v", err))
+				m.log.PrintWarning(fmt.Sprintf("Failed to create placeholder user: %v", err))
 			}
 		}
 	}
 
-	utils.PrintInfo("Starting project migration...")
+	m.log.PrintInfo("Starting project migration...")
+	m.loadMentions()
 
-	// Import projects
-	for _, project := range projects {
-		projectKey := fmt.Sprintf("%s/%s", project.Namespace.Name, utils.CleanName(project.Name))
-
-		// Skip if project was already fully imported
-		if m.config.ResumeMigration && m.state.HasImportedProject(projectKey) {
-			utils.PrintWarning(fmt.Sprintf("Project %s already imported, skipping!", projectKey))
-			continue
+	if m.config.MigrationWorkers > 1 {
+		m.importProjectsConcurrently(projects, m.config.MigrationWorkers)
+	} else {
+		for _, project := range projects {
+			m.importProjectWithState(project)
 		}
+	}
 
-		// Import project
-		if err := m.ImportProject(project); err != nil {
-			utils.PrintError(fmt.Sprintf("Failed to import project %s: %v", project.Name, err))
-			continue
-		}
+	m.log.PrintInfo(PartialProjectsReport(m.state))
+	return nil
+}
 
-		m.state.MarkProjectImported(projectKey)
-		if err := m.state.Save(); err != nil {
-			utils.PrintWarning(fmt.Sprintf("Failed to save migration state: %v", err))
+// importProjectWithState imports a single project unless the state shows it was already imported
+func (m *Manager) importProjectWithState(project *gogitlab.Project) {
+	_, repo := m.projectName(project)
+	projectKey := fmt.Sprintf("%s/%s", project.Namespace.Name, repo)
+
+	// Skip if project was already fully imported
+	if m.config.ResumeMigration && m.state.HasImportedProject(projectKey) {
+		m.log.PrintWarning(fmt.Sprintf("Project %s already imported, skipping!", projectKey))
+		return
+	}
+
+	// Import project
+	if err := m.ImportProject(project); err != nil {
+		m.log.PrintError(fmt.Sprintf("Failed to import project %s: %v", project.Name, err))
+		return
+	}
+
+	m.state.MarkProjectImported(projectKey)
+	if err := m.state.Save(); err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Failed to save migration state: %v", err))
+	}
+}
+
+// importProjectsConcurrently imports projects with a pool of workers. Each project logs
+// into its own buffer, and buffers are flushed in project order as projects complete,
+// so the output of one project is never interleaved with another's.
+func (m *Manager) importProjectsConcurrently(projects []*gogitlab.Project, workers int) {
+	m.log.PrintInfo(fmt.Sprintf("Importing %d projects with %d workers", len(projects), workers))
+
+	logs := make([]*utils.Logger, len(projects))
+	for i := range logs {
+		logs[i] = utils.NewBufferedLogger()
+	}
+
+	jobs := make(chan int)
+	done := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				// Each worker gets its own copy of the manager that logs into the project's buffer
+				worker := *m
+				worker.log = logs[index]
+				worker.importProjectRecovering(projects[index])
+				done <- index
+			}
+		}()
+	}
+
+	go func() {
+		for index := range projects {
+			jobs <- index
+		}
+		close(jobs)
+		wg.Wait()
+		close(done)
+	}()
+
+	// Hold back projects that finish early until all projects before them are printed
+	finished := make([]bool, len(projects))
+	next := 0
+	for index := range done {
+		finished[index] = true
+		for next < len(projects) && finished[next] {
+			logs[next].Flush()
+			next++
 		}
 	}
+}
 
-	return nil
+// importProjectRecovering imports a project, turning a panic into a logged error so that
+// one malformed project cannot take down the other workers
+func (m *Manager) importProjectRecovering(project *gogitlab.Project) {
+	defer func() {
+		if r := recover(); r != nil {
+			m.log.PrintError(fmt.Sprintf("Import of project %s failed with panic: %v", project.Name, r))
+		}
+	}()
+
+	m.importProjectWithState(project)
 }
 
 // collectRequiredUsers builds a set of usernames that need to exist before project migration
 func (m *Manager) collectRequiredUsers(projects []*gogitlab.Project) map[string]struct{} {
 	required := make(map[string]struct{})
 
-	utils.PrintHeader("Collecting required users for project migration")
+	m.log.PrintHeader("Collecting required users for project migration")
+	m.loadMentions()
 
 	// Helper function to add a user to the required map if not already present
 	addUser := func(username string) {
@@ -190,13 +418,13 @@ func (m *Manager) collectRequiredUsers(projects []*gogitlab.Project) map[string]
 		}
 		if _, exists := required[username]; !exists {
 			required[username] = struct{}{}
-			utils.PrintInfo(fmt.Sprintf("Adding required user: %s", username))
+			m.log.PrintInfo(fmt.Sprintf("Adding required user: %s", username))
 		}
 	}
 
 	// Collect users from projects
 	for _, project := range projects {
-		utils.PrintInfo(fmt.Sprintf("Collecting users for project %s...", project.Name))
+		m.log.PrintInfo(fmt.Sprintf("Collecting users for project %s...", project.Name))
 
 		// Add project namespace/owner if it's a user
 		if project.Namespace.Kind == "user" {
@@ -206,7 +434,7 @@ func (m *Manager) collectRequiredUsers(projects []*gogitlab.Project) map[string]
 		// Collect project members
 		members, err := m.gitlabClient.GetProjectMembers(project.ID)
 		if err != nil {
-			utils.PrintWarning(fmt.Sprintf("Error collecting members for %s: %v", project.Name, err))
+			m.log.PrintWarning(fmt.Sprintf("Error collecting members for %s: %v", project.Name, err))
 			continue
 		}
 
@@ -217,7 +445,7 @@ func (m *Manager) collectRequiredUsers(projects []*gogitlab.Project) map[string]
 		// Collect issues and related users
 		issues, err := m.gitlabClient.GetProjectIssues(project.ID)
 		if err != nil {
-			utils.PrintWarning(fmt.Sprintf("Error collecting issues for %s: %v", project.Name, err))
+			m.log.PrintWarning(fmt.Sprintf("Error collecting issues for %s: %v", project.Name, err))
 			continue
 		}
 
@@ -239,7 +467,7 @@ func (m *Manager) collectRequiredUsers(projects []*gogitlab.Project) map[string]
 			// Process issue notes/comments for authors
 			notes, err := m.gitlabClient.GetIssueNotes(project.ID, issue.IID)
 			if err != nil {
-				utils.PrintWarning(fmt.Sprintf("Error collecting notes for issue #%d: %v", issue.IID, err))
+				m.log.PrintWarning(fmt.Sprintf("Error collecting notes for issue #%d: %v", issue.IID, err))
 				continue
 			}
 
@@ -250,23 +478,56 @@ func (m *Manager) collectRequiredUsers(projects []*gogitlab.Project) map[string]
 			}
 
 			// Extract mentioned users from issue description
-			/*for _, mention := range utils.ExtractUserMentions(issue.Description) {
+			for _, mention := range m.mentions.Extract(issue.Description) {
 				addUser(mention)
 			}
 
 			// Extract mentioned users from notes
 			for _, note := range notes {
 				if !note.System {
-					for _, mention := range utils.ExtractUserMentions(note.Body) {
+					for _, mention := range m.mentions.Extract(note.Body) {
 						addUser(mention)
 					}
 				}
-			}*/
+			}
+		}
+
+		// Collect merge requests and related users
+		mergeRequests, err := m.gitlabClient.GetProjectMergeRequests(project.ID)
+		if err != nil {
+			m.log.PrintWarning(fmt.Sprintf("Error collecting merge requests for %s: %v", project.Name, err))
+			continue
+		}
+
+		for _, mr := range mergeRequests {
+			if mr.Author != nil {
+				addUser(mr.Author.Username)
+			}
+
+			if mr.Assignee != nil {
+				addUser(mr.Assignee.Username)
+			}
+
+			for _, assignee := range mr.Assignees {
+				addUser(assignee.Username)
+			}
+
+			notes, err := m.gitlabClient.GetMergeRequestNotes(project.ID, mr.IID)
+			if err != nil {
+				m.log.PrintWarning(fmt.Sprintf("Error collecting notes for merge request !%d: %v", mr.IID, err))
+				continue
+			}
+
+			for _, note := range notes {
+				if !note.System && note.Author.ID != 0 {
+					addUser(note.Author.Username)
+				}
+			}
 		}
 
 		// Milestones don't have authors
 	}
 
-	utils.PrintInfo(fmt.Sprintf("Collected a total of %d unique required users", len(required)))
+	m.log.PrintInfo(fmt.Sprintf("Collected a total of %d unique required users", len(required)))
 	return required
 }
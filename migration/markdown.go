@@ -0,0 +1,188 @@
+// markdown.go
+
+// Package migration handles the migration of data from GitLab to Gitea
+package migration
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/go-i2p/gitlab-to-gitea/gitea"
+	"github.com/go-i2p/gitlab-to-gitea/utils"
+)
+
+// newMarkdownRewriter creates the rewriter for the bodies of a project migrated to
+// owner/repo. References to other selected projects use their Gitea names, and issue and
+// merge request references use the numbers recorded in the state.
+func (m *Manager) newMarkdownRewriter(project *gitlab.Project, owner, repo string) *utils.MarkdownRewriter {
+	projects := map[string]string{}
+	if selected, err := m.selectedProjects(); err == nil {
+		for _, p := range selected {
+			owner, repo := m.projectName(p)
+			projects[strings.ToLower(p.PathWithNamespace)] = owner + "/" + repo
+		}
+	}
+	projects[strings.ToLower(project.PathWithNamespace)] = owner + "/" + repo
+
+	return &utils.MarkdownRewriter{
+		GitLabURL:   m.config.GitLabURL,
+		Project:     project.PathWithNamespace,
+		Projects:    projects,
+		Issue:       m.state.IssueNumber,
+		PullRequest: m.state.MergeRequestNumber,
+		Labels:      map[string]string{},
+		Milestones:  map[string]string{},
+		Mentions:    m.mentions,
+	}
+}
+
+// addMarkdownLinks lets the rewriter link label and milestone references to the labels
+// and milestones of the Gitea repository. Without them the references stay as they are.
+func (m *Manager) addMarkdownLinks(rewriter *utils.MarkdownRewriter, owner, repo string) {
+	if m.plannedRepo(owner, repo) {
+		return
+	}
+
+	repoURL := fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(m.config.GiteaURL, "/"), owner, repo)
+
+	labels, err := m.giteaClient.ListLabels(owner, repo)
+	if err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Error fetching labels for references: %v", err))
+	}
+	for _, label := range labels {
+		rewriter.Labels[label.Name] = fmt.Sprintf("%s/issues?labels=%d", repoURL, label.ID)
+	}
+
+	milestones, err := m.giteaClient.ListMilestones(owner, repo)
+	if err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Error fetching milestones for references: %v", err))
+	}
+	for _, milestone := range milestones {
+		rewriter.Milestones[milestone.Title] = fmt.Sprintf("%s/milestone/%d", repoURL, milestone.ID)
+	}
+}
+
+// rewriteMarkdown translates the GitLab Markdown of a body of the current project for
+// Gitea. Outside of a project only mentions are rewritten.
+func (m *Manager) rewriteMarkdown(text string) string {
+	if m.markdown == nil {
+		return m.mentions.Rewrite(text)
+	}
+	return m.markdown.Rewrite(text)
+}
+
+// linkedBody identifies an issue, pull request or comment body in the repository of the
+// project being imported, with the GitLab text it was written from
+type linkedBody struct {
+	number    int    // number of the issue or pull request
+	commentID int64  // ID of the comment, 0 for the body of the issue or pull request
+	source    string // GitLab Markdown of the body
+	rewritten string // what the source was rewritten to when the body was written
+}
+
+// deferLinks remembers a body written from GitLab text that references issues or merge
+// requests of migrated projects whose Gitea numbers were not known yet
+func (m *Manager) deferLinks(body linkedBody, source string) {
+	if m.markdown == nil || m.plan != nil || !m.markdown.HasUnresolvedReferences(source) {
+		return
+	}
+	body.source = source
+	body.rewritten = m.markdown.Rewrite(source)
+	m.linkedBodies = append(m.linkedBodies, body)
+}
+
+// resolveDeferredLinks rewrites the remembered bodies again, so that their references
+// point to the Gitea issues and pull requests imported since. It runs once the issues and merge
+// requests of a project are imported, as issues can reference merge requests and either
+// can reference ones with a higher number.
+func (m *Manager) resolveDeferredLinks(owner, repo string) error {
+	bodies := m.linkedBodies
+	m.linkedBodies = nil
+	if len(bodies) == 0 {
+		return nil
+	}
+
+	m.log.PrintInfo(fmt.Sprintf("Resolving references in %d bodies of %s", len(bodies), repo))
+
+	var failures stageErrors
+	for _, body := range bodies {
+		if err := m.resolveBodyLinks(owner, repo, body); err != nil {
+			m.log.PrintWarning(fmt.Sprintf("Error resolving references of #%d: %v", body.number, err))
+			failures.add(err)
+		}
+	}
+	return failures.err("bodies")
+}
+
+// resolveBodyLinks rewrites a single body again where the numbers are known now. Only the
+// lines the second rewrite changes are replaced, so that headers and attachment links
+// added to the body are kept. The edit stamps the body with the current time, so the times it had before, which may
+// have been preserved from GitLab, are written back.
+func (m *Manager) resolveBodyLinks(owner, repo string, body linkedBody) error {
+	rewritten := m.markdown.Rewrite(body.source)
+	if rewritten == body.rewritten {
+		return nil
+	}
+
+	if body.commentID != 0 {
+		comment, err := m.giteaClient.GetIssueComment(owner, repo, body.commentID)
+		if err != nil {
+			return err
+		}
+		resolved := replaceChangedLines(comment.Body, body.rewritten, rewritten)
+		if resolved == comment.Body {
+			return nil
+		}
+		if _, err := m.giteaClient.EditIssueComment(owner, repo, body.commentID, gitea.EditIssueCommentOption{Body: resolved}); err != nil {
+			return err
+		}
+		if m.giteaDB != nil {
+			return m.giteaDB.SetCommentTimes(comment.ID, comment.Created, comment.Updated)
+		}
+		return nil
+	}
+
+	// Pull requests share the issue endpoints
+	issue, err := m.giteaClient.GetIssue(owner, repo, body.number)
+	if err != nil {
+		return err
+	}
+	resolved := replaceChangedLines(issue.Body, body.rewritten, rewritten)
+	if resolved == issue.Body {
+		return nil
+	}
+	if _, err := m.giteaClient.EditIssue(owner, repo, body.number, gitea.EditIssueOption{Body: resolved}); err != nil {
+		return err
+	}
+	if m.giteaDB != nil {
+		return m.giteaDB.SetIssueTimes(issue.ID, issue.Created, issue.Updated, issue.Closed)
+	}
+	return nil
+}
+
+// replaceChangedLines replaces the lines of body that hold a line of before with the line
+// of after at the same position. Lines that differ between before and after but are no
+// longer in body stay as they are.
+func replaceChangedLines(body, before, after string) string {
+	beforeLines := strings.Split(before, "\n")
+	afterLines := strings.Split(after, "\n")
+	if len(beforeLines) != len(afterLines) {
+		return body
+	}
+
+	lines := strings.Split(body, "\n")
+	for i, old := range beforeLines {
+		if old == afterLines[i] {
+			continue
+		}
+		for j, line := range lines {
+			if line == old {
+				lines[j] = afterLines[i]
+				break
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,78 @@
+// mirrors.go
+
+// Package migration handles the migration of data from GitLab to Gitea
+package migration
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-i2p/gitlab-to-gitea/gitea"
+)
+
+// ConvertMirrors turns the pull mirrors of the selected projects into regular
+// repositories, once GitLab is frozen and Gitea takes over. The API has no call for this,
+// so the conversion is written to the Gitea database and repositories, and Gitea is then
+// asked to install the git hooks the former mirrors lack.
+func (m *Manager) ConvertMirrors() error {
+	if m.readOnly {
+		return errReadOnly
+	}
+	if m.giteaDB == nil && m.plan == nil {
+		return errors.New("converting mirrors needs GITEA_DB_TYPE and GITEA_DB_DSN")
+	}
+	if m.config.GiteaRepoRoot == "" && m.plan == nil {
+		return errors.New("converting mirrors needs GITEA_REPO_ROOT")
+	}
+
+	projects, err := m.selectedProjects()
+	if err != nil {
+		return err
+	}
+	if err := m.loadIdentities(); err != nil {
+		return err
+	}
+
+	converted, failed := 0, 0
+	for _, project := range projects {
+		owner, repo := m.projectName(project)
+
+		repository, err := m.giteaClient.GetRepo(owner, repo)
+		if err != nil {
+			m.log.PrintWarning(fmt.Sprintf("Repository %s/%s of project %s not found: %v", owner, repo, project.PathWithNamespace, err))
+			continue
+		}
+		if !repository.Mirror {
+			continue
+		}
+
+		if m.plan != nil {
+			m.plan.Add(PlanMirrorConversion, owner+"/"+repo, project.PathWithNamespace, "")
+			converted++
+			continue
+		}
+
+		repoPath := gitea.RepositoryPath(m.config.GiteaRepoRoot, owner, repo)
+		if err := m.giteaDB.ConvertMirror(repository.ID, repoPath); err != nil {
+			m.log.PrintError(fmt.Sprintf("Failed to convert mirror %s/%s: %v", owner, repo, err))
+			failed++
+			continue
+		}
+		m.log.PrintInfo(fmt.Sprintf("Mirror %s/%s converted to a regular repository", owner, repo))
+		converted++
+	}
+
+	// Without hooks, Gitea would not notice pushes to the converted repositories
+	if converted > 0 && m.plan == nil {
+		if err := m.giteaClient.AdminRunCronTask("resync_all_hooks"); err != nil {
+			m.log.PrintError(fmt.Sprintf("Failed to resynchronize git hooks, run the resync_all_hooks cron task in the site administration: %v", err))
+			failed++
+		}
+	}
+
+	m.log.PrintSuccess(fmt.Sprintf("Converted %d mirrors", converted))
+	if failed > 0 {
+		return fmt.Errorf("%d mirrors failed to convert", failed)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+// plan.go
+
+// Package migration handles the migration of data from GitLab to Gitea
+package migration
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Kinds of planned actions
+const (
+	PlanUser             = "user"
+	PlanPlaceholderUser  = "placeholder_user"
+	PlanKey              = "key"
+	PlanOrganization     = "organization"
+	PlanTeamMember       = "team_member"
+	PlanTeam             = "team"
+	PlanTeamRepository   = "team_repository"
+	PlanRepository       = "repository"
+	PlanCollaborator     = "collaborator"
+	PlanLabel            = "label"
+	PlanMilestone        = "milestone"
+	PlanIssue            = "issue"
+	PlanPlaceholderIssue = "placeholder_issue"
+	PlanBranch           = "branch"
+	PlanPullRequest      = "pull_request"
+	PlanComment          = "comment"
+	PlanRelease          = "release"
+	PlanReleaseAsset     = "release_asset"
+	PlanWiki             = "wiki"
+	PlanAttachment       = "attachment"
+	PlanMirrorConversion = "mirror_conversion"
+)
+
+// PlanAction is a single change the migration would make in Gitea
+type PlanAction struct {
+	Kind    string `json:"kind"`
+	Target  string `json:"target"`
+	Source  string `json:"source,omitempty"`
+	Details string `json:"details,omitempty"`
+}
+
+// NameCollision lists GitLab entities whose normalized names clash in Gitea, with the
+// names they were given instead
+type NameCollision struct {
+	Kind    string   `json:"kind"`
+	Name    string   `json:"name"`
+	Sources []string `json:"sources"` // "<kind> <GitLab path> -> <Gitea name>"
+}
+
+// Plan records the actions of a dry run instead of performing them
+type Plan struct {
+	Actions    []PlanAction    `json:"actions"`
+	Collisions []NameCollision `json:"collisions"`
+
+	mutex        sync.Mutex
+	owners       map[string]bool // users and organizations that only exist in the plan
+	repos        map[string]bool // repositories that only exist in the plan
+	issueNumbers map[string]int  // last issue number handed out per repository
+	issues       map[string]bool // issues and pull requests that only exist in the plan
+}
+
+// NewPlan creates an empty plan
+func NewPlan() *Plan {
+	return &Plan{
+		Actions:      []PlanAction{},
+		Collisions:   []NameCollision{},
+		owners:       map[string]bool{},
+		repos:        map[string]bool{},
+		issueNumbers: map[string]int{},
+		issues:       map[string]bool{},
+	}
+}
+
+// Add records a planned action
+func (p *Plan) Add(kind, target, source, details string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.Actions = append(p.Actions, PlanAction{
+		Kind:    kind,
+		Target:  target,
+		Source:  source,
+		Details: details,
+	})
+}
+
+// addOwner records a user or organization that the plan creates
+func (p *Plan) addOwner(name string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.owners[strings.ToLower(name)] = true
+}
+
+// hasOwner reports whether a user or organization only exists in the plan
+func (p *Plan) hasOwner(name string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.owners[strings.ToLower(name)]
+}
+
+// addRepo records a repository that the plan creates
+func (p *Plan) addRepo(owner, repo string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.repos[strings.ToLower(owner+"/"+repo)] = true
+}
+
+// hasRepo reports whether a repository only exists in the plan
+func (p *Plan) hasRepo(owner, repo string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.repos[strings.ToLower(owner+"/"+repo)]
+}
+
+// seedIssueNumber sets the last issue number already used in a repository
+func (p *Plan) seedIssueNumber(owner, repo string, last int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	key := strings.ToLower(owner + "/" + repo)
+	if last > p.issueNumbers[key] {
+		p.issueNumbers[key] = last
+	}
+}
+
+// nextIssueNumber hands out the number Gitea would give the next issue or pull request
+func (p *Plan) nextIssueNumber(owner, repo string) int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	key := strings.ToLower(owner + "/" + repo)
+	p.issueNumbers[key]++
+	p.issues[fmt.Sprintf("%s#%d", key, p.issueNumbers[key])] = true
+	return p.issueNumbers[key]
+}
+
+// hasIssue reports whether an issue or pull request only exists in the plan
+func (p *Plan) hasIssue(owner, repo string, number int) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.issues[fmt.Sprintf("%s#%d", strings.ToLower(owner+"/"+repo), number)]
+}
+
+// Counts returns the number of planned actions per kind
+func (p *Plan) Counts() map[string]int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	counts := make(map[string]int)
+	for _, action := range p.Actions {
+		counts[action.Kind]++
+	}
+	return counts
+}
+
+// Summary returns a human-readable summary of the plan
+func (p *Plan) Summary() string {
+	counts := p.Counts()
+
+	kinds := make([]string, 0, len(counts))
+	for kind := range counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	var b strings.Builder
+	fmt.Fprintln(&b, "Migration plan")
+	fmt.Fprintln(&b, "==============")
+	fmt.Fprintln(&b)
+	if len(kinds) == 0 {
+		fmt.Fprintln(&b, "Nothing to do.")
+	}
+	for _, kind := range kinds {
+		fmt.Fprintf(&b, "%-20s %d\n", kind, counts[kind])
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	fmt.Fprintln(&b)
+	fmt.Fprintf(&b, "Name collisions: %d\n", len(p.Collisions))
+	for _, collision := range p.Collisions {
+		fmt.Fprintf(&b, "  %s %q <- %s\n", collision.Kind, collision.Name, strings.Join(collision.Sources, ", "))
+	}
+
+	return b.String()
+}
+
+// Write saves the plan as JSON to filePath and its summary next to it with a .txt extension
+func (p *Plan) Write(filePath string) error {
+	p.mutex.Lock()
+	data, err := json.MarshalIndent(p, "", "  ")
+	p.mutex.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal plan: %w", err)
+	}
+
+	if err := os.WriteFile(filePath, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write plan file: %w", err)
+	}
+
+	summaryPath := strings.TrimSuffix(filePath, ".json") + ".txt"
+	if err := os.WriteFile(summaryPath, []byte(p.Summary()), 0o644); err != nil {
+		return fmt.Errorf("failed to write plan summary: %w", err)
+	}
+
+	return nil
+}
+
+// Plan returns the plan recorded by a dry run, or nil for a real migration
+func (m *Manager) Plan() *Plan {
+	return m.plan
+}
+
+// plannedRepo reports whether a repository only exists in the plan, in which case
+// nothing inside it exists in Gitea yet and it must not be queried
+func (m *Manager) plannedRepo(owner, repo string) bool {
+	return m.plan != nil && m.plan.hasRepo(owner, repo)
+}
+
+// plannedIssue reports whether an issue or pull request only exists in the plan
+func (m *Manager) plannedIssue(owner, repo string, number int) bool {
+	return m.plan != nil && m.plan.hasIssue(owner, repo, number)
+}
+
+// reportNameCollisions warns about GitLab users, groups and projects whose normalized
+// names clashed in Gitea and were disambiguated, and records them in the plan of a dry run
+func (m *Manager) reportNameCollisions(collisions []NameCollision) {
+	if m.plan != nil {
+		m.plan.mutex.Lock()
+		m.plan.Collisions = collisions
+		m.plan.mutex.Unlock()
+	}
+
+	for _, collision := range collisions {
+		m.log.PrintWarning(fmt.Sprintf("Name collision: %s %q <- %s",
+			collision.Kind, collision.Name, strings.Join(collision.Sources, ", ")))
+	}
+}
@@ -0,0 +1,395 @@
+// pulls.go
+
+// Package migration handles the migration of data from GitLab to Gitea
+package migration
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/go-i2p/gitlab-to-gitea/gitea"
+)
+
+// importProjectMergeRequests imports GitLab merge requests to Gitea as pull requests.
+// mirror tells whether the repository was set up as a pull mirror, which cannot be pushed to.
+func (m *Manager) importProjectMergeRequests(mergeRequests []*gitlab.MergeRequest, owner, repo string, projectID int, mirror bool) error {
+	var existingMilestones []*gitea.Milestone
+	var existingLabels []*gitea.Label
+	var existingPulls []*gitea.PullRequest
+	var existingIssues []*gitea.Issue
+
+	if !m.plannedRepo(owner, repo) {
+		var err error
+
+		// Get existing milestones and labels for reference
+		existingMilestones, err = m.giteaClient.ListMilestones(owner, repo)
+		if err != nil {
+			m.log.PrintWarning(fmt.Sprintf("Error fetching milestones: %v", err))
+		}
+
+		existingLabels, err = m.giteaClient.ListLabels(owner, repo)
+		if err != nil {
+			m.log.PrintWarning(fmt.Sprintf("Error fetching labels: %v", err))
+		}
+
+		// Get existing pull requests and issues to avoid duplicates
+		existingPulls, err = m.giteaClient.ListPullRequests(owner, repo)
+		if err != nil {
+			m.log.PrintWarning(fmt.Sprintf("Error fetching existing pull requests: %v", err))
+		}
+
+		existingIssues, err = m.giteaClient.ListIssues(owner, repo, gitea.ListIssuesOptions{State: "all", Type: "issues"})
+		if err != nil {
+			m.log.PrintWarning(fmt.Sprintf("Error fetching existing issues: %v", err))
+		}
+
+		// A repository that existed before the migration is whatever Gitea says it is
+		if repository, err := m.giteaClient.GetRepo(owner, repo); err == nil {
+			mirror = repository.Mirror
+		}
+	}
+
+	// Import in GitLab order, so references to earlier merge requests find their pull request
+	sorted := make([]*gitlab.MergeRequest, len(mergeRequests))
+	copy(sorted, mergeRequests)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].IID < sorted[j].IID })
+
+	repoKey := fmt.Sprintf("%s/%s", owner, repo)
+	var failures stageErrors
+	for _, mr := range sorted {
+		// A merge request lands either as a pull request or, when that is impossible, as an issue
+		if number, exists := existingMergeRequestNumber(mr, existingPulls, existingIssues); exists {
+			m.log.PrintWarning(fmt.Sprintf("Merge request !%d already exists in project %s, importing comments only", mr.IID, repo))
+			m.state.SetMergeRequestNumber(repoKey, mr.IID, number)
+			if err := m.importMergeRequestComments(mr, owner, repo, number, projectID); err != nil {
+				m.log.PrintWarning(fmt.Sprintf("Error importing comments: %v", err))
+				failures.add(err)
+			}
+			continue
+		}
+
+		number, err := m.importMergeRequest(mr, owner, repo, mirror, existingMilestones, existingLabels)
+		if err != nil {
+			m.log.PrintError(fmt.Sprintf("Merge request !%d import failed: %v", mr.IID, err))
+			failures.add(err)
+			continue
+		}
+
+		m.state.SetMergeRequestNumber(repoKey, mr.IID, number)
+		if err := m.state.Save(); err != nil {
+			m.log.PrintWarning(fmt.Sprintf("Failed to save migration state: %v", err))
+		}
+
+		if err := m.importMergeRequestComments(mr, owner, repo, number, projectID); err != nil {
+			m.log.PrintWarning(fmt.Sprintf("Error importing comments: %v", err))
+			failures.add(err)
+		}
+	}
+
+	return failures.err("merge requests")
+}
+
+// importMergeRequest creates a single pull request for a GitLab merge request and returns its number.
+// If no pull request can be opened, for example because the target branch is gone or the head
+// commit cannot be restored, the merge request is recorded as an issue instead so its
+// discussion is not lost.
+func (m *Manager) importMergeRequest(
+	mr *gitlab.MergeRequest,
+	owner, repo string,
+	mirror bool,
+	existingMilestones []*gitea.Milestone,
+	existingLabels []*gitea.Label,
+) (int, error) {
+	// Process assignees
+	var assignee string
+	var assignees []string
+
+	if mr.Assignee != nil {
+		assignee = m.userName(mr.Assignee.Username)
+	}
+
+	for _, a := range mr.Assignees {
+		assignees = append(assignees, m.userName(a.Username))
+	}
+
+	var milestoneID int64
+	if mr.Milestone != nil {
+		milestoneID = findMilestoneID(existingMilestones, mr.Milestone.Title)
+	}
+	labelIDs := findLabelIDs(existingLabels, mr.Labels)
+
+	body := m.mergeRequestBody(mr, m.rewriteMarkdown(mr.Description))
+
+	head, err := m.mergeRequestHead(mr, owner, repo, mirror)
+	if err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Cannot open pull request for merge request !%d, importing it as an issue: %v", mr.IID, err))
+		return m.importMergeRequestAsIssue(mr, owner, repo, body, err, assignee, assignees, milestoneID, labelIDs)
+	}
+
+	pullReq := gitea.CreatePullRequestOption{
+		Assignee:  assignee,
+		Assignees: assignees,
+		Base:      mr.TargetBranch,
+		Body:      body,
+		Head:      head,
+		Labels:    labelIDs,
+		Milestone: milestoneID,
+		Title:     mr.Title,
+	}
+
+	if m.plan != nil {
+		number := m.plan.nextIssueNumber(owner, repo)
+		target := fmt.Sprintf("%s/%s#%d", owner, repo, number)
+		m.plan.Add(PlanPullRequest, target, fmt.Sprintf("!%d", mr.IID),
+			fmt.Sprintf("%s -> %s (%s)", head, mr.TargetBranch, mr.State))
+		m.planUploads(target, body)
+		return number, nil
+	}
+
+	result, err := m.giteaClient.CreatePullRequest(owner, repo, pullReq)
+	if err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Pull request creation for merge request !%d failed, importing it as an issue: %v", mr.IID, err))
+		return m.importMergeRequestAsIssue(mr, owner, repo, body, err, assignee, assignees, milestoneID, labelIDs)
+	}
+
+	number := result.Number
+	m.log.PrintInfo(fmt.Sprintf("Merge request !%d imported as pull request #%d!", mr.IID, number))
+	m.importIssueUploads(owner, repo, number, result.Body)
+	m.deferLinks(linkedBody{number: number}, mr.Description)
+
+	// Merged and closed merge requests cannot be merged again, so close them
+	if mr.State != "opened" {
+		_, err = m.giteaClient.EditPullRequest(owner, repo, number, gitea.EditPullRequestOption{State: "closed"})
+		if err != nil {
+			m.log.PrintWarning(fmt.Sprintf("Failed to close pull request #%d: %v", number, err))
+		} else if head == restoredBranch(mr) && head != mr.SourceBranch {
+			// Gitea keeps the commits of the pull request, so the restored branch is not needed
+			if err := m.giteaClient.DeleteBranch(owner, repo, head); err != nil {
+				m.log.PrintWarning(fmt.Sprintf("Failed to delete branch %s: %v", head, err))
+			}
+		}
+	}
+
+	return number, nil
+}
+
+// importMergeRequestAsIssue records a merge request as a Gitea issue when no pull request can be
+// created. The body starts with why, followed by the header of the pull request, so a merge
+// request merged in GitLab still says so.
+func (m *Manager) importMergeRequestAsIssue(
+	mr *gitlab.MergeRequest,
+	owner, repo, body string,
+	reason error,
+	assignee string,
+	assignees []string,
+	milestoneID int64,
+	labelIDs []int64,
+) (int, error) {
+	body = fmt.Sprintf("_Migrated as an issue, as no pull request could be opened: %v_\n\n%s", reason, body)
+
+	issueReq := gitea.CreateIssueOption{
+		Assignee:  assignee,
+		Assignees: assignees,
+		Body:      body,
+		Closed:    mr.State != "opened",
+		Labels:    labelIDs,
+		Milestone: milestoneID,
+		Title:     mergeRequestFallbackTitle(mr),
+	}
+
+	if m.plan != nil {
+		number := m.plan.nextIssueNumber(owner, repo)
+		target := fmt.Sprintf("%s/%s#%d", owner, repo, number)
+		m.plan.Add(PlanIssue, target, fmt.Sprintf("!%d", mr.IID), issueReq.Title)
+		m.planUploads(target, body)
+		return number, nil
+	}
+
+	result, err := m.giteaClient.CreateIssue(owner, repo, issueReq)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create issue for merge request !%d: %w", mr.IID, err)
+	}
+
+	number := result.Number
+	m.log.PrintInfo(fmt.Sprintf("Merge request !%d imported as issue #%d!", mr.IID, number))
+	m.importIssueUploads(owner, repo, number, result.Body)
+	m.deferLinks(linkedBody{number: number}, mr.Description)
+	return number, nil
+}
+
+// mergeRequestHead returns the Gitea branch to use as the head of a merge request's pull request.
+// Source branches that were deleted after merging, or that live in a fork, are recreated from
+// the merge request's head commit under a gitlab-mr-<iid> branch name. This fails when the
+// commit is no longer in the repository, as after squashing, and in mirrors, which cannot be
+// pushed to.
+func (m *Manager) mergeRequestHead(mr *gitlab.MergeRequest, owner, repo string, mirror bool) (string, error) {
+	if exists, err := m.branchExists(owner, repo, mr.TargetBranch); err != nil {
+		return "", fmt.Errorf("failed to check target branch %s: %w", mr.TargetBranch, err)
+	} else if !exists {
+		return "", fmt.Errorf("target branch %s does not exist", mr.TargetBranch)
+	}
+
+	if mr.SourceProjectID == mr.TargetProjectID {
+		if exists, err := m.branchExists(owner, repo, mr.SourceBranch); err != nil {
+			return "", fmt.Errorf("failed to check source branch %s: %w", mr.SourceBranch, err)
+		} else if exists {
+			return mr.SourceBranch, nil
+		}
+	}
+
+	head := restoredBranch(mr)
+	if exists, err := m.branchExists(owner, repo, head); err != nil {
+		return "", fmt.Errorf("failed to check branch %s: %w", head, err)
+	} else if exists {
+		return head, nil
+	}
+
+	if mr.SHA == "" {
+		return "", fmt.Errorf("source branch %s is gone and the head commit is unknown", mr.SourceBranch)
+	}
+	if mirror {
+		return "", fmt.Errorf("source branch %s is not in the repository, which is a pull mirror", mr.SourceBranch)
+	}
+
+	if m.plan != nil {
+		m.plan.Add(PlanBranch, fmt.Sprintf("%s/%s:%s", owner, repo, head), fmt.Sprintf("!%d", mr.IID), mr.SHA)
+		return head, nil
+	}
+
+	_, err := m.giteaClient.CreateBranch(owner, repo, gitea.CreateBranchOption{
+		NewBranchName: head,
+		OldRefName:    mr.SHA,
+	})
+	if gitea.IsConflict(err) {
+		return head, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to restore branch %s at %s: %w", head, mr.SHA, err)
+	}
+
+	m.log.PrintInfo(fmt.Sprintf("Restored source of merge request !%d as branch %s", mr.IID, head))
+	return head, nil
+}
+
+// importMergeRequestComments imports the discussion notes of a GitLab merge request
+func (m *Manager) importMergeRequestComments(
+	mr *gitlab.MergeRequest,
+	owner, repo string,
+	giteaNumber, projectID int,
+) error {
+	notes, err := m.gitlabClient.GetMergeRequestNotes(projectID, mr.IID)
+	if err != nil {
+		return fmt.Errorf("failed to get merge request notes: %w", err)
+	}
+
+	commentKey := fmt.Sprintf("%s/%s/pulls/%d", owner, repo, giteaNumber)
+	return m.importNotes(notes, commentKey, owner, repo, giteaNumber)
+}
+
+// branchExists checks if a branch exists in a repository
+func (m *Manager) branchExists(owner, repo, branch string) (bool, error) {
+	// A planned repository is a clone of GitLab, so assume its branches are there
+	if m.plannedRepo(owner, repo) {
+		return true, nil
+	}
+
+	_, err := m.giteaClient.GetBranch(owner, repo, branch)
+	if err != nil {
+		if gitea.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error checking if branch exists: %w", err)
+	}
+	return true, nil
+}
+
+// mergeRequestBody builds the pull request description from the rewritten description,
+// attributing the original author and marking merge requests that were already merged in GitLab
+func (m *Manager) mergeRequestBody(mr *gitlab.MergeRequest, description string) string {
+	var header []string
+
+	if mr.Author != nil {
+		header = append(header, fmt.Sprintf("_Originally opened by @%s in GitLab as !%d (`%s` → `%s`)_",
+			m.userName(mr.Author.Username), mr.IID, mr.SourceBranch, mr.TargetBranch))
+	}
+
+	if mr.State == "merged" {
+		marker := "**Merged in GitLab**"
+		if mr.MergedBy != nil {
+			marker += fmt.Sprintf(" by @%s", m.userName(mr.MergedBy.Username))
+		}
+		if mr.MergedAt != nil {
+			marker += fmt.Sprintf(" on %s", mr.MergedAt.Format(time.RFC3339))
+		}
+		if sha := mergeRequestMergeCommit(mr); sha != "" {
+			marker += fmt.Sprintf(" as %s", sha)
+		}
+		header = append(header, marker)
+	}
+
+	if len(header) == 0 {
+		return description
+	}
+
+	return strings.Join(header, "\n\n") + "\n\n---\n\n" + description
+}
+
+// mergeRequestMergeCommit returns the commit a merged merge request landed as
+func mergeRequestMergeCommit(mr *gitlab.MergeRequest) string {
+	if mr.MergeCommitSHA != "" {
+		return mr.MergeCommitSHA
+	}
+	return mr.SquashCommitSHA
+}
+
+// restoredBranch returns the name of the branch a merge request's head commit is restored as
+func restoredBranch(mr *gitlab.MergeRequest) string {
+	return fmt.Sprintf("gitlab-mr-%d", mr.IID)
+}
+
+// mergeRequestFallbackTitle returns the issue title used when a merge request cannot become a pull request
+func mergeRequestFallbackTitle(mr *gitlab.MergeRequest) string {
+	return fmt.Sprintf("[MR !%d] %s", mr.IID, mr.Title)
+}
+
+// existingMergeRequestNumber returns the Gitea number of a merge request that was already
+// imported, either as a pull request or as a fallback issue
+func existingMergeRequestNumber(mr *gitlab.MergeRequest, pulls []*gitea.PullRequest, issues []*gitea.Issue) (int, bool) {
+	for _, pr := range pulls {
+		if pr.Title == mr.Title {
+			return pr.Number, true
+		}
+	}
+	if exists, issue := issueExists(issues, mergeRequestFallbackTitle(mr)); exists {
+		return issue.Number, true
+	}
+	return 0, false
+}
+
+// findMilestoneID returns the ID of the Gitea milestone with the given title, or 0
+func findMilestoneID(milestones []*gitea.Milestone, title string) int64 {
+	for _, m := range milestones {
+		if m.Title == title {
+			return m.ID
+		}
+	}
+	return 0
+}
+
+// findLabelIDs returns the IDs of the Gitea labels matching the given names
+func findLabelIDs(labels []*gitea.Label, names []string) []int64 {
+	var ids []int64
+	for _, name := range names {
+		for _, l := range labels {
+			if l.Name == name {
+				ids = append(ids, l.ID)
+				break
+			}
+		}
+	}
+	return ids
+}
@@ -0,0 +1,235 @@
+// releases.go
+
+// Package migration handles the migration of data from GitLab to Gitea
+package migration
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/go-i2p/gitlab-to-gitea/gitea"
+)
+
+// importProjectReleases imports GitLab releases as Gitea releases. Asset links pointing
+// into GitLab, such as uploads and package files, are downloaded and attached to the
+// release; links to other servers are listed in the release notes.
+func (m *Manager) importProjectReleases(releases []*gitlab.Release, owner, repo string) error {
+	projectKey := fmt.Sprintf("%s/%s", owner, repo)
+
+	var existingReleases []*gitea.Release
+	if !m.plannedRepo(owner, repo) {
+		var err error
+		existingReleases, err = m.giteaClient.ListReleases(owner, repo)
+		if err != nil {
+			return fmt.Errorf("failed to get existing releases: %w", err)
+		}
+	}
+
+	// Create the oldest release first, so Gitea lists them in the same order as GitLab
+	sorted := make([]*gitlab.Release, len(releases))
+	copy(sorted, releases)
+	sort.Slice(sorted, func(i, j int) bool { return releaseTime(sorted[i]).Before(releaseTime(sorted[j])) })
+
+	var failures stageErrors
+	for _, release := range sorted {
+		if m.state.HasImportedRelease(projectKey, release.TagName) {
+			m.log.PrintWarning(fmt.Sprintf("Release %s already imported, skipping", release.TagName))
+			continue
+		}
+
+		giteaRelease := findRelease(existingReleases, release.TagName)
+		if giteaRelease != nil {
+			m.log.PrintWarning(fmt.Sprintf("Release %s already exists in project %s, updating it", release.TagName, repo))
+			if err := m.updateRelease(release, giteaRelease, owner, repo); err != nil {
+				m.log.PrintError(fmt.Sprintf("Release %s update failed: %v", release.TagName, err))
+				failures.add(err)
+				continue
+			}
+		} else if m.plan != nil {
+			m.plan.Add(PlanRelease, projectKey, release.TagName, release.Name)
+		} else {
+			var err error
+			giteaRelease, err = m.giteaClient.CreateRelease(owner, repo, gitea.CreateReleaseOption{
+				TagName:    release.TagName,
+				Target:     release.Commit.ID,
+				Name:       release.Name,
+				Body:       releaseBody(release, m.rewriteMarkdown(release.Description)),
+				Prerelease: release.UpcomingRelease,
+			})
+			if err != nil {
+				m.log.PrintError(fmt.Sprintf("Release %s import failed: %v", release.TagName, err))
+				failures.add(err)
+				continue
+			}
+			m.log.PrintInfo(fmt.Sprintf("Release %s imported!", release.TagName))
+
+			if m.giteaDB != nil {
+				if err := m.giteaDB.SetReleaseTime(giteaRelease.ID, releaseTime(release)); err != nil {
+					m.log.PrintWarning(fmt.Sprintf("Failed to set time of release %s: %v", release.TagName, err))
+				}
+			}
+		}
+
+		if !m.importReleaseAssets(release, giteaRelease, owner, repo) {
+			failures.add(fmt.Errorf("assets of release %s are missing", release.TagName))
+			continue
+		}
+
+		if m.plan == nil {
+			m.state.MarkReleaseImported(projectKey, release.TagName)
+			if err := m.state.Save(); err != nil {
+				m.log.PrintWarning(fmt.Sprintf("Failed to save migration state: %v", err))
+			}
+		}
+	}
+
+	return failures.err("releases")
+}
+
+// updateRelease brings the name, notes and prerelease flag of a release that already exists
+// in Gitea in line with GitLab, and sets its publication date
+func (m *Manager) updateRelease(release *gitlab.Release, giteaRelease *gitea.Release, owner, repo string) error {
+	projectKey := fmt.Sprintf("%s/%s", owner, repo)
+
+	var opt gitea.EditReleaseOption
+	var changes []string
+	if release.Name != giteaRelease.Name {
+		opt.Name = release.Name
+		changes = append(changes, "name")
+	}
+	if body := releaseBody(release, m.rewriteMarkdown(release.Description)); body != giteaRelease.Body {
+		opt.Body = body
+		changes = append(changes, "notes")
+	}
+	if release.UpcomingRelease != giteaRelease.Prerelease {
+		opt.Prerelease = &release.UpcomingRelease
+		changes = append(changes, "prerelease")
+	}
+
+	if m.plan != nil {
+		if len(changes) > 0 {
+			m.plan.Add(PlanRelease, projectKey, release.TagName, "update "+strings.Join(changes, ", "))
+		}
+		return nil
+	}
+
+	if len(changes) > 0 {
+		if _, err := m.giteaClient.EditRelease(owner, repo, giteaRelease.ID, opt); err != nil {
+			return fmt.Errorf("failed to update release %s: %w", release.TagName, err)
+		}
+		m.log.PrintInfo(fmt.Sprintf("Release %s updated: %s", release.TagName, strings.Join(changes, ", ")))
+	}
+
+	if m.giteaDB != nil {
+		if err := m.giteaDB.SetReleaseTime(giteaRelease.ID, releaseTime(release)); err != nil {
+			m.log.PrintWarning(fmt.Sprintf("Failed to set time of release %s: %v", release.TagName, err))
+		}
+	}
+	return nil
+}
+
+// importReleaseAssets attaches the GitLab-hosted asset files of a release that are not
+// attached yet. It reports whether every asset is attached.
+func (m *Manager) importReleaseAssets(release *gitlab.Release, giteaRelease *gitea.Release, owner, repo string) bool {
+	complete := true
+
+	for _, link := range release.Assets.Links {
+		if link.External {
+			continue
+		}
+
+		name := releaseAssetName(link)
+		if giteaRelease != nil && hasAttachment(giteaRelease.Attachments, name) {
+			continue
+		}
+
+		// Releases that only exist in the plan have no Gitea counterpart
+		if m.plan != nil {
+			m.plan.Add(PlanReleaseAsset, fmt.Sprintf("%s/%s@%s", owner, repo, release.TagName), link.URL, name)
+			continue
+		}
+
+		content, err := m.gitlabClient.Download(releaseAssetURL(link))
+		if err != nil {
+			m.log.PrintError(fmt.Sprintf("Failed to download asset %s of release %s: %v", name, release.TagName, err))
+			complete = false
+			continue
+		}
+
+		if _, err := m.giteaClient.CreateReleaseAttachment(owner, repo, giteaRelease.ID, name, content); err != nil {
+			m.log.PrintError(fmt.Sprintf("Failed to attach asset %s to release %s: %v", name, release.TagName, err))
+			complete = false
+			continue
+		}
+
+		m.log.PrintInfo(fmt.Sprintf("Asset %s attached to release %s", name, release.TagName))
+	}
+
+	return complete
+}
+
+// releaseBody builds the release notes from the rewritten description, listing asset links
+// that point outside of GitLab
+func releaseBody(release *gitlab.Release, body string) string {
+
+	var links []string
+	for _, link := range release.Assets.Links {
+		if link.External {
+			links = append(links, fmt.Sprintf("- [%s](%s)", link.Name, link.URL))
+		}
+	}
+	if len(links) == 0 {
+		return body
+	}
+
+	return strings.TrimSpace(body+"\n\n### Assets\n\n") + "\n\n" + strings.Join(links, "\n")
+}
+
+// releaseTime returns when a release was published, falling back to when it was created
+func releaseTime(release *gitlab.Release) time.Time {
+	if release.ReleasedAt != nil {
+		return *release.ReleasedAt
+	}
+	return timeOrZero(release.CreatedAt)
+}
+
+// releaseAssetURL returns the URL an asset link can be downloaded from
+func releaseAssetURL(link *gitlab.ReleaseLink) string {
+	if link.DirectAssetURL != "" {
+		return link.DirectAssetURL
+	}
+	return link.URL
+}
+
+// releaseAssetName returns the file name an asset is attached as
+func releaseAssetName(link *gitlab.ReleaseLink) string {
+	if link.Name != "" {
+		return link.Name
+	}
+	return path.Base(link.URL)
+}
+
+// findRelease returns the Gitea release of a tag, or nil
+func findRelease(releases []*gitea.Release, tag string) *gitea.Release {
+	for _, release := range releases {
+		if release.TagName == tag {
+			return release
+		}
+	}
+	return nil
+}
+
+// hasAttachment reports whether a file with the given name is attached
+func hasAttachment(attachments []*gitea.Attachment, name string) bool {
+	for _, attachment := range attachments {
+		if attachment.Name == name {
+			return true
+		}
+	}
+	return false
+}
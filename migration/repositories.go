@@ -5,178 +5,316 @@ package migration
 
 import (
 	"fmt"
+	"net/url"
+	"strings"
 
 	"github.com/xanzy/go-gitlab"
 
+	"github.com/go-i2p/gitlab-to-gitea/gitea"
 	"github.com/go-i2p/gitlab-to-gitea/utils"
 )
 
-// repositoryMigrateRequest represents the data needed to migrate a repository to Gitea
-type repositoryMigrateRequest struct {
-	AuthPassword string `json:"auth_password"`
-	AuthUsername string `json:"auth_username"`
-	CloneAddr    string `json:"clone_addr"`
-	Description  string `json:"description"`
-	Mirror       bool   `json:"mirror"`
-	Private      bool   `json:"private"`
-	RepoName     string `json:"repo_name"`
-	UID          int    `json:"uid"`
+// repoOwner identifies the Gitea user or organization that owns a migrated repository
+type repoOwner struct {
+	Name  string
+	ID    int64
+	IsOrg bool
 }
 
-// ImportProject imports a GitLab project to Gitea
 // ImportProject imports a GitLab project to Gitea
 func (m *Manager) ImportProject(project *gitlab.Project) error {
-	cleanName := utils.CleanName(project.Name)
+	_, cleanName := m.projectName(project)
 
-	utils.PrintInfo(fmt.Sprintf("Importing project %s from owner %s", cleanName, project.Namespace.Name))
+	m.log.PrintInfo(fmt.Sprintf("Importing project %s from owner %s", cleanName, project.Namespace.Name))
 
 	// Get the owner information first, so we use the correct name format
 	ownerInfo, err := m.getOwner(project)
 	if err != nil {
 		return fmt.Errorf("failed to get project owner: %w", err)
 	}
+	owner := ownerInfo.Name
+
+	m.log.PrintInfo(fmt.Sprintf("Using owner %s for project %s", owner, cleanName))
+
+	mirror := m.config.Mirror.Mirrored(project.PathWithNamespace)
+
+	// Create the repository; the other stages need it
+	if !m.runStage(project, StageRepository, func() error {
+		// Check if repository already exists
+		if exists, err := m.repoExists(owner, cleanName); err != nil {
+			return fmt.Errorf("failed to check if repository exists: %w", err)
+		} else if exists {
+			m.log.PrintWarning(fmt.Sprintf("Project %s already exists in Gitea, skipping repository creation!", cleanName))
+		} else {
+			// Prepare clone URL
+			cloneURL := project.HTTPURLToRepo
+			if m.config.GitLabAdminUser == "" && m.config.GitLabAdminPass == "" {
+				cloneURL = project.SSHURLToRepo
+			}
 
-	// Get the correct owner username from the result
-	owner, ok := ownerInfo["username"].(string)
-	if !ok || owner == "" {
-		return fmt.Errorf("failed to get valid username for project owner")
-	}
-
-	utils.PrintInfo(fmt.Sprintf("Using owner %s for project %s", owner, cleanName))
-
-	// Check if repository already exists
-	if exists, err := m.repoExists(owner, cleanName); err != nil {
-		return fmt.Errorf("failed to check if repository exists: %w", err)
-	} else if exists {
-		utils.PrintWarning(fmt.Sprintf("Project %s already exists in Gitea, skipping repository creation!", cleanName))
-	} else {
-		// Prepare clone URL
-		cloneURL := project.HTTPURLToRepo
-		if m.config.GitLabAdminUser == "" && m.config.GitLabAdminPass == "" {
-			cloneURL = project.SSHURLToRepo
-		}
+			// Determine visibility
+			private := project.Visibility == "private" || project.Visibility == "internal"
+
+			// Create migration request
+			migrateReq := gitea.MigrateRepoOption{
+				AuthPassword: m.config.GitLabAdminPass,
+				AuthUsername: m.config.GitLabAdminUser,
+				CloneAddr:    cloneURL,
+				Description:  project.Description,
+				Mirror:       false,
+				Private:      private,
+				RepoName:     cleanName,
+				UID:          ownerInfo.ID,
+			}
+			details := fmt.Sprintf("private=%t", private)
+
+			// Gitea pulls mirrors over HTTP with credentials of their own, and keeps the
+			// wiki mirrored along with the code
+			if mirror {
+				migrateReq.AuthPassword = m.config.Mirror.AuthPassword
+				migrateReq.AuthUsername = m.config.Mirror.AuthUsername
+				migrateReq.CloneAddr = project.HTTPURLToRepo
+				migrateReq.Mirror = true
+				migrateReq.MirrorInterval = m.config.Mirror.Interval
+				migrateReq.Wiki = m.config.MigrateWikis && project.WikiEnabled
+				details += fmt.Sprintf(" mirror=true interval=%s", m.config.Mirror.Interval)
+			}
 
-		// Determine visibility
-		private := project.Visibility == "private" || project.Visibility == "internal"
+			// Gitea fetches the LFS objects along with the repository
+			if m.migrateLFS(project) {
+				migrateReq.LFS = true
+				migrateReq.LFSEndpoint = m.lfsEndpoint(project, migrateReq.CloneAddr)
+				details += " lfs=true"
+			}
 
-		// Create migration request
-		migrateReq := repositoryMigrateRequest{
-			AuthPassword: m.config.GitLabAdminPass,
-			AuthUsername: m.config.GitLabAdminUser,
-			CloneAddr:    cloneURL,
-			Description:  project.Description,
-			Mirror:       false,
-			Private:      private,
-			RepoName:     cleanName,
-			UID:          int(ownerInfo["id"].(float64)),
+			if m.plan != nil {
+				m.plan.Add(PlanRepository, owner+"/"+cleanName, project.PathWithNamespace, details)
+				m.plan.addRepo(owner, cleanName)
+			} else {
+				// Call Gitea API to migrate repository
+				repository, err := m.giteaClient.MigrateRepo(migrateReq)
+				if gitea.IsConflict(err) {
+					// Another run created the repository since we checked
+					m.log.PrintWarning(fmt.Sprintf("Project %s already exists in Gitea, skipping repository creation!", cleanName))
+				} else if err != nil {
+					return fmt.Errorf("failed to migrate repository %s: %w", cleanName, err)
+				} else {
+					m.recordGiteaID(IdentityProject, project.ID, repository.ID)
+					m.log.PrintInfo(fmt.Sprintf("Project %s imported!", cleanName))
+				}
+			}
 		}
+		return nil
+	}) {
+		return fmt.Errorf("failed to import repository %s", cleanName)
+	}
 
-		// Call Gitea API to migrate repository
-		var result map[string]interface{}
-		err = m.giteaClient.Post("/repos/migrate", migrateReq, &result)
-		if err != nil {
-			return fmt.Errorf("failed to migrate repository %s: %w", cleanName, err)
+	var incomplete []string
+	stage := func(name string, run func() error) {
+		if !m.runStage(project, name, run) {
+			incomplete = append(incomplete, name)
 		}
+	}
 
-		utils.PrintInfo(fmt.Sprintf("Project %s imported!", cleanName))
+	// Check that the LFS objects arrived
+	if m.migrateLFS(project) {
+		stage(StageLFS, func() error {
+			return m.verifyProjectLFS(project, owner, cleanName)
+		})
 	}
 
 	// Process collaborators
-	collaborators, err := m.gitlabClient.GetProjectMembers(project.ID)
-	if err != nil {
-		utils.PrintWarning(fmt.Sprintf("Error fetching collaborators for project %s: %v", project.Name, err))
-	} else {
-		utils.PrintInfo(fmt.Sprintf("Found %d collaborators for project %s", len(collaborators), cleanName))
+	stage(StageCollaborators, func() error {
+		// Members of the subgroups above the project get access through their teams
+		teamsErr := m.addProjectToTeams(project, owner, cleanName)
+
+		collaborators, err := m.gitlabClient.GetProjectMembers(project.ID)
+		if err != nil {
+			return fmt.Errorf("failed to fetch collaborators: %w", err)
+		}
+		m.log.PrintInfo(fmt.Sprintf("Found %d collaborators for project %s", len(collaborators), cleanName))
 		if err := m.importProjectCollaborators(collaborators, project); err != nil {
-			utils.PrintWarning(fmt.Sprintf("Error importing collaborators: %v", err))
+			return err
 		}
-	}
+		return teamsErr
+	})
 
 	// Process labels
-	labels, err := m.gitlabClient.GetProjectLabels(project.ID)
-	if err != nil {
-		utils.PrintWarning(fmt.Sprintf("Error fetching labels for project %s: %v", project.Name, err))
-	} else {
-		utils.PrintInfo(fmt.Sprintf("Found %d labels for project %s", len(labels), cleanName))
-		if err := m.importProjectLabels(labels, owner, cleanName); err != nil {
-			utils.PrintWarning(fmt.Sprintf("Error importing labels: %v", err))
+	stage(StageLabels, func() error {
+		labels, err := m.gitlabClient.GetProjectLabels(project.ID)
+		if err != nil {
+			return fmt.Errorf("failed to fetch labels: %w", err)
 		}
-	}
+		m.log.PrintInfo(fmt.Sprintf("Found %d labels for project %s", len(labels), cleanName))
+		return m.importProjectLabels(labels, owner, cleanName)
+	})
 
 	// Process milestones
-	milestones, err := m.gitlabClient.GetProjectMilestones(project.ID)
-	if err != nil {
-		utils.PrintWarning(fmt.Sprintf("Error fetching milestones for project %s: %v", project.Name, err))
-	} else {
-		utils.PrintInfo(fmt.Sprintf("Found %d milestones for project %s", len(milestones), cleanName))
-		if err := m.importProjectMilestones(milestones, owner, cleanName); err != nil {
-			utils.PrintWarning(fmt.Sprintf("Error importing milestones: %v", err))
+	stage(StageMilestones, func() error {
+		milestones, err := m.gitlabClient.GetProjectMilestones(project.ID)
+		if err != nil {
+			return fmt.Errorf("failed to fetch milestones: %w", err)
 		}
-	}
+		m.log.PrintInfo(fmt.Sprintf("Found %d milestones for project %s", len(milestones), cleanName))
+		return m.importProjectMilestones(milestones, owner, cleanName)
+	})
+
+	// Rewrite GitLab references in bodies, linking to the labels and milestones imported above
+	m.markdown = m.newMarkdownRewriter(project, owner, cleanName)
+	m.addMarkdownLinks(m.markdown, owner, cleanName)
+	m.linkedBodies = nil
 
 	// Process issues
-	issues, err := m.gitlabClient.GetProjectIssues(project.ID)
-	if err != nil {
-		utils.PrintWarning(fmt.Sprintf("Error fetching issues for project %s: %v", project.Name, err))
-	} else {
-		utils.PrintInfo(fmt.Sprintf("Found %d issues for project %s", len(issues), cleanName))
+	stage(StageIssues, func() error {
+		issues, err := m.gitlabClient.GetProjectIssues(project.ID)
+		if err != nil {
+			return fmt.Errorf("failed to fetch issues: %w", err)
+		}
+		m.log.PrintInfo(fmt.Sprintf("Found %d issues for project %s", len(issues), cleanName))
 
 		// Ensure all mentioned users exist in Gitea
 		m.ensureMentionedUsersExist(issues)
 
-		if err := m.importProjectIssues(issues, owner, cleanName, project.ID); err != nil {
-			utils.PrintWarning(fmt.Sprintf("Error importing issues: %v", err))
+		return m.importProjectIssues(issues, owner, cleanName, project.ID)
+	})
+
+	// Process merge requests
+	stage(StageMergeRequests, func() error {
+		mergeRequests, err := m.gitlabClient.GetProjectMergeRequests(project.ID)
+		if err != nil {
+			return fmt.Errorf("failed to fetch merge requests: %w", err)
 		}
+		m.log.PrintInfo(fmt.Sprintf("Found %d merge requests for project %s", len(mergeRequests), cleanName))
+		return m.importProjectMergeRequests(mergeRequests, owner, cleanName, project.ID, mirror)
+	})
+
+	// Bodies written before the issues and merge requests they reference were imported
+	// keep those references as in GitLab until now; they stay if they cannot be resolved
+	if err := m.resolveDeferredLinks(owner, cleanName); err != nil {
+		m.log.PrintWarning(fmt.Sprintf("References of project %s left unresolved: %v", cleanName, err))
 	}
 
+	// Process releases
+	stage(StageReleases, func() error {
+		releases, err := m.gitlabClient.GetProjectReleases(project.ID)
+		if err != nil {
+			return fmt.Errorf("failed to fetch releases: %w", err)
+		}
+		m.log.PrintInfo(fmt.Sprintf("Found %d releases for project %s", len(releases), cleanName))
+		return m.importProjectReleases(releases, owner, cleanName)
+	})
+
+	// Process wiki; a mirror brings its wiki along
+	if m.config.MigrateWikis && !mirror {
+		stage(StageWiki, func() error {
+			return m.importProjectWiki(project, owner, cleanName)
+		})
+	}
+
+	if len(incomplete) > 0 {
+		return fmt.Errorf("incomplete stages: %s", strings.Join(incomplete, ", "))
+	}
 	return nil
 }
 
-// getOwner retrieves the user or organization info for a project
-func (m *Manager) getOwner(project *gitlab.Project) (map[string]interface{}, error) {
-	namespacePath := utils.NormalizeUsername(project.Namespace.Path)
+// getOwner retrieves the user or organization that owns a project in Gitea
+func (m *Manager) getOwner(project *gitlab.Project) (*repoOwner, error) {
+	namespacePath := m.userName(project.Namespace.Path)
+	orgName := utils.CleanName(project.Namespace.Name)
+	if project.Namespace.Kind != "user" {
+		orgName = m.namespaceName(project.Namespace)
+	}
 
-	// Try to get as a user first
-	var result map[string]interface{}
-	err := m.giteaClient.Get("/users/"+namespacePath, &result)
-	if err == nil && result != nil {
-		// Verify required fields exist
-		if username, ok := result["username"].(string); ok && username != "" {
-			return result, nil
+	// Owners that only exist in the plan cannot be fetched, so stand in for them
+	if m.plan != nil {
+		if project.Namespace.Kind != "user" && m.plan.hasOwner(orgName) {
+			return &repoOwner{Name: orgName, IsOrg: true}, nil
+		}
+		if m.plan.hasOwner(namespacePath) {
+			return &repoOwner{Name: namespacePath}, nil
+		}
+		if m.plan.hasOwner(orgName) {
+			return &repoOwner{Name: orgName, IsOrg: true}, nil
 		}
 	}
 
-	// Try to get as an organization
-	orgName := utils.CleanName(project.Namespace.Name)
-	err = m.giteaClient.Get("/orgs/"+orgName, &result)
-	if err == nil && result != nil {
-		// Verify required fields exist
-		if username, ok := result["username"].(string); ok && username != "" {
-			return result, nil
+	// Projects of a group belong to its organization, even when a user has the group's path
+	if project.Namespace.Kind != "user" {
+		if owner, err := m.findOrgOwner(orgName); owner != nil || err != nil {
+			return owner, err
 		}
 	}
 
+	// Try to get as a user first
+	user, err := m.giteaClient.GetUser(namespacePath)
+	if err == nil && user.Login != "" {
+		return &repoOwner{Name: user.Login, ID: user.ID}, nil
+	} else if err != nil && !gitea.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to look up user %s: %w", namespacePath, err)
+	}
+
+	// Try to get as an organization
+	if owner, err := m.findOrgOwner(orgName); owner != nil || err != nil {
+		return owner, err
+	}
+
 	// Create a placeholder user instead of failing
-	utils.PrintWarning(fmt.Sprintf("Could not find owner for project %s, creating placeholder user", project.Name))
+	m.log.PrintWarning(fmt.Sprintf("Could not find owner for project %s, creating placeholder user", project.Name))
 	if err := m.ImportPlaceholderUser(namespacePath); err != nil {
 		return nil, fmt.Errorf("failed to create placeholder user: %w", err)
 	}
 
+	if m.plan != nil {
+		return &repoOwner{Name: namespacePath}, nil
+	}
+
 	// Try to get the newly created user
-	err = m.giteaClient.Get("/users/"+namespacePath, &result)
-	if err == nil && result != nil {
-		return result, nil
+	if user, err := m.giteaClient.GetUser(namespacePath); err == nil && user.Login != "" {
+		return &repoOwner{Name: user.Login, ID: user.ID}, nil
 	}
 
 	return nil, fmt.Errorf("failed to find or create owner for project: %s", project.Path)
 }
 
+// findOrgOwner looks up an organization as the owner of a project, returning nil if it
+// does not exist
+func (m *Manager) findOrgOwner(orgName string) (*repoOwner, error) {
+	org, err := m.giteaClient.GetOrg(orgName)
+	if err == nil && org.UserName != "" {
+		return &repoOwner{Name: org.UserName, ID: org.ID, IsOrg: true}, nil
+	} else if err != nil && !gitea.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to look up organization %s: %w", orgName, err)
+	}
+	return nil, nil
+}
+
+// gitlabRemote returns the URL git clones the repository of a project from, with the
+// GitLab admin credentials git authenticates with when they are configured
+func (m *Manager) gitlabRemote(project *gitlab.Project) (string, []utils.GitAuth) {
+	if m.config.GitLabAdminUser == "" && m.config.GitLabAdminPass == "" {
+		return project.SSHURLToRepo, nil
+	}
+
+	u, err := url.Parse(project.HTTPURLToRepo)
+	if err != nil {
+		return project.HTTPURLToRepo, nil
+	}
+	return project.HTTPURLToRepo, []utils.GitAuth{{
+		URL:      u.Scheme + "://" + u.Host + "/",
+		Username: m.config.GitLabAdminUser,
+		Password: m.config.GitLabAdminPass,
+	}}
+}
+
 // repoExists checks if a repository exists in Gitea
 func (m *Manager) repoExists(owner, repo string) (bool, error) {
-	var repository map[string]interface{}
-	err := m.giteaClient.Get(fmt.Sprintf("/repos/%s/%s", owner, repo), &repository)
+	if m.plannedRepo(owner, repo) {
+		return true, nil
+	}
+
+	_, err := m.giteaClient.GetRepo(owner, repo)
 	if err != nil {
-		if isNotFoundError(err) {
+		if gitea.IsNotFound(err) {
 			return false, nil
 		}
 		return false, fmt.Errorf("error checking if repository exists: %w", err)
@@ -191,7 +329,7 @@ func (m *Manager) ensureMentionedUsersExist(issues []*gitlab.Issue) {
 	// Extract mentions from issues
 	for _, issue := range issues {
 		if issue.Description != "" {
-			for _, mention := range utils.ExtractUserMentions(issue.Description) {
+			for _, mention := range m.mentions.Extract(issue.Description) {
 				mentionedUsers[mention] = struct{}{}
 			}
 		}
@@ -199,15 +337,15 @@ func (m *Manager) ensureMentionedUsersExist(issues []*gitlab.Issue) {
 
 	// Create placeholder users for any missing mentioned users
 	for username := range mentionedUsers {
-		exists, err := m.userExists(utils.NormalizeUsername(username))
+		exists, err := m.userExists(m.userName(username))
 		if err != nil {
-			utils.PrintWarning(fmt.Sprintf("Error checking if user %s exists: %v", username, err))
+			m.log.PrintWarning(fmt.Sprintf("Error checking if user %s exists: %v", username, err))
 			continue
 		}
 
 		if !exists {
 			if err := m.ImportPlaceholderUser(username); err != nil {
-				utils.PrintWarning(fmt.Sprintf("Failed to create placeholder user %s: %v", username, err))
+				m.log.PrintWarning(fmt.Sprintf("Failed to create placeholder user %s: %v", username, err))
 			}
 		}
 	}
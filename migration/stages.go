@@ -0,0 +1,151 @@
+// stages.go
+
+// Package migration handles the migration of data from GitLab to Gitea
+package migration
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// Stages of a project import, in the order they run
+const (
+	StageRepository    = "repository"
+	StageLFS           = "lfs" // check that the LFS objects arrived
+	StageCollaborators = "collaborators"
+	StageLabels        = "labels"
+	StageMilestones    = "milestones"
+	StageIssues        = "issues"         // with their comments
+	StageMergeRequests = "merge_requests" // with their comments
+	StageReleases      = "releases"
+	StageWiki          = "wiki"
+)
+
+// Statuses of a stage
+const (
+	StageRunning = "running" // started, but the run ended before it did
+	StageFailed  = "failed"  // finished with items that could not be migrated
+	StageDone    = "done"
+)
+
+// StageState records how far a stage of a project import got
+type StageState struct {
+	Status  string    `json:"status"`
+	Error   string    `json:"error,omitempty"` // last error of a failed stage
+	Updated time.Time `json:"updated"`
+}
+
+// stageErrors counts the items of a stage that could not be migrated, keeping the last error
+type stageErrors struct {
+	failed int
+	last   error
+}
+
+// add records an item that could not be migrated
+func (e *stageErrors) add(err error) {
+	e.failed++
+	e.last = err
+}
+
+// err returns an error summarizing the failed items, or nil if there were none
+func (e *stageErrors) err(items string) error {
+	if e.failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d %s failed, last error: %w", e.failed, items, e.last)
+}
+
+// runStage runs a stage of a project import and records its outcome in the state.
+// Stages that completed in an earlier run are skipped when resuming. It reports whether
+// the stage is complete.
+func (m *Manager) runStage(project *gitlab.Project, stage string, run func() error) bool {
+	projectKey := project.PathWithNamespace
+
+	if m.config.ResumeMigration {
+		if state, ok := m.state.ProjectStage(projectKey, stage); ok && state.Status == StageDone {
+			m.log.PrintInfo(fmt.Sprintf("Stage %s of project %s already complete, skipping", stage, projectKey))
+			return true
+		}
+	}
+
+	m.setStage(projectKey, stage, StageState{Status: StageRunning, Updated: time.Now()})
+
+	result := StageState{Status: StageDone, Updated: time.Now()}
+	if err := run(); err != nil {
+		result.Status = StageFailed
+		result.Error = err.Error()
+		m.log.PrintWarning(fmt.Sprintf("Stage %s of project %s incomplete: %v", stage, projectKey, err))
+	}
+	result.Updated = time.Now()
+	m.setStage(projectKey, stage, result)
+
+	return result.Status == StageDone
+}
+
+// setStage records the state of a stage and saves the migration state
+func (m *Manager) setStage(projectKey, stage string, state StageState) {
+	m.state.SetProjectStage(projectKey, stage, state)
+	if err := m.state.Save(); err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Failed to save migration state: %v", err))
+	}
+}
+
+// PartialProjectsReport lists the projects with stages that did not complete, with the
+// status and last error of each of those stages
+func PartialProjectsReport(state State) string {
+	stages := state.ProjectStages()
+
+	var projects []string
+	for project, projectStages := range stages {
+		for _, stageState := range projectStages {
+			if stageState.Status != StageDone {
+				projects = append(projects, project)
+				break
+			}
+		}
+	}
+	sort.Strings(projects)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Partially migrated projects: %d of %d\n", len(projects), len(stages))
+	for _, project := range projects {
+		fmt.Fprintf(&b, "\n%s\n", project)
+
+		names := make([]string, 0, len(stages[project]))
+		for name := range stages[project] {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool { return stageOrder(names[i]) < stageOrder(names[j]) })
+
+		for _, name := range names {
+			stageState := stages[project][name]
+			if stageState.Status == StageDone {
+				continue
+			}
+			fmt.Fprintf(&b, "  %-15s %-8s %s", name, stageState.Status, stageState.Updated.Format(time.RFC3339))
+			if stageState.Error != "" {
+				fmt.Fprintf(&b, "  %s", stageState.Error)
+			}
+			fmt.Fprintln(&b)
+		}
+	}
+
+	return b.String()
+}
+
+// stageOrder returns the position of a stage in a project import, unknown stages last
+func stageOrder(stage string) int {
+	for i, name := range []string{
+		StageRepository, StageLFS, StageCollaborators, StageLabels, StageMilestones,
+		StageIssues, StageMergeRequests, StageReleases, StageWiki,
+	} {
+		if name == stage {
+			return i
+		}
+	}
+	return 1 << 10
+}
@@ -8,33 +8,134 @@ import (
 	"fmt"
 	"os"
 	"sync"
+	"time"
 
+	"github.com/go-i2p/gitlab-to-gitea/config"
 	"github.com/go-i2p/gitlab-to-gitea/utils"
 )
 
-// State manages the migration state to support resuming migrations
-type State struct {
-	filePath         string
-	Users            []string            `json:"users"`
-	Groups           []string            `json:"groups"`
-	Projects         []string            `json:"projects"`
-	ImportedComments map[string][]string `json:"imported_comments"`
-	mutex            sync.RWMutex
+// State records what has been migrated, so that an interrupted migration can resume.
+// Implementations are safe for concurrent use. Changes of a JSONState reach the disk on
+// Save; an SQLiteState stores every change as it is made, and its Save does nothing.
+type State interface {
+	// Load reads the state of a previous run
+	Load() error
+	// Save writes the changes made since the last Save
+	Save() error
+	// Reset clears the state for a new migration
+	Reset() error
+	// Close releases the storage of the state
+	Close() error
+
+	HasImportedUser(username string) bool
+	MarkUserImported(username string)
+	HasImportedGroup(group string) bool
+	MarkGroupImported(group string)
+	HasImportedProject(project string) bool
+	MarkProjectImported(project string)
+	HasImportedComment(issueKey, commentID string) bool
+	MarkCommentImported(issueKey, commentID string)
+	HasImportedRelease(project, tag string) bool
+	MarkReleaseImported(project, tag string)
+
+	// CommentID returns the ID of the Gitea comment a GitLab note was migrated to
+	CommentID(issueKey, commentID string) (int64, bool)
+	// SetCommentID records the Gitea comment a note was migrated to, marking it imported
+	SetCommentID(issueKey, commentID string, id int64)
+
+	// IssueNumber returns the number of the Gitea issue an issue of a repository was
+	// migrated to
+	IssueNumber(repo string, iid int) (int, bool)
+	SetIssueNumber(repo string, iid, number int)
+	// MergeRequestNumber returns the number of the Gitea pull request, or fallback issue,
+	// a merge request of a repository was migrated to
+	MergeRequestNumber(repo string, iid int) (int, bool)
+	SetMergeRequestNumber(repo string, iid, number int)
+	// AttachmentURL returns the URL of a file already attached in a repository, by the
+	// SHA-256 hash of its content
+	AttachmentURL(repo, hash string) (string, bool)
+	SetAttachmentURL(repo, hash, url string)
+	// SetIssueNumberMismatches replaces the recorded issue number mismatches of a project
+	SetIssueNumberMismatches(project string, mismatches []IssueNumberMismatch)
+
+	SavedIdentities() []Identity
+	SetIdentity(identity Identity)
+	DeleteIdentity(kind string, gitlabID int)
+
+	// ProjectStage returns how far a stage of a project import got, by GitLab project path
+	ProjectStage(project, stage string) (StageState, bool)
+	SetProjectStage(project, stage string, state StageState)
+	// ProjectStages returns the recorded stages of all projects
+	ProjectStages() map[string]map[string]StageState
+
+	// LastSync returns when a project was last synchronized, by GitLab project path
+	LastSync(project string) (time.Time, bool)
+	SetLastSync(project string, synced time.Time)
 }
 
-// NewState creates a new migration state manager
-func NewState(filePath string) *State {
-	return &State{
-		filePath:         filePath,
-		Users:            []string{},
-		Groups:           []string{},
-		Projects:         []string{},
-		ImportedComments: map[string][]string{},
+// OpenState opens the migration state in the backend the configuration selects. The
+// state of a dry run or a read-only run is never written.
+func OpenState(cfg *config.Config) (State, error) {
+	readOnly := cfg.DryRun || cfg.ReadOnly
+	if cfg.StateBackend == config.StateBackendSQLite {
+		return OpenSQLiteState(cfg.MigrationStateFile, readOnly)
+	}
+
+	state := NewJSONState(cfg.MigrationStateFile)
+	state.readOnly = readOnly
+	return state, nil
+}
+
+// JSONState keeps the migration state in memory and writes all of it to a JSON file on
+// every Save
+type JSONState struct {
+	filePath              string
+	Users                 []string                         `json:"users"`
+	Groups                []string                         `json:"groups"`
+	Projects              []string                         `json:"projects"`
+	ImportedComments      map[string][]string              `json:"imported_comments"`
+	ImportedReleases      map[string][]string              `json:"imported_releases"`
+	CommentIDs            map[string]map[string]int64      `json:"comment_ids"`
+	IssueNumbers          map[string]map[int]int           `json:"issue_numbers"`
+	MergeRequestNumbers   map[string]map[int]int           `json:"merge_request_numbers"`
+	Attachments           map[string]map[string]string     `json:"attachments"`
+	IssueNumberMismatches map[string][]IssueNumberMismatch `json:"issue_number_mismatches,omitempty"`
+	Identities            map[string]Identity              `json:"identities"`
+	Stages                map[string]map[string]StageState `json:"stages"`
+	LastSyncs             map[string]time.Time             `json:"last_syncs"`
+	mutex                 sync.RWMutex
+	saveMutex             sync.Mutex // serializes writes of the state file
+	readOnly              bool       // set for dry runs, Save and Reset leave the file alone
+}
+
+// IssueNumberMismatch records a GitLab issue that did not land on the Gitea issue with the same number
+type IssueNumberMismatch struct {
+	GitLabIID   int `json:"gitlab_iid"`
+	GiteaNumber int `json:"gitea_number"` // 0 if the issue could not be found at all
+}
+
+// NewJSONState creates a migration state kept in the JSON file at filePath
+func NewJSONState(filePath string) *JSONState {
+	return &JSONState{
+		filePath:              filePath,
+		Users:                 []string{},
+		Groups:                []string{},
+		Projects:              []string{},
+		ImportedComments:      map[string][]string{},
+		ImportedReleases:      map[string][]string{},
+		CommentIDs:            map[string]map[string]int64{},
+		IssueNumbers:          map[string]map[int]int{},
+		MergeRequestNumbers:   map[string]map[int]int{},
+		Attachments:           map[string]map[string]string{},
+		IssueNumberMismatches: map[string][]IssueNumberMismatch{},
+		Identities:            map[string]Identity{},
+		Stages:                map[string]map[string]StageState{},
+		LastSyncs:             map[string]time.Time{},
 	}
 }
 
 // Load loads the migration state from the file
-func (s *State) Load() error {
+func (s *JSONState) Load() error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
@@ -51,37 +152,63 @@ func (s *State) Load() error {
 	return nil
 }
 
-// Save saves the current migration state to the file
-func (s *State) Save() error {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+// Save saves the current migration state to the file. The file is replaced
+// atomically, so a crash or a concurrent Save never leaves a partial file behind.
+func (s *JSONState) Save() error {
+	if s.readOnly {
+		return nil
+	}
+
+	s.saveMutex.Lock()
+	defer s.saveMutex.Unlock()
 
 	utils.PrintInfo("Saving migration state...")
 
+	s.mutex.RLock()
 	data, err := json.MarshalIndent(s, "", "  ")
+	s.mutex.RUnlock()
 	if err != nil {
 		return fmt.Errorf("failed to marshal state: %w", err)
 	}
 
-	err = os.WriteFile(s.filePath, data, 0o644)
+	tmpPath := s.filePath + ".tmp"
+	err = os.WriteFile(tmpPath, data, 0o644)
 	if err != nil {
 		return fmt.Errorf("failed to write state file: %w", err)
 	}
 
+	err = os.Rename(tmpPath, s.filePath)
+	if err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+
 	utils.PrintInfo("Migration state saved successfully")
 	return nil
 }
 
+// Close does nothing, as the file is only open while it is saved
+func (s *JSONState) Close() error {
+	return nil
+}
+
 // Reset clears the migration state
-func (s *State) Reset() error {
+func (s *JSONState) Reset() error {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
 	utils.PrintInfo("Clearing migration state...")
 
 	s.Users = []string{}
 	s.Groups = []string{}
 	s.Projects = []string{}
 	s.ImportedComments = map[string][]string{}
+	s.ImportedReleases = map[string][]string{}
+	s.CommentIDs = map[string]map[string]int64{}
+	s.IssueNumbers = map[string]map[int]int{}
+	s.MergeRequestNumbers = map[string]map[int]int{}
+	s.Attachments = map[string]map[string]string{}
+	s.IssueNumberMismatches = map[string][]IssueNumberMismatch{}
+	s.Identities = map[string]Identity{}
+	s.Stages = map[string]map[string]StageState{}
+	s.LastSyncs = map[string]time.Time{}
 
 	utils.PrintInfo("Migration state reset. Saving...")
 	s.mutex.Unlock()
@@ -89,7 +216,7 @@ func (s *State) Reset() error {
 }
 
 // HasImportedUser checks if a user has been imported
-func (s *State) HasImportedUser(username string) bool {
+func (s *JSONState) HasImportedUser(username string) bool {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
@@ -102,7 +229,7 @@ func (s *State) HasImportedUser(username string) bool {
 }
 
 // MarkUserImported marks a user as imported
-func (s *State) MarkUserImported(username string) {
+func (s *JSONState) MarkUserImported(username string) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
@@ -121,7 +248,7 @@ func (s *State) MarkUserImported(username string) {
 }
 
 // HasImportedGroup checks if a group has been imported
-func (s *State) HasImportedGroup(group string) bool {
+func (s *JSONState) HasImportedGroup(group string) bool {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
@@ -134,7 +261,7 @@ func (s *State) HasImportedGroup(group string) bool {
 }
 
 // MarkGroupImported marks a group as imported
-func (s *State) MarkGroupImported(group string) {
+func (s *JSONState) MarkGroupImported(group string) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
@@ -153,7 +280,7 @@ func (s *State) MarkGroupImported(group string) {
 }
 
 // HasImportedProject checks if a project has been imported
-func (s *State) HasImportedProject(project string) bool {
+func (s *JSONState) HasImportedProject(project string) bool {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
@@ -165,7 +292,7 @@ func (s *State) HasImportedProject(project string) bool {
 	return false
 }
 
-func (s *State) MarkProjectImported(project string) {
+func (s *JSONState) MarkProjectImported(project string) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
@@ -184,7 +311,7 @@ func (s *State) MarkProjectImported(project string) {
 }
 
 // HasImportedComment checks if a comment has been imported
-func (s *State) HasImportedComment(issueKey, commentID string) bool {
+func (s *JSONState) HasImportedComment(issueKey, commentID string) bool {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
@@ -202,7 +329,7 @@ func (s *State) HasImportedComment(issueKey, commentID string) bool {
 }
 
 // MarkCommentImported marks a comment as imported
-func (s *State) MarkCommentImported(issueKey, commentID string) {
+func (s *JSONState) MarkCommentImported(issueKey, commentID string) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
@@ -226,3 +353,234 @@ func (s *State) MarkCommentImported(issueKey, commentID string) {
 		s.ImportedComments[issueKey] = append(s.ImportedComments[issueKey], commentID)
 	}
 }
+
+// HasImportedRelease checks if a release, with all its assets, has been imported
+func (s *JSONState) HasImportedRelease(project, tag string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, t := range s.ImportedReleases[project] {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// MarkReleaseImported marks a release as imported with all its assets
+func (s *JSONState) MarkReleaseImported(project, tag string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.ImportedReleases == nil {
+		s.ImportedReleases = map[string][]string{}
+	}
+
+	for _, t := range s.ImportedReleases[project] {
+		if t == tag {
+			return
+		}
+	}
+	s.ImportedReleases[project] = append(s.ImportedReleases[project], tag)
+}
+
+// CommentID returns the ID of the Gitea comment a GitLab note was migrated to
+func (s *JSONState) CommentID(issueKey, commentID string) (int64, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	id, ok := s.CommentIDs[issueKey][commentID]
+	return id, ok
+}
+
+// SetCommentID records the Gitea comment a note was migrated to, marking it imported
+func (s *JSONState) SetCommentID(issueKey, commentID string, id int64) {
+	s.MarkCommentImported(issueKey, commentID)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.CommentIDs == nil {
+		s.CommentIDs = map[string]map[string]int64{}
+	}
+	if s.CommentIDs[issueKey] == nil {
+		s.CommentIDs[issueKey] = map[string]int64{}
+	}
+	s.CommentIDs[issueKey][commentID] = id
+}
+
+// IssueNumber returns the number of the Gitea issue an issue of a repository was migrated to
+func (s *JSONState) IssueNumber(repo string, iid int) (int, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	number, ok := s.IssueNumbers[repo][iid]
+	return number, ok
+}
+
+// SetIssueNumber records the Gitea number an issue of a repository was migrated to
+func (s *JSONState) SetIssueNumber(repo string, iid, number int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.IssueNumbers == nil {
+		s.IssueNumbers = map[string]map[int]int{}
+	}
+	if s.IssueNumbers[repo] == nil {
+		s.IssueNumbers[repo] = map[int]int{}
+	}
+	s.IssueNumbers[repo][iid] = number
+}
+
+// MergeRequestNumber returns the number of the Gitea pull request, or fallback issue, a
+// merge request of a repository was migrated to
+func (s *JSONState) MergeRequestNumber(repo string, iid int) (int, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	number, ok := s.MergeRequestNumbers[repo][iid]
+	return number, ok
+}
+
+// SetMergeRequestNumber records the Gitea number a merge request of a repository was migrated to
+func (s *JSONState) SetMergeRequestNumber(repo string, iid, number int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.MergeRequestNumbers == nil {
+		s.MergeRequestNumbers = map[string]map[int]int{}
+	}
+	if s.MergeRequestNumbers[repo] == nil {
+		s.MergeRequestNumbers[repo] = map[int]int{}
+	}
+	s.MergeRequestNumbers[repo][iid] = number
+}
+
+// AttachmentURL returns the URL of a file already attached in a repository, by the
+// SHA-256 hash of its content
+func (s *JSONState) AttachmentURL(repo, hash string) (string, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	url, ok := s.Attachments[repo][hash]
+	return url, ok
+}
+
+// SetAttachmentURL records the URL a file was attached at in a repository
+func (s *JSONState) SetAttachmentURL(repo, hash, url string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.Attachments == nil {
+		s.Attachments = map[string]map[string]string{}
+	}
+	if s.Attachments[repo] == nil {
+		s.Attachments[repo] = map[string]string{}
+	}
+	s.Attachments[repo][hash] = url
+}
+
+// SetIssueNumberMismatches replaces the recorded issue number mismatches of a project
+func (s *JSONState) SetIssueNumberMismatches(project string, mismatches []IssueNumberMismatch) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.IssueNumberMismatches == nil {
+		s.IssueNumberMismatches = map[string][]IssueNumberMismatch{}
+	}
+
+	if len(mismatches) == 0 {
+		delete(s.IssueNumberMismatches, project)
+		return
+	}
+	s.IssueNumberMismatches[project] = mismatches
+}
+
+// SavedIdentities returns the Gitea identities recorded for GitLab users, groups and projects
+func (s *JSONState) SavedIdentities() []Identity {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	identities := make([]Identity, 0, len(s.Identities))
+	for _, identity := range s.Identities {
+		identities = append(identities, identity)
+	}
+	return identities
+}
+
+// SetIdentity records the Gitea identity of a GitLab user, group or project
+func (s *JSONState) SetIdentity(identity Identity) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.Identities == nil {
+		s.Identities = map[string]Identity{}
+	}
+	s.Identities[identityKey(identity.Kind, identity.GitLabID)] = identity
+}
+
+// DeleteIdentity forgets the Gitea identity of a GitLab user, group or project
+func (s *JSONState) DeleteIdentity(kind string, gitlabID int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.Identities, identityKey(kind, gitlabID))
+}
+
+// ProjectStage returns how far a stage of a project import got
+func (s *JSONState) ProjectStage(project, stage string) (StageState, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	state, ok := s.Stages[project][stage]
+	return state, ok
+}
+
+// SetProjectStage records how far a stage of a project import got
+func (s *JSONState) SetProjectStage(project, stage string, state StageState) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.Stages == nil {
+		s.Stages = map[string]map[string]StageState{}
+	}
+	if s.Stages[project] == nil {
+		s.Stages[project] = map[string]StageState{}
+	}
+	s.Stages[project][stage] = state
+}
+
+// ProjectStages returns the recorded stages of all projects
+func (s *JSONState) ProjectStages() map[string]map[string]StageState {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	stages := make(map[string]map[string]StageState, len(s.Stages))
+	for project, projectStages := range s.Stages {
+		stages[project] = make(map[string]StageState, len(projectStages))
+		for stage, state := range projectStages {
+			stages[project][stage] = state
+		}
+	}
+	return stages
+}
+
+// LastSync returns when a project was last synchronized
+func (s *JSONState) LastSync(project string) (time.Time, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	synced, ok := s.LastSyncs[project]
+	return synced, ok
+}
+
+// SetLastSync records when a project was last synchronized
+func (s *JSONState) SetLastSync(project string, synced time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.LastSyncs == nil {
+		s.LastSyncs = map[string]time.Time{}
+	}
+	s.LastSyncs[project] = synced
+}
@@ -0,0 +1,573 @@
+// state_sqlite.go
+
+// Package migration handles the migration of data from GitLab to Gitea
+package migration
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/go-i2p/gitlab-to-gitea/utils"
+)
+
+// Kinds of items in an SQLite state
+const (
+	itemUser             = "user"
+	itemGroup            = "group"
+	itemProject          = "project"
+	itemComment          = "comment"
+	itemRelease          = "release"
+	itemIssue            = "issue"
+	itemMergeRequest     = "merge_request"
+	itemAttachment       = "attachment"
+	itemNumberMismatches = "issue_number_mismatches"
+	itemIdentity         = "identity"
+	itemStage            = "stage"
+	itemLastSync         = "last_sync"
+)
+
+// sqliteSchema creates the table of an SQLite state. Every item is a row keyed by its
+// kind, the scope it belongs to (the issue of a comment, the repository of a merge
+// request, empty for users, groups and projects) and its own key.
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS state_items (
+	kind  TEXT NOT NULL,
+	scope TEXT NOT NULL,
+	item  TEXT NOT NULL,
+	value TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (kind, scope, item)
+) WITHOUT ROWID`
+
+// stateItem is a row of an SQLite state
+type stateItem struct {
+	kind, scope, item, value string
+}
+
+// sqlExecutor is what *sql.DB and *sql.Tx have in common
+type sqlExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// SQLiteState keeps the migration state in an SQLite database. Every change is committed
+// on its own as it is made, so a crash loses at most the change in flight, and lookups
+// go through the primary key instead of scanning lists. Changes that cannot be written
+// are reported by the next Save. A read-only state, for dry runs, makes all its changes
+// in one transaction that Close rolls back.
+type SQLiteState struct {
+	db           *sql.DB
+	tx           *sql.Tx     // the transaction of a read-only state
+	exec         sqlExecutor // tx for a read-only state, db otherwise
+	mutex        sync.Mutex  // serializes statements, SQLite has a single writer anyway
+	writeErr     error       // the first write that failed since the last Save
+	failedWrites int         // the number of writes that failed since the last Save
+}
+
+// OpenSQLiteState opens the SQLite state at filePath, creating it if needed. A read-only
+// state whose file does not exist yet lives in memory, so a dry run creates no file.
+func OpenSQLiteState(filePath string, readOnly bool) (*SQLiteState, error) {
+	dsn := "file:" + filePath + "?_journal_mode=WAL&_busy_timeout=5000"
+	if readOnly && !FileExists(filePath) {
+		dsn = "file::memory:"
+	}
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state database: %w", err)
+	}
+	// A single connection keeps the in-memory database and the dry run transaction alive
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create state database: %w", err)
+	}
+
+	state := &SQLiteState{db: db, exec: db}
+	if readOnly {
+		tx, err := db.Begin()
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to begin state transaction: %w", err)
+		}
+		state.tx = tx
+		state.exec = tx
+	}
+
+	return state, nil
+}
+
+// Load checks that the state database can be read. Items are read when they are looked up.
+func (s *SQLiteState) Load() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var count int
+	if err := s.exec.QueryRow("SELECT COUNT(*) FROM state_items").Scan(&count); err != nil {
+		return fmt.Errorf("failed to read state database: %w", err)
+	}
+	utils.PrintInfo(fmt.Sprintf("Migration state holds %d items", count))
+	return nil
+}
+
+// Save stores nothing, as every change is stored when it is made, but returns an error
+// if any of the changes made since the last Save could not be written
+func (s *SQLiteState) Save() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.takeWriteErr()
+}
+
+// Reset clears the migration state
+func (s *SQLiteState) Reset() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	utils.PrintInfo("Clearing migration state...")
+	if _, err := s.exec.Exec("DELETE FROM state_items"); err != nil {
+		return fmt.Errorf("failed to clear state database: %w", err)
+	}
+	return nil
+}
+
+// Close closes the state database, discarding the changes of a read-only state. Like
+// Save, it returns an error if changes made since the last Save could not be written.
+func (s *SQLiteState) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.tx != nil {
+		s.tx.Rollback()
+		s.tx = nil
+	}
+	return errors.Join(s.takeWriteErr(), s.db.Close())
+}
+
+// ImportJSON replaces the content of the state with that of a JSON state file, in a
+// single transaction
+func (s *SQLiteState) ImportJSON(filePath string) error {
+	source := NewJSONState(filePath)
+	if err := source.Load(); err != nil {
+		return err
+	}
+	items, err := source.items()
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tx := s.tx
+	if tx == nil {
+		if tx, err = s.db.Begin(); err != nil {
+			return fmt.Errorf("failed to begin state transaction: %w", err)
+		}
+		defer tx.Rollback()
+	}
+
+	if _, err := tx.Exec("DELETE FROM state_items"); err != nil {
+		return fmt.Errorf("failed to clear state database: %w", err)
+	}
+	for _, item := range items {
+		if _, err := tx.Exec("INSERT OR REPLACE INTO state_items (kind, scope, item, value) VALUES (?, ?, ?, ?)",
+			item.kind, item.scope, item.item, item.value); err != nil {
+			return fmt.Errorf("failed to import %s %s: %w", item.kind, item.item, err)
+		}
+	}
+
+	if tx != s.tx {
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit imported state: %w", err)
+		}
+	}
+
+	utils.PrintInfo(fmt.Sprintf("Imported %d items from %s", len(items), filePath))
+	return nil
+}
+
+// HasImportedUser checks if a user has been imported
+func (s *SQLiteState) HasImportedUser(username string) bool {
+	_, ok := s.get(itemUser, "", username)
+	return ok
+}
+
+// MarkUserImported marks a user as imported
+func (s *SQLiteState) MarkUserImported(username string) {
+	s.put(itemUser, "", username, "")
+}
+
+// HasImportedGroup checks if a group has been imported
+func (s *SQLiteState) HasImportedGroup(group string) bool {
+	_, ok := s.get(itemGroup, "", group)
+	return ok
+}
+
+// MarkGroupImported marks a group as imported
+func (s *SQLiteState) MarkGroupImported(group string) {
+	s.put(itemGroup, "", group, "")
+}
+
+// HasImportedProject checks if a project has been imported
+func (s *SQLiteState) HasImportedProject(project string) bool {
+	_, ok := s.get(itemProject, "", project)
+	return ok
+}
+
+// MarkProjectImported marks a project as imported
+func (s *SQLiteState) MarkProjectImported(project string) {
+	s.put(itemProject, "", project, "")
+}
+
+// HasImportedComment checks if a comment has been imported
+func (s *SQLiteState) HasImportedComment(issueKey, commentID string) bool {
+	_, ok := s.get(itemComment, issueKey, commentID)
+	return ok
+}
+
+// MarkCommentImported marks a comment as imported
+func (s *SQLiteState) MarkCommentImported(issueKey, commentID string) {
+	s.put(itemComment, issueKey, commentID, "")
+}
+
+// HasImportedRelease checks if a release, with all its assets, has been imported
+func (s *SQLiteState) HasImportedRelease(project, tag string) bool {
+	_, ok := s.get(itemRelease, project, tag)
+	return ok
+}
+
+// MarkReleaseImported marks a release as imported with all its assets
+func (s *SQLiteState) MarkReleaseImported(project, tag string) {
+	s.put(itemRelease, project, tag, "")
+}
+
+// CommentID returns the ID of the Gitea comment a GitLab note was migrated to. Notes
+// imported before IDs were recorded have an empty value.
+func (s *SQLiteState) CommentID(issueKey, commentID string) (int64, bool) {
+	value, ok := s.get(itemComment, issueKey, commentID)
+	if !ok || value == "" {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	return id, err == nil
+}
+
+// SetCommentID records the Gitea comment a note was migrated to, marking it imported
+func (s *SQLiteState) SetCommentID(issueKey, commentID string, id int64) {
+	s.put(itemComment, issueKey, commentID, strconv.FormatInt(id, 10))
+}
+
+// IssueNumber returns the number of the Gitea issue an issue of a repository was migrated to
+func (s *SQLiteState) IssueNumber(repo string, iid int) (int, bool) {
+	value, ok := s.get(itemIssue, repo, strconv.Itoa(iid))
+	if !ok {
+		return 0, false
+	}
+	number, err := strconv.Atoi(value)
+	return number, err == nil
+}
+
+// SetIssueNumber records the Gitea number an issue of a repository was migrated to
+func (s *SQLiteState) SetIssueNumber(repo string, iid, number int) {
+	s.put(itemIssue, repo, strconv.Itoa(iid), strconv.Itoa(number))
+}
+
+// MergeRequestNumber returns the number of the Gitea pull request, or fallback issue, a
+// merge request of a repository was migrated to
+func (s *SQLiteState) MergeRequestNumber(repo string, iid int) (int, bool) {
+	value, ok := s.get(itemMergeRequest, repo, strconv.Itoa(iid))
+	if !ok {
+		return 0, false
+	}
+	number, err := strconv.Atoi(value)
+	return number, err == nil
+}
+
+// SetMergeRequestNumber records the Gitea number a merge request of a repository was migrated to
+func (s *SQLiteState) SetMergeRequestNumber(repo string, iid, number int) {
+	s.put(itemMergeRequest, repo, strconv.Itoa(iid), strconv.Itoa(number))
+}
+
+// AttachmentURL returns the URL of a file already attached in a repository, by the
+// SHA-256 hash of its content
+func (s *SQLiteState) AttachmentURL(repo, hash string) (string, bool) {
+	return s.get(itemAttachment, repo, hash)
+}
+
+// SetAttachmentURL records the URL a file was attached at in a repository
+func (s *SQLiteState) SetAttachmentURL(repo, hash, url string) {
+	s.put(itemAttachment, repo, hash, url)
+}
+
+// SetIssueNumberMismatches replaces the recorded issue number mismatches of a project
+func (s *SQLiteState) SetIssueNumberMismatches(project string, mismatches []IssueNumberMismatch) {
+	if len(mismatches) == 0 {
+		s.remove(itemNumberMismatches, "", project)
+		return
+	}
+
+	data, err := json.Marshal(mismatches)
+	if err != nil {
+		utils.PrintWarning(fmt.Sprintf("Failed to encode issue number mismatches: %v", err))
+		return
+	}
+	s.put(itemNumberMismatches, "", project, string(data))
+}
+
+// SavedIdentities returns the Gitea identities recorded for GitLab users, groups and projects
+func (s *SQLiteState) SavedIdentities() []Identity {
+	items := s.items(itemIdentity)
+
+	identities := make([]Identity, 0, len(items))
+	for _, item := range items {
+		var identity Identity
+		if err := json.Unmarshal([]byte(item.value), &identity); err != nil {
+			utils.PrintWarning(fmt.Sprintf("Ignoring unreadable identity in migration state: %v", err))
+			continue
+		}
+		identities = append(identities, identity)
+	}
+	return identities
+}
+
+// SetIdentity records the Gitea identity of a GitLab user, group or project
+func (s *SQLiteState) SetIdentity(identity Identity) {
+	data, err := json.Marshal(identity)
+	if err != nil {
+		utils.PrintWarning(fmt.Sprintf("Failed to encode identity: %v", err))
+		return
+	}
+	s.put(itemIdentity, "", identityKey(identity.Kind, identity.GitLabID), string(data))
+}
+
+// DeleteIdentity forgets the Gitea identity of a GitLab user, group or project
+func (s *SQLiteState) DeleteIdentity(kind string, gitlabID int) {
+	s.remove(itemIdentity, "", identityKey(kind, gitlabID))
+}
+
+// ProjectStage returns how far a stage of a project import got
+func (s *SQLiteState) ProjectStage(project, stage string) (StageState, bool) {
+	value, ok := s.get(itemStage, project, stage)
+	if !ok {
+		return StageState{}, false
+	}
+
+	var state StageState
+	if err := json.Unmarshal([]byte(value), &state); err != nil {
+		utils.PrintWarning(fmt.Sprintf("Ignoring unreadable stage in migration state: %v", err))
+		return StageState{}, false
+	}
+	return state, true
+}
+
+// SetProjectStage records how far a stage of a project import got
+func (s *SQLiteState) SetProjectStage(project, stage string, state StageState) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		utils.PrintWarning(fmt.Sprintf("Failed to encode stage: %v", err))
+		return
+	}
+	s.put(itemStage, project, stage, string(data))
+}
+
+// ProjectStages returns the recorded stages of all projects
+func (s *SQLiteState) ProjectStages() map[string]map[string]StageState {
+	stages := map[string]map[string]StageState{}
+	for _, item := range s.items(itemStage) {
+		var state StageState
+		if err := json.Unmarshal([]byte(item.value), &state); err != nil {
+			utils.PrintWarning(fmt.Sprintf("Ignoring unreadable stage in migration state: %v", err))
+			continue
+		}
+		if stages[item.scope] == nil {
+			stages[item.scope] = map[string]StageState{}
+		}
+		stages[item.scope][item.item] = state
+	}
+	return stages
+}
+
+// LastSync returns when a project was last synchronized
+func (s *SQLiteState) LastSync(project string) (time.Time, bool) {
+	value, ok := s.get(itemLastSync, "", project)
+	if !ok {
+		return time.Time{}, false
+	}
+	synced, err := time.Parse(time.RFC3339Nano, value)
+	return synced, err == nil
+}
+
+// SetLastSync records when a project was last synchronized
+func (s *SQLiteState) SetLastSync(project string, synced time.Time) {
+	s.put(itemLastSync, "", project, synced.Format(time.RFC3339Nano))
+}
+
+// get returns the value of an item, and whether it exists. Errors are reported and
+// treated as a missing item, which at worst makes the migration check Gitea again.
+func (s *SQLiteState) get(kind, scope, item string) (string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var value string
+	err := s.exec.QueryRow("SELECT value FROM state_items WHERE kind = ? AND scope = ? AND item = ?",
+		kind, scope, item).Scan(&value)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			utils.PrintWarning(fmt.Sprintf("Failed to read migration state: %v", err))
+		}
+		return "", false
+	}
+	return value, true
+}
+
+// put stores an item, replacing its previous value. A failure is returned by the next Save.
+func (s *SQLiteState) put(kind, scope, item, value string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, err := s.exec.Exec("INSERT OR REPLACE INTO state_items (kind, scope, item, value) VALUES (?, ?, ?, ?)",
+		kind, scope, item, value); err != nil {
+		s.failWrite(fmt.Errorf("failed to store %s %s: %w", kind, item, err))
+	}
+}
+
+// remove deletes an item. A failure is returned by the next Save.
+func (s *SQLiteState) remove(kind, scope, item string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, err := s.exec.Exec("DELETE FROM state_items WHERE kind = ? AND scope = ? AND item = ?",
+		kind, scope, item); err != nil {
+		s.failWrite(fmt.Errorf("failed to delete %s %s: %w", kind, item, err))
+	}
+}
+
+// failWrite records a failed write for the next Save. The caller holds the mutex.
+func (s *SQLiteState) failWrite(err error) {
+	utils.PrintWarning(fmt.Sprintf("Failed to write migration state: %v", err))
+	if s.writeErr == nil {
+		s.writeErr = err
+	}
+	s.failedWrites++
+}
+
+// takeWriteErr returns the writes that failed since the last call, and forgets them.
+// The caller holds the mutex.
+func (s *SQLiteState) takeWriteErr() error {
+	if s.failedWrites == 0 {
+		return nil
+	}
+	err := fmt.Errorf("%d changes to the migration state were not written, the first: %w", s.failedWrites, s.writeErr)
+	s.writeErr = nil
+	s.failedWrites = 0
+	return err
+}
+
+// items returns all items of a kind
+func (s *SQLiteState) items(kind string) []stateItem {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rows, err := s.exec.Query("SELECT scope, item, value FROM state_items WHERE kind = ? ORDER BY scope, item", kind)
+	if err != nil {
+		utils.PrintWarning(fmt.Sprintf("Failed to read migration state: %v", err))
+		return nil
+	}
+	defer rows.Close()
+
+	var items []stateItem
+	for rows.Next() {
+		item := stateItem{kind: kind}
+		if err := rows.Scan(&item.scope, &item.item, &item.value); err != nil {
+			utils.PrintWarning(fmt.Sprintf("Failed to read migration state: %v", err))
+			return items
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		utils.PrintWarning(fmt.Sprintf("Failed to read migration state: %v", err))
+	}
+	return items
+}
+
+// items returns the content of a JSON state as the items of an SQLite state
+func (s *JSONState) items() ([]stateItem, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var items []stateItem
+	for _, username := range s.Users {
+		items = append(items, stateItem{itemUser, "", username, ""})
+	}
+	for _, group := range s.Groups {
+		items = append(items, stateItem{itemGroup, "", group, ""})
+	}
+	for _, project := range s.Projects {
+		items = append(items, stateItem{itemProject, "", project, ""})
+	}
+	for issueKey, comments := range s.ImportedComments {
+		for _, commentID := range comments {
+			var value string
+			if id, ok := s.CommentIDs[issueKey][commentID]; ok {
+				value = strconv.FormatInt(id, 10)
+			}
+			items = append(items, stateItem{itemComment, issueKey, commentID, value})
+		}
+	}
+	for repo, numbers := range s.IssueNumbers {
+		for iid, number := range numbers {
+			items = append(items, stateItem{itemIssue, repo, strconv.Itoa(iid), strconv.Itoa(number)})
+		}
+	}
+	for project, tags := range s.ImportedReleases {
+		for _, tag := range tags {
+			items = append(items, stateItem{itemRelease, project, tag, ""})
+		}
+	}
+	for repo, numbers := range s.MergeRequestNumbers {
+		for iid, number := range numbers {
+			items = append(items, stateItem{itemMergeRequest, repo, strconv.Itoa(iid), strconv.Itoa(number)})
+		}
+	}
+	for repo, urls := range s.Attachments {
+		for hash, url := range urls {
+			items = append(items, stateItem{itemAttachment, repo, hash, url})
+		}
+	}
+	for project, mismatches := range s.IssueNumberMismatches {
+		data, err := json.Marshal(mismatches)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode issue number mismatches: %w", err)
+		}
+		items = append(items, stateItem{itemNumberMismatches, "", project, string(data)})
+	}
+	for key, identity := range s.Identities {
+		data, err := json.Marshal(identity)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode identity: %w", err)
+		}
+		items = append(items, stateItem{itemIdentity, "", key, string(data)})
+	}
+	for project, stages := range s.Stages {
+		for stage, state := range stages {
+			data, err := json.Marshal(state)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode stage: %w", err)
+			}
+			items = append(items, stateItem{itemStage, project, stage, string(data)})
+		}
+	}
+	for project, synced := range s.LastSyncs {
+		items = append(items, stateItem{itemLastSync, "", project, synced.Format(time.RFC3339Nano)})
+	}
+
+	return items, nil
+}
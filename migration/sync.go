@@ -0,0 +1,417 @@
+// sync.go
+
+// Package migration handles the migration of data from GitLab to Gitea
+package migration
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/go-i2p/gitlab-to-gitea/gitea"
+)
+
+// syncOverlap is how far before the start of the last sync the next one looks for changes,
+// so that clock differences between the hosts cannot hide an update. Changes seen twice are
+// applied once, as everything already in Gitea is compared before it is written.
+const syncOverlap = time.Minute
+
+// SyncProjects brings the changes made in GitLab since the last sync across to the
+// repositories of migrated projects: new and edited issues and comments, issue state
+// changes, labels and milestones. Issues and comments are matched through the numbers and
+// IDs recorded in the state, so renaming an issue in GitLab does not create a new one.
+func (m *Manager) SyncProjects() error {
+	if m.readOnly {
+		return errReadOnly
+	}
+	projects, err := m.selectedProjects()
+	if err != nil {
+		return err
+	}
+	if err := m.loadIdentities(); err != nil {
+		return err
+	}
+	m.loadMentions()
+
+	failed := 0
+	for _, project := range projects {
+		_, repo := m.projectName(project)
+		if !m.state.HasImportedProject(fmt.Sprintf("%s/%s", project.Namespace.Name, repo)) {
+			m.log.PrintWarning(fmt.Sprintf("Project %s is not migrated yet, skipping", project.PathWithNamespace))
+			continue
+		}
+
+		if err := m.syncProject(project); err != nil {
+			m.log.PrintError(fmt.Sprintf("Failed to sync project %s: %v", project.PathWithNamespace, err))
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d projects failed to sync", failed)
+	}
+	return nil
+}
+
+// syncProject brings the changes made to a project since its last sync across
+func (m *Manager) syncProject(project *gitlab.Project) error {
+	projectKey := project.PathWithNamespace
+	owner, repo := m.projectName(project)
+	started := time.Now()
+
+	// Without an earlier sync, changes are looked for since the project was migrated
+	since, ok := m.state.LastSync(projectKey)
+	if !ok {
+		if stage, found := m.state.ProjectStage(projectKey, StageRepository); found {
+			since = stage.Updated
+		}
+	}
+	if !since.IsZero() {
+		since = since.Add(-syncOverlap)
+	}
+
+	m.log.PrintInfo(fmt.Sprintf("Syncing project %s to %s/%s", projectKey, owner, repo))
+
+	var failures stageErrors
+	if err := m.syncLabels(project, owner, repo); err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Error syncing labels: %v", err))
+		failures.add(err)
+	}
+	if err := m.syncMilestones(project, owner, repo); err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Error syncing milestones: %v", err))
+		failures.add(err)
+	}
+
+	m.markdown = m.newMarkdownRewriter(project, owner, repo)
+	m.addMarkdownLinks(m.markdown, owner, repo)
+	m.linkedBodies = nil
+	defer func() { m.markdown = nil }()
+
+	if err := m.syncIssues(project, owner, repo, since); err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Error syncing issues: %v", err))
+		failures.add(err)
+	}
+	if err := m.resolveDeferredLinks(owner, repo); err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Error resolving references: %v", err))
+	}
+
+	// A failed sync is retried from the same point next time
+	if err := failures.err("sync steps"); err != nil {
+		return err
+	}
+
+	m.state.SetLastSync(projectKey, started)
+	if err := m.state.Save(); err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Failed to save migration state: %v", err))
+	}
+	m.log.PrintSuccess(fmt.Sprintf("Project %s synced", projectKey))
+	return nil
+}
+
+// syncLabels creates new labels and updates the color and description of changed ones.
+// Labels are matched by name.
+func (m *Manager) syncLabels(project *gitlab.Project, owner, repo string) error {
+	labels, err := m.gitlabClient.GetProjectLabels(project.ID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch labels: %w", err)
+	}
+	existing, err := m.giteaClient.ListLabels(owner, repo)
+	if err != nil {
+		return fmt.Errorf("failed to get existing labels: %w", err)
+	}
+
+	color := func(c string) string { return strings.ToLower(strings.TrimPrefix(c, "#")) }
+
+	var missing []*gitlab.Label
+	var failures stageErrors
+	for _, label := range labels {
+		index := slices.IndexFunc(existing, func(l *gitea.Label) bool { return l.Name == label.Name })
+		if index < 0 {
+			missing = append(missing, label)
+			continue
+		}
+
+		current := existing[index]
+		if color(current.Color) == color(label.Color) && current.Description == label.Description {
+			continue
+		}
+		_, err := m.giteaClient.EditLabel(owner, repo, current.ID, gitea.EditLabelOption{
+			Name:        label.Name,
+			Color:       label.Color,
+			Description: label.Description,
+		})
+		if err != nil {
+			m.log.PrintError(fmt.Sprintf("Label %s update failed: %v", label.Name, err))
+			failures.add(err)
+			continue
+		}
+		m.log.PrintInfo(fmt.Sprintf("Label %s updated", label.Name))
+	}
+
+	if err := m.importProjectLabels(missing, owner, repo); err != nil {
+		failures.add(err)
+	}
+	return failures.err("labels")
+}
+
+// syncMilestones creates new milestones and updates the description, due date and state
+// of changed ones. Milestones are matched by title.
+func (m *Manager) syncMilestones(project *gitlab.Project, owner, repo string) error {
+	milestones, err := m.gitlabClient.GetProjectMilestones(project.ID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch milestones: %w", err)
+	}
+	existing, err := m.giteaClient.ListMilestones(owner, repo)
+	if err != nil {
+		return fmt.Errorf("failed to get existing milestones: %w", err)
+	}
+
+	var missing []*gitlab.Milestone
+	var failures stageErrors
+	for _, milestone := range milestones {
+		index := slices.IndexFunc(existing, func(g *gitea.Milestone) bool { return g.Title == milestone.Title })
+		if index < 0 {
+			missing = append(missing, milestone)
+			continue
+		}
+
+		current := existing[index]
+		state := "open"
+		if milestone.State == "closed" {
+			state = "closed"
+		}
+		var dueOn, currentDueOn string
+		if milestone.DueDate != nil {
+			if parsedDate, err := time.Parse("2006-01-02", milestone.DueDate.String()); err == nil {
+				dueOn = parsedDate.Format(time.RFC3339)
+			}
+		}
+		if current.Deadline != nil {
+			currentDueOn = current.Deadline.Format("2006-01-02")
+		}
+		if current.State == state && current.Description == milestone.Description &&
+			(milestone.DueDate == nil || currentDueOn == milestone.DueDate.String()) {
+			continue
+		}
+
+		_, err := m.giteaClient.EditMilestone(owner, repo, current.ID, gitea.EditMilestoneOption{
+			Description: milestone.Description,
+			DueOn:       dueOn,
+			State:       state,
+			Title:       milestone.Title,
+		})
+		if err != nil {
+			m.log.PrintError(fmt.Sprintf("Milestone %s update failed: %v", milestone.Title, err))
+			failures.add(err)
+			continue
+		}
+		m.log.PrintInfo(fmt.Sprintf("Milestone %s updated", milestone.Title))
+	}
+
+	if err := m.importProjectMilestones(missing, owner, repo); err != nil {
+		failures.add(err)
+	}
+	return failures.err("milestones")
+}
+
+// syncIssues brings the issues created or updated since the given time across. Without a
+// time, every issue is compared.
+func (m *Manager) syncIssues(project *gitlab.Project, owner, repo string, since time.Time) error {
+	var issues []*gitlab.Issue
+	var err error
+	if since.IsZero() {
+		issues, err = m.gitlabClient.GetProjectIssues(project.ID)
+	} else {
+		issues, err = m.gitlabClient.GetProjectIssuesUpdatedAfter(project.ID, since)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch issues: %w", err)
+	}
+	if len(issues) == 0 {
+		m.log.PrintInfo(fmt.Sprintf("No issues changed in project %s", project.PathWithNamespace))
+		return nil
+	}
+	m.log.PrintInfo(fmt.Sprintf("Found %d changed issues for project %s", len(issues), project.PathWithNamespace))
+
+	existingMilestones, err := m.giteaClient.ListMilestones(owner, repo)
+	if err != nil {
+		return fmt.Errorf("failed to get existing milestones: %w", err)
+	}
+	existingLabels, err := m.giteaClient.ListLabels(owner, repo)
+	if err != nil {
+		return fmt.Errorf("failed to get existing labels: %w", err)
+	}
+	existingIssues, err := m.giteaClient.ListIssues(owner, repo, gitea.ListIssuesOptions{State: "all", Type: "issues"})
+	if err != nil {
+		return fmt.Errorf("failed to get existing issues: %w", err)
+	}
+
+	m.ensureMentionedUsersExist(issues)
+
+	// New issues are created in GitLab order
+	sort.Slice(issues, func(i, j int) bool { return issues[i].IID < issues[j].IID })
+
+	var failures stageErrors
+	for _, issue := range issues {
+		number := 0
+		if existing := m.findExistingIssue(existingIssues, issue, owner, repo); existing != nil {
+			number = existing.Number
+			if err := m.updateIssue(issue, existing, owner, repo, existingMilestones, existingLabels); err != nil {
+				m.log.PrintError(fmt.Sprintf("Issue #%d update failed: %v", number, err))
+				failures.add(err)
+			}
+		} else {
+			number, err = m.createIssue(issue, owner, repo, existingMilestones, existingLabels)
+			if err != nil {
+				m.log.PrintError(fmt.Sprintf("Issue %s import failed: %v", issue.Title, err))
+				failures.add(err)
+				continue
+			}
+			m.log.PrintInfo(fmt.Sprintf("Issue %s imported as #%d", issue.Title, number))
+		}
+		m.recordIssueNumber(owner, repo, issue.IID, number)
+
+		if err := m.syncIssueComments(issue, owner, repo, number, project.ID); err != nil {
+			m.log.PrintWarning(fmt.Sprintf("Error syncing comments: %v", err))
+			failures.add(err)
+		}
+		m.preserveIssueTimes(issue, owner, repo, number)
+	}
+
+	return failures.err("issues")
+}
+
+// updateIssue brings the title, body, state, milestone and labels of a GitLab issue across
+// to the Gitea issue it was migrated to, leaving fields that did not change alone
+func (m *Manager) updateIssue(
+	issue *gitlab.Issue,
+	existing *gitea.Issue,
+	owner, repo string,
+	existingMilestones []*gitea.Milestone,
+	existingLabels []*gitea.Label,
+) error {
+	var author string
+	if issue.Author != nil {
+		author = issue.Author.Username
+	}
+	body := m.editedBody(existing.Body, m.rewriteMarkdown(issue.Description), author, issue.CreatedAt)
+	body, _ = m.importUploads(owner, repo, body, func(name string, content []byte) (*gitea.Attachment, error) {
+		return m.giteaClient.CreateIssueAttachment(owner, repo, existing.Number, name, content)
+	})
+
+	state := "open"
+	if issue.State == "closed" {
+		state = "closed"
+	}
+
+	var option gitea.EditIssueOption
+	changed := false
+	if existing.Title != issue.Title {
+		option.Title = issue.Title
+		changed = true
+	}
+	if existing.Body != body {
+		option.Body = body
+		changed = true
+	}
+	if existing.State != state {
+		option.State = state
+		changed = true
+	}
+	if issue.Milestone != nil {
+		milestoneID := findMilestoneID(existingMilestones, issue.Milestone.Title)
+		if milestoneID != 0 && (existing.Milestone == nil || existing.Milestone.ID != milestoneID) {
+			option.Milestone = milestoneID
+			changed = true
+		}
+	}
+
+	if changed {
+		if _, err := m.giteaClient.EditIssue(owner, repo, existing.Number, option); err != nil {
+			return err
+		}
+		m.log.PrintInfo(fmt.Sprintf("Issue #%d updated", existing.Number))
+		m.deferLinks(linkedBody{number: existing.Number}, issue.Description)
+	}
+
+	labelIDs := append([]int64{}, findLabelIDs(existingLabels, issue.Labels)...)
+	currentIDs := make([]int64, 0, len(existing.Labels))
+	for _, label := range existing.Labels {
+		currentIDs = append(currentIDs, label.ID)
+	}
+	slices.Sort(labelIDs)
+	slices.Sort(currentIDs)
+	if !slices.Equal(labelIDs, currentIDs) {
+		if _, err := m.giteaClient.ReplaceIssueLabels(owner, repo, existing.Number, gitea.IssueLabelsOption{Labels: labelIDs}); err != nil {
+			return fmt.Errorf("failed to update labels: %w", err)
+		}
+		m.log.PrintInfo(fmt.Sprintf("Labels of issue #%d updated", existing.Number))
+	}
+
+	return nil
+}
+
+// syncIssueComments updates the comments of notes edited in GitLab and imports new notes
+func (m *Manager) syncIssueComments(issue *gitlab.Issue, owner, repo string, number, projectID int) error {
+	notes, err := m.gitlabClient.GetIssueNotes(projectID, issue.IID)
+	if err != nil {
+		return fmt.Errorf("failed to get issue notes: %w", err)
+	}
+
+	commentKey := fmt.Sprintf("%s/%s/issues/%d", owner, repo, number)
+	var failures stageErrors
+	for _, note := range notes {
+		if note.System {
+			continue
+		}
+		id, ok := m.state.CommentID(commentKey, fmt.Sprintf("%d", note.ID))
+		if !ok {
+			continue
+		}
+
+		comment, err := m.giteaClient.GetIssueComment(owner, repo, id)
+		if gitea.IsNotFound(err) {
+			m.log.PrintWarning(fmt.Sprintf("Comment %d was deleted in Gitea, not updating it", id))
+			continue
+		} else if err != nil {
+			failures.add(err)
+			continue
+		}
+
+		body := m.editedBody(comment.Body, m.rewriteMarkdown(note.Body), note.Author.Username, note.CreatedAt)
+		body, _ = m.importUploads(owner, repo, body, func(name string, content []byte) (*gitea.Attachment, error) {
+			return m.giteaClient.CreateCommentAttachment(owner, repo, id, name, content)
+		})
+		if body == comment.Body {
+			continue
+		}
+
+		if _, err := m.giteaClient.EditIssueComment(owner, repo, id, gitea.EditIssueCommentOption{Body: body}); err != nil {
+			m.log.PrintError(fmt.Sprintf("Comment %d update failed: %v", id, err))
+			failures.add(err)
+			continue
+		}
+		m.log.PrintInfo(fmt.Sprintf("Comment %d of issue #%d updated", id, number))
+		m.deferLinks(linkedBody{number: number, commentID: id}, note.Body)
+	}
+
+	// Notes not migrated yet are imported like in a migration
+	if err := m.importNotes(notes, commentKey, owner, repo, number); err != nil {
+		failures.add(err)
+	}
+	return failures.err("comments")
+}
+
+// editedBody returns the body to store in Gitea for edited GitLab content, keeping the
+// attribution header if the current Gitea body was posted with one
+func (m *Manager) editedBody(current, body, username string, created *time.Time) string {
+	bodies := m.authoredBodies(body, username, created)
+	if len(bodies) > 1 && strings.HasPrefix(current, "_Originally posted by @") {
+		return bodies[1]
+	}
+	return body
+}
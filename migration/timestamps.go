@@ -0,0 +1,114 @@
+// timestamps.go
+
+// Package migration handles the migration of data from GitLab to Gitea
+package migration
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+)
+
+// preserveIssueTimes copies the creation, update and close times of a GitLab issue to the
+// Gitea issue with the given number and checks the result through the API. It must run
+// after the comments of the issue are imported, as each new comment touches the issue.
+func (m *Manager) preserveIssueTimes(issue *gitlab.Issue, owner, repo string, number int) {
+	if m.giteaDB == nil || m.plan != nil || issue.CreatedAt == nil {
+		return
+	}
+
+	giteaIssue, err := m.giteaClient.GetIssue(owner, repo, number)
+	if err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Failed to fetch issue #%d to set its times: %v", number, err))
+		return
+	}
+
+	updated := latestTime(issue.CreatedAt, issue.UpdatedAt)
+	closed := issue.ClosedAt
+	if giteaIssue.State != "closed" {
+		closed = nil
+	}
+
+	if err := m.giteaDB.SetIssueTimes(giteaIssue.ID, *issue.CreatedAt, updated, closed); err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Failed to set times of issue #%d: %v", number, err))
+		return
+	}
+
+	verified, err := m.giteaClient.GetIssue(owner, repo, number)
+	if err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Failed to verify times of issue #%d: %v", number, err))
+		return
+	}
+	if !sameSecond(verified.Created, *issue.CreatedAt) {
+		m.log.PrintWarning(fmt.Sprintf("Issue #%d was created %s in Gitea instead of %s",
+			number, verified.Created.Format(time.RFC3339), issue.CreatedAt.Format(time.RFC3339)))
+	}
+}
+
+// preserveCommentTimes copies the creation and update times of a GitLab note to the Gitea
+// comment created for it and checks the result through the API
+func (m *Manager) preserveCommentTimes(note *gitlab.Note, owner, repo string, id int64) {
+	if m.giteaDB == nil || m.plan != nil || note.CreatedAt == nil {
+		return
+	}
+
+	updated := latestTime(note.CreatedAt, note.UpdatedAt)
+	if err := m.giteaDB.SetCommentTimes(id, *note.CreatedAt, updated); err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Failed to set times of comment %d: %v", id, err))
+		return
+	}
+
+	verified, err := m.giteaClient.GetIssueComment(owner, repo, id)
+	if err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Failed to verify times of comment %d: %v", id, err))
+		return
+	}
+	if !sameSecond(verified.Created, *note.CreatedAt) {
+		m.log.PrintWarning(fmt.Sprintf("Comment %d was created %s in Gitea instead of %s",
+			id, verified.Created.Format(time.RFC3339), note.CreatedAt.Format(time.RFC3339)))
+	}
+}
+
+// preserveMilestoneTimes copies the creation and update times of a GitLab milestone to the
+// Gitea milestone with the given ID and checks the result through the API. GitLab does not
+// record when a milestone was closed, so closed milestones use their last update instead.
+func (m *Manager) preserveMilestoneTimes(milestone *gitlab.Milestone, owner, repo string, id int64) {
+	if m.giteaDB == nil || m.plan != nil || milestone.CreatedAt == nil {
+		return
+	}
+
+	updated := latestTime(milestone.CreatedAt, milestone.UpdatedAt)
+	var closed *time.Time
+	if milestone.State == "closed" {
+		closed = &updated
+	}
+
+	if err := m.giteaDB.SetMilestoneTimes(id, *milestone.CreatedAt, updated, closed); err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Failed to set times of milestone %s: %v", milestone.Title, err))
+		return
+	}
+
+	verified, err := m.giteaClient.GetMilestone(owner, repo, id)
+	if err != nil {
+		m.log.PrintWarning(fmt.Sprintf("Failed to verify times of milestone %s: %v", milestone.Title, err))
+		return
+	}
+	if !sameSecond(verified.Created, *milestone.CreatedAt) {
+		m.log.PrintWarning(fmt.Sprintf("Milestone %s was created %s in Gitea instead of %s",
+			milestone.Title, verified.Created.Format(time.RFC3339), milestone.CreatedAt.Format(time.RFC3339)))
+	}
+}
+
+// latestTime returns the update time if there is one, and the creation time otherwise
+func latestTime(created, updated *time.Time) time.Time {
+	if updated != nil && updated.After(*created) {
+		return *updated
+	}
+	return *created
+}
+
+// sameSecond reports whether two times are equal to the second, the precision Gitea stores
+func sameSecond(a, b time.Time) bool {
+	return a.Unix() == b.Unix()
+}
@@ -6,35 +6,22 @@ package migration
 import (
 	"fmt"
 	"math/rand"
-	"strings"
 	"time"
 
 	"github.com/xanzy/go-gitlab"
 
-	"github.com/go-i2p/gitlab-to-gitea/utils"
+	"github.com/go-i2p/gitlab-to-gitea/gitea"
 )
 
-// userCreateRequest represents the data needed to create a user in Gitea
-type userCreateRequest struct {
-	Email      string `json:"email"`
-	FullName   string `json:"full_name"`
-	LoginName  string `json:"login_name"`
-	Password   string `json:"password"`
-	SendNotify bool   `json:"send_notify"`
-	SourceID   int    `json:"source_id"`
-	Username   string `json:"username"`
-}
-
 // ImportUser imports a single GitLab user to Gitea
 func (m *Manager) ImportUser(user *gitlab.User, notify bool) error {
-	// Normalize username
-	cleanUsername := utils.NormalizeUsername(user.Username)
+	cleanUsername := m.userName(user.Username)
 
 	// Check if user already exists
 	if exists, err := m.userExists(cleanUsername); err != nil {
 		return fmt.Errorf("failed to check if user exists: %w", err)
 	} else if exists {
-		utils.PrintWarning(fmt.Sprintf("User %s already exists as %s in Gitea, skipping!", user.Username, cleanUsername))
+		m.log.PrintWarning(fmt.Sprintf("User %s already exists as %s in Gitea, skipping!", user.Username, cleanUsername))
 		return nil
 	}
 
@@ -48,7 +35,7 @@ func (m *Manager) ImportUser(user *gitlab.User, notify bool) error {
 	}
 
 	// Create user request
-	userReq := userCreateRequest{
+	userReq := gitea.CreateUserOption{
 		Email:      email,
 		FullName:   user.Name,
 		LoginName:  cleanUsername,
@@ -58,37 +45,34 @@ func (m *Manager) ImportUser(user *gitlab.User, notify bool) error {
 		Username:   cleanUsername,
 	}
 
-	// Debug what endpoint we're calling and with what method
-	utils.PrintInfo("Attempting to create user via: POST /admin/users\n")
-
-	var result map[string]interface{}
-	err := m.giteaClient.Post("/admin/users", userReq, &result)
-	if err != nil {
-		// Try the alternative user creation endpoint if the first one failed
-		utils.PrintInfo("First attempt failed, trying alternative endpoint\n")
-		err = m.giteaClient.Post("/api/v1/admin/users", userReq, &result)
+	if m.plan != nil {
+		m.plan.Add(PlanUser, cleanUsername, user.Username, email)
+		m.plan.addOwner(cleanUsername)
+	} else {
+		created, err := m.giteaClient.AdminCreateUser(userReq)
 		if err != nil {
-			return fmt.Errorf("failed to create user %s: %w", user.Username, err)
+			return m.createUserError(user.Username, cleanUsername, err)
 		}
-	}
+		m.recordGiteaID(IdentityUser, user.ID, created.ID)
 
-	utils.PrintInfo(fmt.Sprintf("User %s created as %s, temporary password: %s", user.Username, cleanUsername, tmpPassword))
+		m.log.PrintInfo(fmt.Sprintf("User %s created as %s, temporary password: %s", user.Username, cleanUsername, tmpPassword))
+	}
 
-	utils.PrintHeader("Importing SSH keys...")
+	m.log.PrintHeader("Importing SSH keys...")
 	// Import user's SSH keys
 	keys, err := m.gitlabClient.GetUserKeys(user.ID)
 	if err != nil {
-		utils.PrintWarning(fmt.Sprintf("Failed to fetch keys for user %s: %v", user.Username, err))
+		m.log.PrintWarning(fmt.Sprintf("Failed to fetch keys for user %s: %v", user.Username, err))
 	} else {
-		utils.PrintInfo(fmt.Sprintf("Found %d keys for user %s", len(keys), user.Username))
+		m.log.PrintInfo(fmt.Sprintf("Found %d keys for user %s", len(keys), user.Username))
 		for _, key := range keys {
-			utils.PrintInfo(fmt.Sprintf("Importing key %s for user %s", key.Title, cleanUsername))
+			m.log.PrintInfo(fmt.Sprintf("Importing key %s for user %s", key.Title, cleanUsername))
 			if err := m.importUserKey(cleanUsername, key); err != nil {
-				utils.PrintWarning(fmt.Sprintf("Failed to import key for user %s: %v", user.Username, err))
+				m.log.PrintWarning(fmt.Sprintf("Failed to import key for user %s: %v", user.Username, err))
 			}
-			utils.PrintInfo(fmt.Sprintf("Key %s imported for user %s", key.Title, cleanUsername))
+			m.log.PrintInfo(fmt.Sprintf("Key %s imported for user %s", key.Title, cleanUsername))
 		}
-		utils.PrintSuccess(fmt.Sprintf("Imported %d keys for user %s", len(keys), cleanUsername))
+		m.log.PrintSuccess(fmt.Sprintf("Imported %d keys for user %s", len(keys), cleanUsername))
 	}
 
 	return nil
@@ -96,7 +80,7 @@ func (m *Manager) ImportUser(user *gitlab.User, notify bool) error {
 
 // ImportPlaceholderUser creates a placeholder user when mentioned user doesn't exist
 func (m *Manager) ImportPlaceholderUser(username string) error {
-	cleanUsername := utils.NormalizeUsername(username)
+	cleanUsername := m.userName(username)
 
 	exists, err := m.userExists(cleanUsername)
 	if err != nil {
@@ -104,14 +88,14 @@ func (m *Manager) ImportPlaceholderUser(username string) error {
 	}
 
 	if exists {
-		utils.PrintWarning(fmt.Sprintf("User %s already exists as %s in Gitea, skipping placeholder creation", username, cleanUsername))
+		m.log.PrintWarning(fmt.Sprintf("User %s already exists as %s in Gitea, skipping placeholder creation", username, cleanUsername))
 		return nil
 	}
 
 	tmpPassword := generateTempPassword()
 
 	// Create user request
-	userReq := userCreateRequest{
+	userReq := gitea.CreateUserOption{
 		Email:      fmt.Sprintf("%s@placeholder-migration.local", cleanUsername),
 		FullName:   username, // Keep original name for display
 		LoginName:  cleanUsername,
@@ -121,58 +105,75 @@ func (m *Manager) ImportPlaceholderUser(username string) error {
 		Username:   cleanUsername,
 	}
 
-	var result map[string]interface{}
-	err = m.giteaClient.Post("/admin/users", userReq, &result)
+	if m.plan != nil {
+		m.plan.Add(PlanPlaceholderUser, cleanUsername, username, "")
+		m.plan.addOwner(cleanUsername)
+		return nil
+	}
+
+	_, err = m.giteaClient.AdminCreateUser(userReq)
 	if err != nil {
-		return fmt.Errorf("failed to create placeholder user %s: %w", username, err)
+		if err := m.createUserError(username, cleanUsername, err); err != nil {
+			return fmt.Errorf("failed to create placeholder user: %w", err)
+		}
+		return nil
 	}
 
-	utils.PrintInfo(fmt.Sprintf("Placeholder user %s created as %s", username, cleanUsername))
+	m.log.PrintInfo(fmt.Sprintf("Placeholder user %s created as %s", username, cleanUsername))
 	return nil
 }
 
 // importUserKey imports a user's SSH key to Gitea
 func (m *Manager) importUserKey(username string, key *gitlab.SSHKey) error {
+	if m.plan != nil && m.plan.hasOwner(username) {
+		m.plan.Add(PlanKey, username, "", key.Title)
+		return nil
+	}
+
 	// Check if key already exists
-	var existingKeys []map[string]interface{}
-	err := m.giteaClient.Get(fmt.Sprintf("/users/%s/keys", username), &existingKeys)
+	existingKeys, err := m.giteaClient.ListUserKeys(username)
 	if err != nil {
 		return fmt.Errorf("failed to get existing keys: %w", err)
 	}
 
 	// Check if key with same title already exists
 	for _, existingKey := range existingKeys {
-		if existingKey["title"] == key.Title {
-			utils.PrintWarning(fmt.Sprintf("Key %s already exists for user %s, skipping", key.Title, username))
+		if existingKey.Title == key.Title {
+			m.log.PrintWarning(fmt.Sprintf("Key %s already exists for user %s, skipping", key.Title, username))
 			return nil
 		}
 	}
 
 	// Create key request
-	keyReq := map[string]string{
-		"key":   key.Key,
-		"title": key.Title,
+	keyReq := gitea.CreateKeyOption{
+		Key:   key.Key,
+		Title: key.Title,
+	}
+
+	if m.plan != nil {
+		m.plan.Add(PlanKey, username, "", key.Title)
+		return nil
 	}
 
 	// Call Gitea API to create key
-	var result map[string]interface{}
-	err = m.giteaClient.Post(fmt.Sprintf("/admin/users/%s/keys", username), keyReq, &result)
+	_, err = m.giteaClient.AdminCreateUserKey(username, keyReq)
 	if err != nil {
 		return fmt.Errorf("failed to create key %s: %w", key.Title, err)
 	}
 
-	utils.PrintInfo(fmt.Sprintf("Key %s imported for user %s", key.Title, username))
+	m.log.PrintInfo(fmt.Sprintf("Key %s imported for user %s", key.Title, username))
 	return nil
 }
 
 // userExists checks if a user exists in Gitea
 func (m *Manager) userExists(username string) (bool, error) {
-	var user map[string]interface{}
-	err := m.giteaClient.Get("/users/"+username, &user)
+	if m.plan != nil && m.plan.hasOwner(username) {
+		return true, nil
+	}
+
+	_, err := m.giteaClient.GetUser(username)
 	if err != nil {
-		// If we get an error, assume user doesn't exist
-		// But only if the error contains "not found" or similar messages
-		if isNotFoundError(err) {
+		if gitea.IsNotFound(err) {
 			return false, nil
 		}
 		return false, fmt.Errorf("error checking if user exists: %w", err)
@@ -180,6 +181,21 @@ func (m *Manager) userExists(username string) (bool, error) {
 	return true, nil
 }
 
+// createUserError explains why creating a user failed. It returns nil when the user turns
+// out to exist after all, which happens when concurrent workers create the same user.
+func (m *Manager) createUserError(username, cleanUsername string, err error) error {
+	if gitea.IsForbidden(err) {
+		return fmt.Errorf("failed to create user %s, the Gitea token needs admin rights: %w", username, err)
+	}
+
+	if exists, existsErr := m.userExists(cleanUsername); existsErr == nil && exists {
+		m.log.PrintWarning(fmt.Sprintf("User %s was created as %s concurrently, skipping!", username, cleanUsername))
+		return nil
+	}
+
+	return fmt.Errorf("failed to create user %s: %w", username, err)
+}
+
 // generateTempPassword creates a random password for new users
 func generateTempPassword() string {
 	const (
@@ -199,10 +215,3 @@ func generateTempPassword() string {
 
 	return prefix + string(result)
 }
-
-// isNotFoundError checks if an error is a 404 Not Found error
-func isNotFoundError(err error) bool {
-	return err != nil && (strings.Contains(err.Error(), "404") ||
-		strings.Contains(err.Error(), "not found") ||
-		strings.Contains(err.Error(), "does not exist"))
-}
@@ -0,0 +1,551 @@
+// verify.go
+
+// Package migration handles the migration of data from GitLab to Gitea
+package migration
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/go-i2p/gitlab-to-gitea/gitea"
+)
+
+// Categories of items compared by a verification
+const (
+	VerifyIssues        = "issues"
+	VerifyComments      = "comments" // per issue
+	VerifyLabels        = "labels"
+	VerifyMilestones    = "milestones"
+	VerifyCollaborators = "collaborators"
+	VerifyBranches      = "branches"
+	VerifyTags          = "tags"
+	VerifyDefaultBranch = "default_branch"
+)
+
+// VerifyDifference is an item present on both sides with different content
+type VerifyDifference struct {
+	Key    string `json:"key"`
+	GitLab string `json:"gitlab"`
+	Gitea  string `json:"gitea"`
+}
+
+// VerifyCategory is the comparison of one category of items of a project
+type VerifyCategory struct {
+	Name        string             `json:"name"`
+	GitLabCount int                `json:"gitlab_count"`
+	GiteaCount  int                `json:"gitea_count"`
+	Missing     []string           `json:"missing"` // in GitLab but not in Gitea
+	Extra       []string           `json:"extra"`   // in Gitea but not in GitLab
+	Differing   []VerifyDifference `json:"differing"`
+	Error       string             `json:"error,omitempty"`
+}
+
+// OK reports whether both sides match
+func (c *VerifyCategory) OK() bool {
+	return c.Error == "" && len(c.Missing) == 0 && len(c.Extra) == 0 && len(c.Differing) == 0
+}
+
+// ProjectVerification is the comparison of a GitLab project with its Gitea repository
+type ProjectVerification struct {
+	Project    string            `json:"project"`    // GitLab path
+	Repository string            `json:"repository"` // Gitea owner/repo
+	Error      string            `json:"error,omitempty"`
+	Categories []*VerifyCategory `json:"categories"`
+}
+
+// OK reports whether the repository matches the project in every category
+func (p *ProjectVerification) OK() bool {
+	if p.Error != "" {
+		return false
+	}
+	for _, category := range p.Categories {
+		if !category.OK() {
+			return false
+		}
+	}
+	return true
+}
+
+// VerifyReport lists the differences between the migrated projects and their repositories
+type VerifyReport struct {
+	Generated time.Time              `json:"generated"`
+	Projects  []*ProjectVerification `json:"projects"`
+}
+
+// Failed returns the number of projects whose repository does not match
+func (r *VerifyReport) Failed() int {
+	failed := 0
+	for _, project := range r.Projects {
+		if !project.OK() {
+			failed++
+		}
+	}
+	return failed
+}
+
+// verifyItems maps the keys of the items of a category to their content, a hash or a
+// value short enough to read in the report
+type verifyItems map[string]string
+
+// add adds an item. Items sharing a key are numbered in the order they are added, so
+// both sides must add them in the same order.
+func (items verifyItems) add(key, value string) {
+	unique := key
+	for n := 2; ; n++ {
+		if _, taken := items[unique]; !taken {
+			break
+		}
+		unique = fmt.Sprintf("%s (%d)", key, n)
+	}
+	items[unique] = value
+}
+
+// contentHash returns a short hash of the fields that make up the content of an item
+func contentHash(fields ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+	return hex.EncodeToString(sum[:6])
+}
+
+// compareItems compares the items of a category on both sides
+func compareItems(name string, gitlabItems, giteaItems verifyItems) *VerifyCategory {
+	category := &VerifyCategory{
+		Name:        name,
+		GitLabCount: len(gitlabItems),
+		GiteaCount:  len(giteaItems),
+		Missing:     []string{},
+		Extra:       []string{},
+		Differing:   []VerifyDifference{},
+	}
+
+	for key, value := range gitlabItems {
+		giteaValue, ok := giteaItems[key]
+		if !ok {
+			category.Missing = append(category.Missing, key)
+		} else if giteaValue != value {
+			category.Differing = append(category.Differing, VerifyDifference{Key: key, GitLab: value, Gitea: giteaValue})
+		}
+	}
+	for key := range giteaItems {
+		if _, ok := gitlabItems[key]; !ok {
+			category.Extra = append(category.Extra, key)
+		}
+	}
+
+	sort.Strings(category.Missing)
+	sort.Strings(category.Extra)
+	sort.Slice(category.Differing, func(i, j int) bool { return category.Differing[i].Key < category.Differing[j].Key })
+	return category
+}
+
+// failedCategory records a category that could not be compared
+func failedCategory(name string, err error) *VerifyCategory {
+	return &VerifyCategory{Name: name, Error: err.Error()}
+}
+
+// VerifyProjects compares every selected GitLab project with its Gitea repository
+func (m *Manager) VerifyProjects() (*VerifyReport, error) {
+	projects, err := m.selectedProjects()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.loadIdentities(); err != nil {
+		return nil, err
+	}
+
+	report := &VerifyReport{Generated: time.Now(), Projects: []*ProjectVerification{}}
+	for _, project := range projects {
+		result := m.verifyProject(project)
+		report.Projects = append(report.Projects, result)
+
+		if result.OK() {
+			m.log.PrintSuccess(fmt.Sprintf("Project %s matches %s", result.Project, result.Repository))
+		} else {
+			m.log.PrintWarning(fmt.Sprintf("Project %s differs from %s", result.Project, result.Repository))
+		}
+	}
+
+	return report, nil
+}
+
+// verifyProject compares a GitLab project with its Gitea repository
+func (m *Manager) verifyProject(project *gitlab.Project) *ProjectVerification {
+	owner, repo := m.projectName(project)
+	result := &ProjectVerification{
+		Project:    project.PathWithNamespace,
+		Repository: owner + "/" + repo,
+		Categories: []*VerifyCategory{},
+	}
+
+	m.log.PrintInfo(fmt.Sprintf("Verifying project %s", project.PathWithNamespace))
+
+	repository, err := m.giteaClient.GetRepo(owner, repo)
+	if gitea.IsNotFound(err) {
+		result.Error = "repository does not exist in Gitea"
+		return result
+	} else if err != nil {
+		result.Error = fmt.Sprintf("failed to get repository: %v", err)
+		return result
+	}
+
+	issues, comments := m.verifyIssues(project, owner, repo)
+	result.Categories = append(result.Categories,
+		issues,
+		comments,
+		m.verifyLabels(project, owner, repo),
+		m.verifyMilestones(project, owner, repo),
+		m.verifyCollaborators(project, owner, repo),
+		m.verifyBranches(project, owner, repo),
+		m.verifyTags(project, owner, repo),
+		compareItems(VerifyDefaultBranch,
+			verifyItems{"default branch": project.DefaultBranch},
+			verifyItems{"default branch": repository.DefaultBranch}),
+	)
+
+	return result
+}
+
+// verifyIssues compares issues by title, state, labels and milestone, and the number of
+// comments of the issues found on both sides
+func (m *Manager) verifyIssues(project *gitlab.Project, owner, repo string) (*VerifyCategory, *VerifyCategory) {
+	gitlabIssues, err := m.gitlabClient.GetProjectIssues(project.ID)
+	if err != nil {
+		return failedCategory(VerifyIssues, err), failedCategory(VerifyComments, err)
+	}
+	giteaIssues, err := m.giteaClient.ListIssues(owner, repo, gitea.ListIssuesOptions{State: "all", Type: "issues"})
+	if err != nil {
+		return failedCategory(VerifyIssues, err), failedCategory(VerifyComments, err)
+	}
+
+	// Issues are matched by title, the same way the migration finds existing ones
+	sort.Slice(gitlabIssues, func(i, j int) bool { return gitlabIssues[i].IID < gitlabIssues[j].IID })
+	sort.Slice(giteaIssues, func(i, j int) bool { return giteaIssues[i].Number < giteaIssues[j].Number })
+
+	gitlabItems, gitlabComments := verifyItems{}, verifyItems{}
+	for _, issue := range gitlabIssues {
+		var milestone string
+		if issue.Milestone != nil {
+			milestone = issue.Milestone.Title
+		}
+		state := issue.State
+		if state == "opened" {
+			state = "open"
+		}
+		labels := append([]string{}, issue.Labels...)
+		sort.Strings(labels)
+
+		gitlabItems.add(issue.Title, contentHash(state, strings.Join(labels, ","), milestone))
+		gitlabComments.add(issue.Title, strconv.Itoa(issue.UserNotesCount))
+	}
+
+	giteaItems, giteaComments := verifyItems{}, verifyItems{}
+	for _, issue := range giteaIssues {
+		// Placeholders for deleted issues and merge requests migrated as issues have no
+		// GitLab issue to compare with
+		if strings.HasPrefix(issue.Title, "[Deleted GitLab issue #") || strings.HasPrefix(issue.Title, "[MR !") {
+			continue
+		}
+
+		var milestone string
+		if issue.Milestone != nil {
+			milestone = issue.Milestone.Title
+		}
+		labels := make([]string, 0, len(issue.Labels))
+		for _, label := range issue.Labels {
+			labels = append(labels, label.Name)
+		}
+		sort.Strings(labels)
+
+		giteaItems.add(issue.Title, contentHash(issue.State, strings.Join(labels, ","), milestone))
+		giteaComments.add(issue.Title, strconv.Itoa(issue.Comments))
+	}
+
+	// Comments are only compared for issues found on both sides
+	for key := range gitlabComments {
+		if _, ok := giteaComments[key]; !ok {
+			delete(gitlabComments, key)
+		}
+	}
+	for key := range giteaComments {
+		if _, ok := gitlabComments[key]; !ok {
+			delete(giteaComments, key)
+		}
+	}
+
+	return compareItems(VerifyIssues, gitlabItems, giteaItems), compareItems(VerifyComments, gitlabComments, giteaComments)
+}
+
+// verifyLabels compares labels by name, color and description
+func (m *Manager) verifyLabels(project *gitlab.Project, owner, repo string) *VerifyCategory {
+	gitlabLabels, err := m.gitlabClient.GetProjectLabels(project.ID)
+	if err != nil {
+		return failedCategory(VerifyLabels, err)
+	}
+	giteaLabels, err := m.giteaClient.ListLabels(owner, repo)
+	if err != nil {
+		return failedCategory(VerifyLabels, err)
+	}
+
+	color := func(c string) string { return strings.ToLower(strings.TrimPrefix(c, "#")) }
+
+	gitlabItems := verifyItems{}
+	for _, label := range gitlabLabels {
+		gitlabItems.add(label.Name, contentHash(color(label.Color), label.Description))
+	}
+	giteaItems := verifyItems{}
+	for _, label := range giteaLabels {
+		giteaItems.add(label.Name, contentHash(color(label.Color), label.Description))
+	}
+
+	return compareItems(VerifyLabels, gitlabItems, giteaItems)
+}
+
+// verifyMilestones compares milestones by title, description and state
+func (m *Manager) verifyMilestones(project *gitlab.Project, owner, repo string) *VerifyCategory {
+	gitlabMilestones, err := m.gitlabClient.GetProjectMilestones(project.ID)
+	if err != nil {
+		return failedCategory(VerifyMilestones, err)
+	}
+	giteaMilestones, err := m.giteaClient.ListMilestones(owner, repo)
+	if err != nil {
+		return failedCategory(VerifyMilestones, err)
+	}
+
+	gitlabItems := verifyItems{}
+	for _, milestone := range gitlabMilestones {
+		state := milestone.State
+		if state == "active" {
+			state = "open"
+		}
+		gitlabItems.add(milestone.Title, contentHash(milestone.Description, state))
+	}
+	giteaItems := verifyItems{}
+	for _, milestone := range giteaMilestones {
+		giteaItems.add(milestone.Title, contentHash(milestone.Description, milestone.State))
+	}
+
+	return compareItems(VerifyMilestones, gitlabItems, giteaItems)
+}
+
+// verifyCollaborators compares the members of a project with the collaborators of its
+// repository, by Gitea user name
+func (m *Manager) verifyCollaborators(project *gitlab.Project, owner, repo string) *VerifyCategory {
+	members, err := m.gitlabClient.GetProjectMembers(project.ID)
+	if err != nil {
+		return failedCategory(VerifyCollaborators, err)
+	}
+	collaborators, err := m.giteaClient.ListCollaborators(owner, repo)
+	if err != nil {
+		return failedCategory(VerifyCollaborators, err)
+	}
+
+	gitlabItems := verifyItems{}
+	for _, member := range members {
+		// The owner of a personal repository cannot be one of its collaborators
+		if name := m.userName(member.Username); name != owner {
+			gitlabItems.add(name, "")
+		}
+	}
+	giteaItems := verifyItems{}
+	for _, collaborator := range collaborators {
+		giteaItems.add(collaborator.Login, "")
+	}
+
+	return compareItems(VerifyCollaborators, gitlabItems, giteaItems)
+}
+
+// verifyBranches compares branches by name and head commit
+func (m *Manager) verifyBranches(project *gitlab.Project, owner, repo string) *VerifyCategory {
+	gitlabBranches, err := m.gitlabClient.GetProjectBranches(project.ID)
+	if err != nil {
+		return failedCategory(VerifyBranches, err)
+	}
+	giteaBranches, err := m.giteaClient.ListBranches(owner, repo)
+	if err != nil {
+		return failedCategory(VerifyBranches, err)
+	}
+
+	gitlabItems := verifyItems{}
+	for _, branch := range gitlabBranches {
+		var commit string
+		if branch.Commit != nil {
+			commit = branch.Commit.ID
+		}
+		gitlabItems.add(branch.Name, commit)
+	}
+	giteaItems := verifyItems{}
+	for _, branch := range giteaBranches {
+		// Branches restored for the pull requests of merge requests only exist in Gitea
+		if strings.HasPrefix(branch.Name, "gitlab-mr-") {
+			continue
+		}
+		var commit string
+		if branch.Commit != nil {
+			commit = branch.Commit.ID
+		}
+		giteaItems.add(branch.Name, commit)
+	}
+
+	return compareItems(VerifyBranches, gitlabItems, giteaItems)
+}
+
+// verifyTags compares tags by name and commit
+func (m *Manager) verifyTags(project *gitlab.Project, owner, repo string) *VerifyCategory {
+	gitlabTags, err := m.gitlabClient.GetProjectTags(project.ID)
+	if err != nil {
+		return failedCategory(VerifyTags, err)
+	}
+	giteaTags, err := m.giteaClient.ListTags(owner, repo)
+	if err != nil {
+		return failedCategory(VerifyTags, err)
+	}
+
+	gitlabItems := verifyItems{}
+	for _, tag := range gitlabTags {
+		var commit string
+		if tag.Commit != nil {
+			commit = tag.Commit.ID
+		}
+		gitlabItems.add(tag.Name, commit)
+	}
+	giteaItems := verifyItems{}
+	for _, tag := range giteaTags {
+		var commit string
+		if tag.Commit != nil {
+			commit = tag.Commit.SHA
+		}
+		giteaItems.add(tag.Name, commit)
+	}
+
+	return compareItems(VerifyTags, gitlabItems, giteaItems)
+}
+
+// Markdown returns the report as Markdown
+func (r *VerifyReport) Markdown() string {
+	code := func(s string) string { return "`" + strings.ReplaceAll(s, "`", "'") + "`" }
+
+	var b strings.Builder
+	fmt.Fprintln(&b, "# Migration verification")
+	fmt.Fprintln(&b)
+	fmt.Fprintf(&b, "Generated %s. %d projects verified, %d with differences.\n",
+		r.Generated.Format(time.RFC3339), len(r.Projects), r.Failed())
+
+	for _, project := range r.Projects {
+		status := "matches"
+		if !project.OK() {
+			status = "differs"
+		}
+		fmt.Fprintln(&b)
+		fmt.Fprintf(&b, "## %s → %s (%s)\n", project.Project, project.Repository, status)
+		fmt.Fprintln(&b)
+
+		if project.Error != "" {
+			fmt.Fprintf(&b, "Error: %s\n", project.Error)
+			continue
+		}
+
+		fmt.Fprintln(&b, "| Category | GitLab | Gitea | Missing | Extra | Differing |")
+		fmt.Fprintln(&b, "|---|---:|---:|---:|---:|---:|")
+		for _, c := range project.Categories {
+			if c.Error != "" {
+				fmt.Fprintf(&b, "| %s | error: %s | | | | |\n", c.Name, strings.ReplaceAll(c.Error, "|", "\\|"))
+				continue
+			}
+			fmt.Fprintf(&b, "| %s | %d | %d | %d | %d | %d |\n",
+				c.Name, c.GitLabCount, c.GiteaCount, len(c.Missing), len(c.Extra), len(c.Differing))
+		}
+
+		for _, c := range project.Categories {
+			if c.OK() || c.Error != "" {
+				continue
+			}
+			fmt.Fprintln(&b)
+			fmt.Fprintf(&b, "### %s\n\n", c.Name)
+			for _, key := range c.Missing {
+				fmt.Fprintf(&b, "- missing %s\n", code(key))
+			}
+			for _, key := range c.Extra {
+				fmt.Fprintf(&b, "- extra %s\n", code(key))
+			}
+			for _, d := range c.Differing {
+				fmt.Fprintf(&b, "- differs %s: GitLab %s, Gitea %s\n", code(d.Key), code(d.GitLab), code(d.Gitea))
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// verifyHTML renders a report as a standalone HTML page
+var verifyHTML = template.Must(template.New("verify").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Migration verification</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; }
+.ok { color: #2a7d2a; }
+.differs { color: #b22222; }
+code { background: #f4f4f4; }
+</style>
+</head>
+<body>
+<h1>Migration verification</h1>
+<p>Generated {{.Generated.Format "2006-01-02T15:04:05Z07:00"}}. {{len .Projects}} projects verified, {{.Failed}} with differences.</p>
+{{range .Projects}}
+<h2 class="{{if .OK}}ok{{else}}differs{{end}}">{{.Project}} → {{.Repository}}</h2>
+{{if .Error}}<p>Error: {{.Error}}</p>{{else}}
+<table>
+<tr><th>Category</th><th>GitLab</th><th>Gitea</th><th>Missing</th><th>Extra</th><th>Differing</th></tr>
+{{range .Categories}}{{if .Error}}<tr class="differs"><td>{{.Name}}</td><td colspan="5">error: {{.Error}}</td></tr>
+{{else}}<tr class="{{if .OK}}ok{{else}}differs{{end}}"><td>{{.Name}}</td><td>{{.GitLabCount}}</td><td>{{.GiteaCount}}</td><td>{{len .Missing}}</td><td>{{len .Extra}}</td><td>{{len .Differing}}</td></tr>
+{{end}}{{end}}</table>
+{{range .Categories}}{{if and (not .OK) (not .Error)}}
+<h3>{{.Name}}</h3>
+<ul>
+{{range .Missing}}<li>missing <code>{{.}}</code></li>
+{{end}}{{range .Extra}}<li>extra <code>{{.}}</code></li>
+{{end}}{{range .Differing}}<li>differs <code>{{.Key}}</code>: GitLab <code>{{.GitLab}}</code>, Gitea <code>{{.Gitea}}</code></li>
+{{end}}</ul>
+{{end}}{{end}}{{end}}{{end}}
+</body>
+</html>
+`))
+
+// Write saves the report as JSON to filePath, and as Markdown and HTML next to it with
+// .md and .html extensions
+func (r *VerifyReport) Write(filePath string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal verification report: %w", err)
+	}
+	if err := os.WriteFile(filePath, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write verification report: %w", err)
+	}
+
+	basePath := strings.TrimSuffix(filePath, ".json")
+	if err := os.WriteFile(basePath+".md", []byte(r.Markdown()), 0o644); err != nil {
+		return fmt.Errorf("failed to write Markdown report: %w", err)
+	}
+
+	var page strings.Builder
+	if err := verifyHTML.Execute(&page, r); err != nil {
+		return fmt.Errorf("failed to render HTML report: %w", err)
+	}
+	if err := os.WriteFile(basePath+".html", []byte(page.String()), 0o644); err != nil {
+		return fmt.Errorf("failed to write HTML report: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,229 @@
+// wiki.go
+
+// Package migration handles the migration of data from GitLab to Gitea
+package migration
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/xanzy/go-gitlab"
+
+	"github.com/go-i2p/gitlab-to-gitea/gitea"
+	"github.com/go-i2p/gitlab-to-gitea/utils"
+)
+
+// wikiCommitMessage is the message of the commit that converts a wiki for Gitea
+const wikiCommitMessage = "Convert GitLab wiki to Gitea conventions"
+
+// wikiPlaceholder is the content of the page a Gitea wiki is created with before the
+// GitLab wiki is pushed over it
+const wikiPlaceholder = "Migrating wiki from GitLab..."
+
+// importProjectWiki copies the wiki of a GitLab project into the wiki of its Gitea
+// repository. GitLab keeps wikis in a separate <project>.wiki.git repository, which is
+// cloned, converted to Gitea's page names and links in one extra commit, and pushed with
+// its full history. Gitea wikis that already have pages are left alone, unless the only
+// page is the placeholder of a push that failed.
+func (m *Manager) importProjectWiki(project *gitlab.Project, owner, repo string) error {
+	if !project.WikiEnabled {
+		return nil
+	}
+
+	pages, err := m.gitlabClient.GetProjectWikiPages(project.ID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch wiki pages: %w", err)
+	}
+	if len(pages) == 0 {
+		return nil
+	}
+
+	m.log.PrintInfo(fmt.Sprintf("Found %d wiki pages for project %s", len(pages), repo))
+
+	placeholder := false
+	if !m.plannedRepo(owner, repo) {
+		existing, err := m.giteaClient.ListWikiPages(owner, repo)
+		if err != nil && !gitea.IsNotFound(err) {
+			return fmt.Errorf("failed to get existing wiki pages: %w", err)
+		}
+		if len(existing) > 0 {
+			if placeholder, err = m.isWikiPlaceholder(owner, repo, existing); err != nil {
+				return err
+			}
+			if !placeholder {
+				m.log.PrintWarning(fmt.Sprintf("Wiki of project %s already exists in Gitea, skipping!", repo))
+				return nil
+			}
+			m.log.PrintWarning(fmt.Sprintf("Wiki of project %s was left incomplete, importing it again", repo))
+		}
+	}
+
+	if m.plan != nil {
+		m.plan.Add(PlanWiki, owner+"/"+repo, project.PathWithNamespace, fmt.Sprintf("%d pages", len(pages)))
+		return nil
+	}
+
+	dir, err := os.MkdirTemp("", "wiki-")
+	if err != nil {
+		return fmt.Errorf("failed to create working directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	source, sourceAuth := m.gitlabRemote(project)
+	if err := runGit("", sourceAuth, "clone", "--quiet", wikiURL(source), dir); err != nil {
+		return fmt.Errorf("failed to clone wiki: %w", err)
+	}
+
+	changed, err := m.convertWiki(dir)
+	if err != nil {
+		return fmt.Errorf("failed to convert wiki: %w", err)
+	}
+	if changed {
+		if err := runGit(dir, nil, "add", "--all"); err != nil {
+			return fmt.Errorf("failed to stage converted wiki: %w", err)
+		}
+		err := runGit(dir, nil, "-c", "user.name=gitlab-to-gitea", "-c", "user.email=gitlab-to-gitea@localhost",
+			"commit", "--quiet", "-m", wikiCommitMessage)
+		if err != nil {
+			return fmt.Errorf("failed to commit converted wiki: %w", err)
+		}
+	}
+
+	// Gitea only accepts pushes to a wiki that exists, so it is created with a page that
+	// the push replaces. Should the push fail, the next run finds the placeholder alone.
+	if !placeholder {
+		_, err = m.giteaClient.CreateWikiPage(owner, repo, gitea.CreateWikiPageOption{
+			Title:         "Home",
+			ContentBase64: base64.StdEncoding.EncodeToString([]byte(wikiPlaceholder)),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create wiki: %w", err)
+		}
+	}
+
+	target := m.giteaClient.WikiCloneURL(owner, repo)
+	targetAuth := []utils.GitAuth{m.giteaClient.GitAuth()}
+	branch, err := remoteDefaultBranch(target, targetAuth)
+	if err != nil {
+		return fmt.Errorf("failed to find wiki branch: %w", err)
+	}
+	if err := runGit(dir, targetAuth, "push", "--quiet", "--force", target, "HEAD:refs/heads/"+branch); err != nil {
+		return fmt.Errorf("failed to push wiki: %w", err)
+	}
+
+	m.log.PrintInfo(fmt.Sprintf("Wiki of project %s imported!", repo))
+	return nil
+}
+
+// convertWiki renames the pages of a cloned GitLab wiki and rewrites their links the way
+// Gitea expects them. It reports whether any file changed.
+func (m *Manager) convertWiki(dir string) (bool, error) {
+	// Collect the pages first, so renamed pages are not converted twice
+	var pages []string
+	err := filepath.WalkDir(dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if utils.IsWikiPage(rel) {
+			pages = append(pages, rel)
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(rel)) {
+		case ".rdoc", ".asciidoc", ".adoc", ".org", ".textile", ".rst":
+			m.log.PrintWarning(fmt.Sprintf("Wiki page %s is not Markdown, Gitea will not render it", rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	for _, page := range pages {
+		file := filepath.Join(dir, filepath.FromSlash(page))
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return changed, err
+		}
+
+		converted := utils.ConvertWikiLinks(string(content), page)
+		target := utils.WikiPagePath(page)
+		if converted == string(content) && target == page {
+			continue
+		}
+
+		if target != page {
+			if err := os.Remove(file); err != nil {
+				return changed, err
+			}
+		}
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(target)), []byte(converted), 0o644); err != nil {
+			return changed, err
+		}
+		changed = true
+	}
+
+	return changed, nil
+}
+
+// isWikiPlaceholder reports whether the only page of a Gitea wiki is the placeholder it
+// was created with, which means the GitLab wiki was never pushed
+func (m *Manager) isWikiPlaceholder(owner, repo string, pages []*gitea.WikiPage) (bool, error) {
+	if len(pages) != 1 || pages[0].Title != "Home" {
+		return false, nil
+	}
+
+	page, err := m.giteaClient.GetWikiPage(owner, repo, "Home")
+	if err != nil {
+		return false, fmt.Errorf("failed to get wiki page: %w", err)
+	}
+	content, err := base64.StdEncoding.DecodeString(page.ContentBase64)
+	if err != nil {
+		return false, fmt.Errorf("failed to decode wiki page: %w", err)
+	}
+	return strings.TrimSpace(string(content)) == wikiPlaceholder, nil
+}
+
+// wikiURL returns the URL of the wiki repository belonging to a repository URL
+func wikiURL(repoURL string) string {
+	return strings.TrimSuffix(repoURL, ".git") + ".wiki.git"
+}
+
+// remoteDefaultBranch returns the branch HEAD points to in a remote repository
+func remoteDefaultBranch(remote string, auth []utils.GitAuth) (string, error) {
+	output, err := utils.RunGit("", auth, nil, "ls-remote", "--symref", remote, "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		if ref, ok := strings.CutPrefix(line, "ref: refs/heads/"); ok {
+			branch, _, _ := strings.Cut(ref, "\t")
+			return branch, nil
+		}
+	}
+	return "", fmt.Errorf("remote has no default branch")
+}
+
+// runGit runs a git command in dir that authenticates to remotes with auth
+func runGit(dir string, auth []utils.GitAuth, args ...string) error {
+	_, err := utils.RunGit(dir, auth, nil, args...)
+	return err
+}
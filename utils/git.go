@@ -0,0 +1,60 @@
+// git.go
+
+// Package utils provides utility functions used throughout the application
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+)
+
+// urlUserinfoPattern matches the user name and password part of a URL
+var urlUserinfoPattern = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.\-]*://)[^/@\s]+@`)
+
+// GitAuth holds the credentials git sends to the remotes below a URL. They are handed to
+// git through its environment as an authorization header, so they show up neither on the
+// command line, where any user can read them, nor in the messages of failed commands.
+type GitAuth struct {
+	URL      string // prefix of the remote URLs the credentials are sent to
+	Username string
+	Password string
+}
+
+// RunGit runs a git command in dir with the given input and returns its output. git
+// never prompts for credentials, and URLs in its error messages are stripped of any.
+func RunGit(dir string, auth []GitAuth, input io.Reader, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = gitEnv(auth)
+	cmd.Stdin = input
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git failed: %w: %s", err, RedactURLs(stderr.String()))
+	}
+	return output, nil
+}
+
+// gitEnv returns the environment of a git command sending the given credentials
+func gitEnv(auth []GitAuth) []string {
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0", fmt.Sprintf("GIT_CONFIG_COUNT=%d", len(auth)))
+	for i, a := range auth {
+		credentials := base64.StdEncoding.EncodeToString([]byte(a.Username + ":" + a.Password))
+		env = append(env,
+			fmt.Sprintf("GIT_CONFIG_KEY_%d=http.%s.extraHeader", i, a.URL),
+			fmt.Sprintf("GIT_CONFIG_VALUE_%d=Authorization: Basic %s", i, credentials))
+	}
+	return env
+}
+
+// RedactURLs removes user names and passwords from the URLs in text
+func RedactURLs(text string) string {
+	return urlUserinfoPattern.ReplaceAllString(text, "${1}")
+}
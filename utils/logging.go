@@ -4,7 +4,10 @@
 package utils
 
 import (
+	"bytes"
 	"fmt"
+	"os"
+	"sync"
 )
 
 // Color codes for terminal output
@@ -19,27 +22,107 @@ const (
 	colorBold   = "\033[1m"
 )
 
+// stdoutMutex keeps lines and flushed buffers from different goroutines from interleaving
+var stdoutMutex sync.Mutex
+
+// Logger prints colored messages, either directly to stdout or into a buffer
+// that is written out in one piece by Flush. A nil Logger prints to stdout.
+type Logger struct {
+	mutex  sync.Mutex
+	buffer *bytes.Buffer
+}
+
+// defaultLogger is used by the package-level Print functions
+var defaultLogger = &Logger{}
+
+// DefaultLogger returns the logger that prints directly to stdout
+func DefaultLogger() *Logger {
+	return defaultLogger
+}
+
+// NewBufferedLogger creates a logger that holds its output until Flush is called
+func NewBufferedLogger() *Logger {
+	return &Logger{buffer: &bytes.Buffer{}}
+}
+
+// Flush writes all buffered output to stdout without interleaving it with other output
+func (l *Logger) Flush() {
+	if l == nil || l.buffer == nil {
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	stdoutMutex.Lock()
+	os.Stdout.Write(l.buffer.Bytes())
+	stdoutMutex.Unlock()
+
+	l.buffer.Reset()
+}
+
+// println prints a single colored line
+func (l *Logger) println(color, message string) {
+	line := color + message + colorReset
+
+	if l == nil || l.buffer == nil {
+		stdoutMutex.Lock()
+		fmt.Println(line)
+		stdoutMutex.Unlock()
+		return
+	}
+
+	l.mutex.Lock()
+	fmt.Fprintln(l.buffer, line)
+	l.mutex.Unlock()
+}
+
+// PrintHeader prints a header text with purple color
+func (l *Logger) PrintHeader(message string) {
+	l.println(colorPurple+colorBold, message)
+}
+
+// PrintInfo prints an informational message with blue color
+func (l *Logger) PrintInfo(message string) {
+	l.println(colorBlue, message)
+}
+
+// PrintSuccess prints a success message with green color
+func (l *Logger) PrintSuccess(message string) {
+	l.println(colorGreen, message)
+}
+
+// PrintWarning prints a warning message with yellow color
+func (l *Logger) PrintWarning(message string) {
+	l.println(colorYellow, message)
+}
+
+// PrintError prints an error message with red color
+func (l *Logger) PrintError(message string) {
+	l.println(colorRed, message)
+}
+
 // PrintHeader prints a header text with purple color
 func PrintHeader(message string) {
-	fmt.Println(colorPurple + colorBold + message + colorReset)
+	defaultLogger.PrintHeader(message)
 }
 
 // PrintInfo prints an informational message with blue color
 func PrintInfo(message string) {
-	fmt.Println(colorBlue + message + colorReset)
+	defaultLogger.PrintInfo(message)
 }
 
 // PrintSuccess prints a success message with green color
 func PrintSuccess(message string) {
-	fmt.Println(colorGreen + message + colorReset)
+	defaultLogger.PrintSuccess(message)
 }
 
 // PrintWarning prints a warning message with yellow color
 func PrintWarning(message string) {
-	fmt.Println(colorYellow + message + colorReset)
+	defaultLogger.PrintWarning(message)
 }
 
 // PrintError prints an error message with red color and increments the global error count
 func PrintError(message string) {
-	fmt.Println(colorRed + message + colorReset)
+	defaultLogger.PrintError(message)
 }
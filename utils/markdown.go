@@ -0,0 +1,361 @@
+// markdown.go
+
+// Package utils provides utility functions used throughout the application
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// projectPathPattern matches a GitLab project path, with or without its namespace
+const projectPathPattern = `[A-Za-z0-9_][A-Za-z0-9_.\-]*(?:/[A-Za-z0-9_][A-Za-z0-9_.\-]*)*`
+
+var (
+	// fencePattern matches the line opening or closing a fenced code block
+	fencePattern = regexp.MustCompile("^ {0,3}(```|~~~)")
+	// indentedCodePattern matches a line of an indented code block
+	indentedCodePattern = regexp.MustCompile(`^(?: {4}|\t)`)
+	// urlPattern matches absolute URLs, which are never rewritten
+	urlPattern = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.\-]*://[^\s<>()\[\]]+`)
+	// referencePattern matches GitLab references: issues, merge requests and commits,
+	// optionally of another project, and labels and milestones, optionally quoted
+	referencePattern = regexp.MustCompile(`(^|[^\w/.\-&])(?:` +
+		`(` + projectPathPattern + `)?([#!])(\d+)\b` +
+		`|(` + projectPathPattern + `)@([0-9a-f]{7,40})\b` +
+		`|~"([^"]+)"|~([A-Za-z](?:[\w.:\-]*\w)?)` +
+		`|%"([^"]+)"|%([A-Za-z](?:[\w.\-]*\w)?))`)
+	// uploadPattern matches links to files uploaded to a GitLab project
+	uploadPattern = regexp.MustCompile(`([("])/uploads/([0-9a-f]{32}/[^)"\s]+)`)
+)
+
+// UploadLink is a link to a file uploaded to a GitLab project
+type UploadLink struct {
+	URL      string // the link as it appears in the text
+	Secret   string
+	Filename string
+}
+
+// MarkdownRewriter translates the GitLab-specific Markdown of issues, merge requests and
+// comments into Markdown that renders the same way in Gitea. Code blocks, inline code and
+// URLs are left untouched, and every line of a text stays on its own line.
+type MarkdownRewriter struct {
+	GitLabURL string // base URL of GitLab, for links to content that was not migrated
+	Project   string // GitLab path of the project the text belongs to
+
+	// Projects maps lower-case GitLab project paths to the Gitea repositories, as
+	// owner/repo, they are migrated to
+	Projects map[string]string
+	// Issue returns the number of the Gitea issue an issue of a Gitea repository was
+	// migrated to; nil keeps issue numbers as they are
+	Issue func(repo string, iid int) (int, bool)
+	// PullRequest returns the number of the Gitea pull request a merge request of a Gitea
+	// repository was migrated to
+	PullRequest func(repo string, iid int) (int, bool)
+	// Labels and Milestones map the names known in the project to the Gitea URL they link
+	// to. Names without a URL are kept as inline code.
+	Labels     map[string]string
+	Milestones map[string]string
+	// Mentions resolves mentions to GitLab users; nil treats every mention as a user
+	Mentions *MentionMap
+}
+
+// Rewrite translates GitLab Markdown to Gitea Markdown:
+//
+//   - issue (#12) and merge request (!12) references point to the migrated issue or pull
+//     request. References whose number is not known stay as they are, as # followed by
+//     digits may be anything from a hex colour to an issue imported later (see
+//     HasUnresolvedReferences).
+//   - references to other projects (group/project#45, group/project@sha) use the name of
+//     their Gitea repository, or link to GitLab if the project was not migrated
+//   - label (~bug, ~"needs review") and milestone (%v1.0, %"Sprint 3") references link
+//     to the label or milestone in Gitea
+//   - links to uploads (/uploads/<secret>/file.png) point to GitLab, where they still live
+//   - mentions of GitLab users use their Gitea usernames
+func (r *MarkdownRewriter) Rewrite(text string) string {
+	if text == "" {
+		return text
+	}
+
+	text = rewriteLines(text, func(line string) string {
+		return rewriteText(line, func(text string) string {
+			text = referencePattern.ReplaceAllStringFunc(text, r.rewriteReference)
+			return uploadPattern.ReplaceAllString(text, "${1}"+r.projectURL(r.Project)+"/uploads/${2}")
+		})
+	})
+
+	return r.Mentions.Rewrite(text)
+}
+
+// UploadLinks returns the distinct links to files uploaded to the current project in a
+// text that Rewrite has pointed to GitLab
+func (r *MarkdownRewriter) UploadLinks(text string) []UploadLink {
+	pattern := regexp.MustCompile(regexp.QuoteMeta(r.projectURL(r.Project)) + `/uploads/([0-9a-f]{32})/([^)"\s]+)`)
+
+	var links []UploadLink
+	seen := map[string]bool{}
+	for _, match := range pattern.FindAllStringSubmatch(text, -1) {
+		if seen[match[0]] {
+			continue
+		}
+		seen[match[0]] = true
+
+		filename, err := url.PathUnescape(match[2])
+		if err != nil {
+			filename = match[2]
+		}
+		links = append(links, UploadLink{URL: match[0], Secret: match[1], Filename: filename})
+	}
+	return links
+}
+
+// rewriteReference rewrites a single match of referencePattern
+func (r *MarkdownRewriter) rewriteReference(match string) string {
+	parts := referencePattern.FindStringSubmatch(match)
+	prefix := parts[1]
+
+	switch {
+	case parts[3] != "":
+		iid, err := strconv.Atoi(parts[4])
+		if err != nil {
+			return match
+		}
+		if rewritten, ok := r.issueReference(parts[2], parts[3], iid); ok {
+			return prefix + rewritten
+		}
+	case parts[6] != "":
+		if rewritten, ok := r.commitReference(parts[5], parts[6]); ok {
+			return prefix + rewritten
+		}
+	case parts[7] != "" || parts[8] != "":
+		if rewritten, ok := namedReference(r.Labels, parts[7]+parts[8]); ok {
+			return prefix + rewritten
+		}
+	case parts[9] != "" || parts[10] != "":
+		if rewritten, ok := namedReference(r.Milestones, parts[9]+parts[10]); ok {
+			return prefix + rewritten
+		}
+	}
+
+	return match
+}
+
+// issueReference rewrites a reference to an issue (#) or merge request (!). It reports
+// false for references that should stay as they are.
+func (r *MarkdownRewriter) issueReference(ref, kind string, iid int) (string, bool) {
+	fullPath, repo := r.resolveProject(ref)
+	// Issues of the same project keep their number without a mapping
+	if ref == "" && kind == "#" && (repo == "" || r.Issue == nil) {
+		return "", false
+	}
+	// A bare word before # or ! is only a reference if it names a sibling project
+	if repo == "" && ref != "" && !strings.Contains(ref, "/") {
+		return "", false
+	}
+
+	if kind == "#" && repo != "" && r.Issue == nil {
+		return fmt.Sprintf("%s#%d", r.repoPrefix(repo), iid), true
+	}
+
+	if repo == "" {
+		return fmt.Sprintf("[%s%s%d](%s/-/%s/%d)", ref, kind, iid, r.projectURL(fullPath), referencePaths[kind], iid), true
+	}
+
+	if number, ok := r.number(repo, kind, iid); ok {
+		return fmt.Sprintf("%s#%d", r.repoPrefix(repo), number), true
+	}
+	return "", false
+}
+
+// referencePaths are the GitLab URL paths of issues (#) and merge requests (!)
+var referencePaths = map[string]string{"#": "issues", "!": "merge_requests"}
+
+// number returns the Gitea number of an issue (#) or merge request (!) of a migrated
+// repository, if it is known
+func (r *MarkdownRewriter) number(repo, kind string, iid int) (int, bool) {
+	lookup := r.PullRequest
+	if kind == "#" {
+		lookup = r.Issue
+	}
+	if repo == "" || lookup == nil {
+		return 0, false
+	}
+	return lookup(repo, iid)
+}
+
+// HasUnresolvedReferences reports whether a GitLab text holds references to issues or
+// merge requests of migrated projects whose Gitea numbers are not known yet. Rewrite
+// leaves them as they are, so the text is rewritten again once they are imported.
+func (r *MarkdownRewriter) HasUnresolvedReferences(text string) bool {
+	found := false
+	rewriteLines(text, func(line string) string {
+		return rewriteText(line, func(text string) string {
+			for _, parts := range referencePattern.FindAllStringSubmatch(text, -1) {
+				if parts[3] == "" {
+					continue
+				}
+				if iid, err := strconv.Atoi(parts[4]); err == nil && r.unresolvedReference(parts[2], parts[3], iid) {
+					found = true
+				}
+			}
+			return text
+		})
+	})
+	return found
+}
+
+// unresolvedReference reports whether a reference to an issue (#) or merge request (!)
+// names a migrated project but not a number known to have been migrated
+func (r *MarkdownRewriter) unresolvedReference(ref, kind string, iid int) bool {
+	_, repo := r.resolveProject(ref)
+	if repo == "" || (kind == "#" && r.Issue == nil) {
+		return false
+	}
+	_, ok := r.number(repo, kind, iid)
+	return !ok
+}
+
+// commitReference rewrites a reference to a commit of another project
+func (r *MarkdownRewriter) commitReference(ref, sha string) (string, bool) {
+	if !strings.Contains(ref, "/") {
+		return "", false
+	}
+
+	fullPath, repo := r.resolveProject(ref)
+	if repo == "" {
+		return fmt.Sprintf("[%s@%s](%s/-/commit/%s)", ref, sha, r.projectURL(fullPath), sha), true
+	}
+	return fmt.Sprintf("%s@%s", repo, sha), true
+}
+
+// namedReference rewrites a reference to a label or milestone known by name
+func namedReference(known map[string]string, name string) (string, bool) {
+	link, ok := known[name]
+	if !ok {
+		return "", false
+	}
+	if link == "" {
+		return "`" + name + "`", true
+	}
+	return fmt.Sprintf("[%s](%s)", name, link), true
+}
+
+// resolveProject returns the full GitLab path of a project reference and the Gitea
+// repository the project was migrated to, or "" if it was not. Paths without a namespace
+// refer to a project in the namespace of the current project.
+func (r *MarkdownRewriter) resolveProject(ref string) (string, string) {
+	fullPath := ref
+	if ref == "" {
+		fullPath = r.Project
+	} else if !strings.Contains(ref, "/") {
+		fullPath = path.Dir(r.Project) + "/" + ref
+	}
+	return fullPath, r.Projects[strings.ToLower(fullPath)]
+}
+
+// repoPrefix returns how a reference names a Gitea repository: not at all for the
+// repository of the current project, owner/repo otherwise
+func (r *MarkdownRewriter) repoPrefix(repo string) string {
+	if repo == r.Projects[strings.ToLower(r.Project)] {
+		return ""
+	}
+	return repo
+}
+
+// projectURL returns the URL of a project in GitLab
+func (r *MarkdownRewriter) projectURL(projectPath string) string {
+	return strings.TrimSuffix(r.GitLabURL, "/") + "/" + projectPath
+}
+
+// rewriteLines calls fn for every line outside fenced and indented code blocks and
+// replaces the line with the result. An indented code block starts with a line indented
+// by four spaces or a tab after a blank line, as it cannot interrupt a paragraph.
+func rewriteLines(text string, fn func(line string) string) string {
+	lines := strings.Split(text, "\n")
+	result := make([]string, 0, len(lines))
+
+	fence := ""
+	indented := false
+	blank := true
+	for _, line := range lines {
+		if fence == "" && indentedCodePattern.MatchString(line) && (indented || blank) {
+			indented = true
+			result = append(result, line)
+			continue
+		}
+		blank = strings.TrimSpace(line) == ""
+		if !blank {
+			indented = false
+		}
+
+		if marker := fencePattern.FindStringSubmatch(line); marker != nil {
+			if fence == "" {
+				fence = marker[1]
+			} else if marker[1] == fence {
+				fence = ""
+			}
+			result = append(result, line)
+			continue
+		}
+
+		if fence != "" {
+			result = append(result, line)
+			continue
+		}
+
+		result = append(result, fn(line))
+	}
+
+	return strings.Join(result, "\n")
+}
+
+// rewriteText calls fn for the parts of a line outside inline code spans and URLs
+func rewriteText(line string, fn func(text string) string) string {
+	var b strings.Builder
+
+	for line != "" {
+		start := strings.Index(line, "`")
+		if start < 0 {
+			b.WriteString(rewriteOutsideURLs(line, fn))
+			break
+		}
+
+		// A code span ends with a run of as many backticks as it starts with
+		end := start
+		for end < len(line) && line[end] == '`' {
+			end++
+		}
+		ticks := line[start:end]
+		closing := strings.Index(line[end:], ticks)
+		if closing < 0 {
+			b.WriteString(rewriteOutsideURLs(line, fn))
+			break
+		}
+		closing += end + len(ticks)
+
+		b.WriteString(rewriteOutsideURLs(line[:start], fn))
+		b.WriteString(line[start:closing])
+		line = line[closing:]
+	}
+
+	return b.String()
+}
+
+// rewriteOutsideURLs calls fn for the parts of text between absolute URLs
+func rewriteOutsideURLs(text string, fn func(text string) string) string {
+	var b strings.Builder
+
+	last := 0
+	for _, loc := range urlPattern.FindAllStringIndex(text, -1) {
+		b.WriteString(fn(text[last:loc[0]]))
+		b.WriteString(text[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	b.WriteString(fn(text[last:]))
+
+	return b.String()
+}
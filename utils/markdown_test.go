@@ -0,0 +1,172 @@
+// markdown_test.go
+
+// Package utils provides utility functions used throughout the application
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+// testMarkdownRewriter rewrites the text of platform/api. Issue #2 and merge request !1
+// were migrated to other numbers, tools/cli moved to another owner and other/proj was not
+// migrated.
+func testMarkdownRewriter() *MarkdownRewriter {
+	issues := map[string]map[int]int{
+		"platform/api": {1: 1, 2: 5},
+		"platform/web": {3: 3},
+	}
+	pulls := map[string]map[int]int{
+		"platform/api": {1: 10},
+	}
+
+	return &MarkdownRewriter{
+		GitLabURL: "https://gitlab.example.com/",
+		Project:   "platform/api",
+		Projects: map[string]string{
+			"platform/api": "platform/api",
+			"platform/web": "platform/web",
+			"tools/cli":    "tools-org/cli",
+		},
+		Issue: func(repo string, iid int) (int, bool) {
+			number, ok := issues[repo][iid]
+			return number, ok
+		},
+		PullRequest: func(repo string, iid int) (int, bool) {
+			number, ok := pulls[repo][iid]
+			return number, ok
+		},
+		Labels: map[string]string{
+			"bug":          "https://gitea.example.com/platform/api/issues?labels=1",
+			"needs review": "",
+		},
+		Milestones: map[string]string{
+			"v1.0": "https://gitea.example.com/platform/api/milestone/2",
+		},
+		Mentions: NewMentionMap([]string{"john.doe"}, func(username string) string {
+			return strings.ReplaceAll(username, "john.doe", "jdoe")
+		}),
+	}
+}
+
+func TestMarkdownRewriterRewrite(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"empty", "", ""},
+		{"issue with same number", "See #1", "See #1"},
+		{"issue with other number", "See #2.", "See #5."},
+		{"merge request", "Fixed in !1", "Fixed in #10"},
+		{"unknown issue", "Blocked by #99", "Blocked by #99"},
+		{"unknown merge request", "Replaced by !7", "Replaced by !7"},
+		{"hex colour", "Use #123456 for the header", "Use #123456 for the header"},
+		{"sibling project", "Same as web#3", "Same as platform/web#3"},
+		{"project path", "Same as platform/web#3", "Same as platform/web#3"},
+		{"bare word", "Item#2 and x!1", "Item#2 and x!1"},
+		{"unknown number of migrated project", "See tools/cli#4", "See tools/cli#4"},
+		{"issue of project not migrated", "See other/proj#4",
+			"See [other/proj#4](https://gitlab.example.com/other/proj/-/issues/4)"},
+		{"merge request of project not migrated", "See other/proj!4",
+			"See [other/proj!4](https://gitlab.example.com/other/proj/-/merge_requests/4)"},
+		{"commit of migrated project", "In tools/cli@1a2b3c4", "In tools-org/cli@1a2b3c4"},
+		{"commit of project not migrated", "In other/proj@1a2b3c4d",
+			"In [other/proj@1a2b3c4d](https://gitlab.example.com/other/proj/-/commit/1a2b3c4d)"},
+		{"label", "Marked ~bug", "Marked [bug](https://gitea.example.com/platform/api/issues?labels=1)"},
+		{"quoted label without link", `Marked ~"needs review"`, "Marked `needs review`"},
+		{"unknown label", "Marked ~feature", "Marked ~feature"},
+		{"milestone", "Planned for %v1.0", "Planned for [v1.0](https://gitea.example.com/platform/api/milestone/2)"},
+		{"upload", "![shot](/uploads/0123456789abcdef0123456789abcdef/shot.png)",
+			"![shot](https://gitlab.example.com/platform/api/uploads/0123456789abcdef0123456789abcdef/shot.png)"},
+		{"mention", "cc @john.doe", "cc @jdoe"},
+		{"quick action word", "/merge this tomorrow\nok", "/merge this tomorrow\nok"},
+		{"quick action with mention", "/assign @john.doe", "/assign @jdoe"},
+		{"fenced code block", "```\n#2\n```\n#2", "```\n#2\n```\n#5"},
+		{"tilde fence", "~~~\n!1\n~~~", "~~~\n!1\n~~~"},
+		{"inline code", "`#2` and #2", "`#2` and #5"},
+		{"url", "https://example.com/page#2 and #2", "https://example.com/page#2 and #5"},
+		{"indented code block", "Run:\n\n    grep #2\n\n    echo !1\nafter #2", "Run:\n\n    grep #2\n\n    echo !1\nafter #5"},
+		{"tab-indented code block", "\tgrep #2", "\tgrep #2"},
+		{"indented paragraph continuation", "Text\n    #2", "Text\n    #5"},
+		{"line count kept", "a\n\n\nb", "a\n\n\nb"},
+	}
+
+	r := testMarkdownRewriter()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.Rewrite(tt.text); got != tt.want {
+				t.Errorf("Rewrite(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkdownRewriterWithoutIssueMapping(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"issue keeps its number", "See #2", "See #2"},
+		{"issue of other project", "See web#3", "See platform/web#3"},
+		{"merge request", "Fixed in !1", "Fixed in #10"},
+	}
+
+	r := testMarkdownRewriter()
+	r.Issue = nil
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.Rewrite(tt.text); got != tt.want {
+				t.Errorf("Rewrite(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkdownRewriterHasUnresolvedReferences(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want bool
+	}{
+		{"none", "plain text", false},
+		{"known issue", "See #2", false},
+		{"known merge request", "See !1", false},
+		{"unknown issue", "See #99", true},
+		{"unknown merge request", "See !7", true},
+		{"unknown number of migrated project", "See tools/cli#4", true},
+		{"project not migrated", "See other/proj#4", false},
+		{"bare word", "Item#99", false},
+		{"inline code", "`#99`", false},
+		{"fenced code block", "```\n!7\n```", false},
+		{"indented code block", "    #99", false},
+	}
+
+	r := testMarkdownRewriter()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.HasUnresolvedReferences(tt.text); got != tt.want {
+				t.Errorf("HasUnresolvedReferences(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkdownRewriterUploadLinks(t *testing.T) {
+	r := testMarkdownRewriter()
+	text := r.Rewrite("![a](/uploads/0123456789abcdef0123456789abcdef/my%20file.png) " +
+		"[b](/uploads/0123456789abcdef0123456789abcdef/my%20file.png) " +
+		"[c](/uploads/fedcba9876543210fedcba9876543210/log.txt)")
+
+	links := r.UploadLinks(text)
+	if len(links) != 2 {
+		t.Fatalf("UploadLinks found %d links, want 2: %+v", len(links), links)
+	}
+	if links[0].Secret != "0123456789abcdef0123456789abcdef" || links[0].Filename != "my file.png" {
+		t.Errorf("first link = %+v", links[0])
+	}
+	if links[1].Secret != "fedcba9876543210fedcba9876543210" || links[1].Filename != "log.txt" {
+		t.Errorf("second link = %+v", links[1])
+	}
+}
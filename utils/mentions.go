@@ -8,45 +8,110 @@ import (
 	"strings"
 )
 
-// mentionPattern matches @username mentions in text
-var mentionPattern = regexp.MustCompile(`@([a-zA-Z0-9_\.-]+(?:\s+[a-zA-Z0-9_\.-]+)*)`)
+// mentionPattern matches @username and @group/subgroup mentions. The character before
+// the @ must not belong to a word, so email addresses such as alice@example.com are not
+// mistaken for mentions.
+var mentionPattern = regexp.MustCompile(`(^|[^\w.+\-%/@])@([A-Za-z0-9_][A-Za-z0-9_.\-]*)((?:/[A-Za-z0-9_.\-]+)*)`)
 
-// ExtractUserMentions extracts all @username mentions from text
-func ExtractUserMentions(text string) []string {
-	if text == "" {
-		return []string{}
+// MentionMap resolves @mentions against the users of GitLab and rewrites them to the
+// usernames those users have in Gitea. Mentions of names that are not GitLab users, such
+// as @all or group mentions, are left alone. A nil MentionMap treats every mention as a
+// user and normalizes it with NormalizeUsername.
+type MentionMap struct {
+	users  map[string]string            // lower-case GitLab username to GitLab username
+	rename func(username string) string // GitLab username to Gitea username
+}
+
+// NewMentionMap creates a MentionMap for the given GitLab usernames. rename returns the
+// Gitea username of a GitLab user; nil uses NormalizeUsername.
+func NewMentionMap(usernames []string, rename func(username string) string) *MentionMap {
+	users := make(map[string]string, len(usernames))
+	for _, username := range usernames {
+		users[strings.ToLower(username)] = username
+	}
+	if rename == nil {
+		rename = NormalizeUsername
 	}
+	return &MentionMap{users: users, rename: rename}
+}
 
-	// Find all matches
-	matches := mentionPattern.FindAllStringSubmatch(text, -1)
+// Resolve returns the GitLab username a mention refers to. GitLab matches usernames
+// without regard to case.
+func (mm *MentionMap) Resolve(mention string) (string, bool) {
+	if mm == nil {
+		return mention, true
+	}
+	username, ok := mm.users[strings.ToLower(mention)]
+	return username, ok
+}
 
-	// Extract the username part of each match
-	result := make([]string, 0, len(matches))
-	for _, match := range matches {
-		if len(match) >= 2 {
-			result = append(result, match[1])
+// Extract returns the GitLab users mentioned in text, each once and in order of their
+// first mention. Mentions in code blocks, inline code and URLs do not count.
+func (mm *MentionMap) Extract(text string) []string {
+	var usernames []string
+	seen := map[string]bool{}
+
+	mm.rewriteMentions(text, func(username string) string {
+		if !seen[username] {
+			seen[username] = true
+			usernames = append(usernames, username)
 		}
+		return username
+	})
+
+	if usernames == nil {
+		return []string{}
 	}
+	return usernames
+}
 
-	// Ignore everything we found and return nothing
-	return []string{""}
+// Rewrite replaces mentions of GitLab users in text with their Gitea usernames. Mentions
+// in code blocks, inline code and URLs are left alone.
+func (mm *MentionMap) Rewrite(text string) string {
+	if mm == nil {
+		return mm.rewriteMentions(text, NormalizeUsername)
+	}
+	return mm.rewriteMentions(text, mm.rename)
 }
 
-// NormalizeMentions replaces all @mentions in text with their normalized versions
-func NormalizeMentions(text string) string {
+// rewriteMentions replaces every mention of a GitLab user outside code and URLs with the
+// result of fn for the user's GitLab username
+func (mm *MentionMap) rewriteMentions(text string, fn func(username string) string) string {
 	if text == "" {
 		return text
 	}
 
-	// Extract all mentions
-	mentions := ExtractUserMentions(text)
+	return rewriteLines(text, func(line string) string {
+		return rewriteText(line, func(text string) string {
+			return mentionPattern.ReplaceAllStringFunc(text, func(match string) string {
+				parts := mentionPattern.FindStringSubmatch(match)
+				if parts[3] != "" {
+					// Subgroups are never users
+					return match
+				}
 
-	// Replace each mention with its normalized version
-	result := text
-	for _, mention := range mentions {
-		normalized := NormalizeUsername(mention)
-		result = strings.ReplaceAll(result, "@"+mention, "@"+normalized)
-	}
+				// Usernames cannot end with a dot, so a trailing dot ends the sentence
+				mention := strings.TrimRight(parts[2], ".")
+				username, ok := mm.Resolve(mention)
+				if !ok {
+					return match
+				}
+				return parts[1] + "@" + fn(username) + parts[2][len(mention):]
+			})
+		})
+	})
+}
 
-	return result
+// ExtractUserMentions extracts all @username mentions from text, treating every mention
+// as a user
+func ExtractUserMentions(text string) []string {
+	var mm *MentionMap
+	return mm.Extract(text)
+}
+
+// NormalizeMentions replaces all @mentions in text with their normalized versions,
+// treating every mention as a user
+func NormalizeMentions(text string) string {
+	var mm *MentionMap
+	return mm.Rewrite(text)
 }
@@ -0,0 +1,106 @@
+// mentions_test.go
+
+// Package utils provides utility functions used throughout the application
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testMentionMap knows alice, Bob and john.doe, whose Gitea name differs
+func testMentionMap() *MentionMap {
+	return NewMentionMap([]string{"alice", "Bob", "john.doe"}, func(username string) string {
+		if username == "john.doe" {
+			return "jdoe"
+		}
+		return strings.ToLower(username)
+	})
+}
+
+func TestMentionMapExtract(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"empty", "", []string{}},
+		{"plain", "thanks @alice", []string{"alice"}},
+		{"start of text", "@alice please look", []string{"alice"}},
+		{"case insensitive", "cc @ALICE and @bob", []string{"alice", "Bob"}},
+		{"repeated", "@alice, @alice and @alice", []string{"alice"}},
+		{"order of first mention", "@Bob then @alice then @Bob", []string{"Bob", "alice"}},
+		{"trailing period", "Ask @alice.", []string{"alice"}},
+		{"trailing comma", "@alice, see this", []string{"alice"}},
+		{"in parentheses", "(see @alice)", []string{"alice"}},
+		{"dotted username", "ping @john.doe.", []string{"john.doe"}},
+		{"fenced code block", "```\n@alice\n```\nby @Bob", []string{"Bob"}},
+		{"tilde fence", "~~~\n@alice\n~~~", []string{}},
+		{"inline code", "run `git blame @alice` with @Bob", []string{"Bob"}},
+		{"email address", "mail alice@example.com", []string{}},
+		{"url with @", "see https://example.com/@alice/post and http://x.org/u@alice", []string{}},
+		{"subgroup mention", "@alice/team owns it", []string{}},
+		{"group path mention", "@platform/infra/terraform", []string{}},
+		{"unknown user", "@mallory and @all", []string{}},
+	}
+
+	mm := testMentionMap()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mm.Extract(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Extract(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMentionMapRewrite(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"empty", "", ""},
+		{"same name", "thanks @alice", "thanks @alice"},
+		{"lower-cased", "cc @Bob", "cc @bob"},
+		{"renamed", "cc @john.doe", "cc @jdoe"},
+		{"renamed with trailing period", "Ask @john.doe.", "Ask @jdoe."},
+		{"renamed with trailing punctuation", "@john.doe, @john.doe! @john.doe?", "@jdoe, @jdoe! @jdoe?"},
+		{"fenced code block", "```\n@john.doe\n```\n@john.doe", "```\n@john.doe\n```\n@jdoe"},
+		{"inline code", "`@john.doe` is @john.doe", "`@john.doe` is @jdoe"},
+		{"email address", "john.doe@example.com", "john.doe@example.com"},
+		{"url with @", "https://example.com/@john.doe", "https://example.com/@john.doe"},
+		{"subgroup mention", "@john.doe/team", "@john.doe/team"},
+		{"unknown user", "@mallory", "@mallory"},
+	}
+
+	mm := testMentionMap()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mm.Rewrite(tt.text); got != tt.want {
+				t.Errorf("Rewrite(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNilMentionMap(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"any mention is a user", "@mallory and @alice.", []string{"mallory", "alice"}},
+		{"code is skipped", "`@mallory` and @alice", []string{"alice"}},
+		{"email is skipped", "alice@example.com", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExtractUserMentions(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExtractUserMentions(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
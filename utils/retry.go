@@ -0,0 +1,201 @@
+// retry.go
+
+// Package utils provides utility functions used throughout the application
+package utils
+
+import (
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RetryPolicy controls how failed requests are retried
+type RetryPolicy struct {
+	MaxRetries int
+	MinWait    time.Duration
+	MaxWait    time.Duration
+}
+
+// DefaultRetryPolicy returns the retry policy used when none is configured
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries: 3,
+		MinWait:    time.Second,
+		MaxWait:    time.Minute,
+	}
+}
+
+// RetryTransport is an http.RoundTripper that retries failed requests with exponential
+// backoff and jitter, honours Retry-After and RateLimit-Reset headers, and caps the
+// number of requests sent per second.
+type RetryTransport struct {
+	base    http.RoundTripper
+	mutex   sync.Mutex
+	policy  RetryPolicy
+	limiter *rate.Limiter
+}
+
+// NewRetryTransport wraps base with the default retry policy and no rate limit
+func NewRetryTransport(base http.RoundTripper) *RetryTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &RetryTransport{
+		base:    base,
+		policy:  DefaultRetryPolicy(),
+		limiter: rate.NewLimiter(rate.Inf, 1),
+	}
+}
+
+// SetPolicy changes the retry policy for subsequent requests
+func (t *RetryTransport) SetPolicy(policy RetryPolicy) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.policy = policy
+}
+
+// SetRateLimit caps the number of requests sent per second.
+// A value of 0 or less removes the cap.
+func (t *RetryTransport) SetRateLimit(requestsPerSecond float64) {
+	if requestsPerSecond <= 0 {
+		t.limiter.SetLimit(rate.Inf)
+		return
+	}
+	t.limiter.SetLimit(rate.Limit(requestsPerSecond))
+}
+
+// RoundTrip sends the request, retrying it while the failure is transient and the
+// request can safely be sent again
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mutex.Lock()
+	policy := t.policy
+	t.mutex.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		if err := t.limiter.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+
+		attemptReq := req
+		if attempt > 0 && req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = body
+		}
+
+		resp, err := t.base.RoundTrip(attemptReq)
+		if attempt >= policy.MaxRetries || !shouldRetry(req, resp, err) {
+			return resp, err
+		}
+
+		wait := retryWait(policy, attempt, resp)
+		if resp != nil {
+			// Drain the body so the connection can be reused
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// shouldRetry reports whether a failed request is worth sending again. Idempotent requests
+// are retried on any transient failure; others only when the server cannot have acted on them.
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	if err != nil {
+		if req.Context().Err() != nil {
+			return false
+		}
+		if isDialError(err) {
+			return true
+		}
+		return isIdempotent(req.Method)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return isIdempotent(req.Method)
+	}
+	return false
+}
+
+// isIdempotent reports whether sending a request with the method twice has the same effect as once
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isDialError reports whether err happened while connecting, before anything was sent
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// retryWait returns how long to wait before the next attempt. A Retry-After or
+// RateLimit-Reset header from the server wins over exponential backoff.
+func retryWait(policy RetryPolicy, attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if wait, ok := serverWait(resp.Header); ok {
+			return min(wait, policy.MaxWait)
+		}
+	}
+
+	backoff := float64(policy.MinWait) * math.Pow(2, float64(attempt))
+	if backoff > float64(policy.MaxWait) {
+		backoff = float64(policy.MaxWait)
+	}
+
+	// Full jitter keeps concurrent workers from retrying in lockstep
+	return time.Duration(rand.Float64() * backoff)
+}
+
+// serverWait reads the wait requested by the server from Retry-After or RateLimit-Reset
+func serverWait(header http.Header) (time.Duration, bool) {
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if at, err := http.ParseTime(value); err == nil {
+			return max(time.Until(at), 0), true
+		}
+	}
+
+	if value := header.Get("RateLimit-Reset"); value != "" {
+		if reset, err := strconv.ParseInt(value, 10, 64); err == nil {
+			// GitLab sends a Unix timestamp, the IETF draft a number of seconds
+			if reset > 1e9 {
+				return max(time.Until(time.Unix(reset, 0)), 0), true
+			}
+			return time.Duration(reset) * time.Second, true
+		}
+	}
+
+	return 0, false
+}
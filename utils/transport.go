@@ -0,0 +1,97 @@
+// transport.go
+
+// Package utils provides utility functions used throughout the application
+package utils
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// HostLimiter is an http.RoundTripper that caps the number of requests
+// in flight to each host. A limit of 0 or less means no limit.
+type HostLimiter struct {
+	base  http.RoundTripper
+	mutex sync.Mutex
+	limit int
+	slots map[string]chan struct{}
+}
+
+// NewHostLimiter wraps base with a per-host concurrency limit
+func NewHostLimiter(base http.RoundTripper, limit int) *HostLimiter {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &HostLimiter{
+		base:  base,
+		limit: limit,
+		slots: make(map[string]chan struct{}),
+	}
+}
+
+// SetLimit changes the per-host concurrency limit for subsequent requests
+func (l *HostLimiter) SetLimit(limit int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.limit = limit
+	l.slots = make(map[string]chan struct{})
+}
+
+// RoundTrip waits for a free slot for the request's host and then sends the request,
+// holding the slot until the response body is closed
+func (l *HostLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	slots := l.hostSlots(req.URL.Host)
+	if slots == nil {
+		return l.base.RoundTrip(req)
+	}
+
+	select {
+	case slots <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	release := func() { <-slots }
+
+	resp, err := l.base.RoundTrip(req)
+	if err != nil || resp.Body == nil {
+		release()
+		return resp, err
+	}
+
+	// The request is in flight until its body has been read and closed
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releasingBody is a response body that frees the slot of its request when closed
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+// Close closes the body and frees the slot of its request
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// hostSlots returns the semaphore for a host, or nil if requests are unlimited
+func (l *HostLimiter) hostSlots(host string) chan struct{} {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.limit <= 0 {
+		return nil
+	}
+
+	slots, ok := l.slots[host]
+	if !ok {
+		slots = make(chan struct{}, l.limit)
+		l.slots[host] = slots
+	}
+	return slots
+}
@@ -0,0 +1,109 @@
+// wiki.go
+
+// Package utils provides utility functions used throughout the application
+package utils
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	// wikiLinkPattern matches Markdown links and images: prefix, text, target and title
+	wikiLinkPattern = regexp.MustCompile(`(!?)\[([^\]]*)\]\(([^)\s]+)((?:\s+"[^"]*")?)\)`)
+	// fileExtPattern matches extensions of files, as opposed to dots inside page slugs
+	fileExtPattern = regexp.MustCompile(`^\.[a-zA-Z0-9]{1,5}$`)
+
+	// specialWikiPages maps GitLab's special pages to the names Gitea gives them
+	specialWikiPages = map[string]string{
+		"home":     "Home",
+		"_sidebar": "_Sidebar",
+		"_footer":  "_Footer",
+	}
+)
+
+// IsWikiPage reports whether a file of a GitLab wiki is a Markdown page
+func IsWikiPage(file string) bool {
+	ext := strings.ToLower(path.Ext(file))
+	return ext == ".md" || ext == ".markdown"
+}
+
+// WikiPagePath converts the path of a GitLab wiki file to the path Gitea expects. Markdown
+// pages get the .md extension, dashes instead of spaces and Gitea's names for the home
+// page, sidebar and footer. Other files keep their path.
+func WikiPagePath(file string) string {
+	if !IsWikiPage(file) {
+		return file
+	}
+	return wikiPageName(strings.TrimSuffix(file, path.Ext(file))) + ".md"
+}
+
+// ConvertWikiLinks rewrites the relative links of a GitLab wiki page for Gitea. GitLab
+// resolves them against the directory of the page, Gitea against the root of the wiki,
+// so they are made relative to the root. Links to pages lose their extension, and links
+// to other files point at Gitea's raw file view. Images are left to Gitea, which already
+// loads them from the raw view.
+func ConvertWikiLinks(content, pagePath string) string {
+	pageDir := path.Dir(pagePath)
+
+	return wikiLinkPattern.ReplaceAllStringFunc(content, func(match string) string {
+		parts := wikiLinkPattern.FindStringSubmatch(match)
+		image, text, target, title := parts[1], parts[2], parts[3], parts[4]
+
+		converted, ok := convertWikiLink(target, pageDir, image != "")
+		if !ok {
+			return match
+		}
+		return image + "[" + text + "](" + converted + title + ")"
+	})
+}
+
+// convertWikiLink converts a single link target, reporting false for targets that do not
+// point into the wiki
+func convertWikiLink(target, pageDir string, image bool) (string, bool) {
+	if target == "" || strings.HasPrefix(target, "#") || strings.HasPrefix(target, "//") ||
+		strings.Contains(target, "://") || strings.HasPrefix(target, "mailto:") {
+		return "", false
+	}
+
+	target, fragment, _ := strings.Cut(target, "#")
+	if fragment != "" {
+		fragment = "#" + fragment
+	}
+
+	// GitLab treats links starting with a slash, and files uploaded to the wiki, as relative
+	// to the root of the wiki
+	var linkPath string
+	if strings.HasPrefix(target, "uploads/") {
+		linkPath = path.Clean(target)
+	} else if strings.HasPrefix(target, "/") {
+		linkPath = path.Clean(strings.TrimPrefix(target, "/"))
+	} else {
+		linkPath = path.Join(pageDir, target)
+	}
+	if linkPath == "." || linkPath == ".." || strings.HasPrefix(linkPath, "../") {
+		return "", false
+	}
+
+	ext := path.Ext(linkPath)
+	switch {
+	case IsWikiPage(linkPath):
+		return wikiPageName(strings.TrimSuffix(linkPath, ext)) + fragment, true
+	case !fileExtPattern.MatchString(ext):
+		return wikiPageName(linkPath) + fragment, true
+	case image:
+		return linkPath + fragment, true
+	default:
+		return "raw/" + linkPath + fragment, true
+	}
+}
+
+// wikiPageName converts a GitLab page slug without extension to a Gitea page name
+func wikiPageName(slug string) string {
+	dir, name := path.Split(slug)
+	if special, ok := specialWikiPages[strings.ToLower(name)]; ok && dir == "" {
+		name = special
+	}
+	return dir + strings.ReplaceAll(name, " ", "-")
+}